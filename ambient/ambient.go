@@ -0,0 +1,285 @@
+/*
+Package ambient drives lamps from image content, the "bias lighting behind the TV" feature. Every frame is split
+into regions, the average or dominant color of each region is smoothed and pushed to the lamps assigned to it.
+
+Example:
+
+	m, err := y.StartMusic()
+	if err != nil {
+		...
+	}
+
+	defer m.Close()
+
+	s := &ambient.Sync{
+		Source: ambient.Raw(os.Stdin, 64, 36),
+		Zones: []ambient.Zone{
+			{Region: ambient.Region{X: 0, Y: 0, W: 0.5, H: 1}, Lamps: []ambient.Target{m}},
+		},
+	}
+
+	err = s.Run(ctx)
+*/
+package ambient
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"time"
+)
+
+// Target is a lamp the colors are pushed to, usually a *yeelight.Music.
+type Target interface {
+	SetRGB(red, green, blue int, effect string, duration int) error
+	SetBright(brightness int, effect string, duration int) error
+}
+
+// Region is a part of the frame relative to its size, {0, 0, 1, 1} is the whole frame.
+type Region struct {
+	X float64
+	Y float64
+	W float64
+	H float64
+}
+
+func (r Region) rect(b image.Rectangle) image.Rectangle {
+	w, h := float64(b.Dx()), float64(b.Dy())
+
+	rect := image.Rect(
+		b.Min.X+int(r.X*w),
+		b.Min.Y+int(r.Y*h),
+		b.Min.X+int(math.Ceil((r.X+r.W)*w)),
+		b.Min.Y+int(math.Ceil((r.Y+r.H)*h)),
+	)
+
+	return rect.Intersect(b)
+}
+
+// Samples taken per region side, large frames are not read pixel by pixel.
+const samples = 64
+
+/*
+This function is used to compute the average color of a region.
+*/
+func Average(img image.Image, region Region) color.RGBA {
+	var r, g, b, n uint64
+
+	each(img, region, func(c color.RGBA) {
+		r += uint64(c.R)
+		g += uint64(c.G)
+		b += uint64(c.B)
+		n++
+	})
+
+	if n == 0 {
+		return color.RGBA{A: 255}
+	}
+
+	return color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), 255}
+}
+
+/*
+This function is used to compute the dominant color of a region. Colors are grouped in buckets of similar colors,
+the average of the largest bucket is returned. Near black pixels only count when the whole region is dark,
+so letterbox bars don't win over the picture.
+*/
+func Dominant(img image.Image, region Region) color.RGBA {
+	type bucket struct {
+		r, g, b, n uint64
+	}
+
+	buckets := map[uint16]*bucket{}
+	var dark, total uint64
+
+	each(img, region, func(c color.RGBA) {
+		total++
+		if int(c.R)+int(c.G)+int(c.B) < 48 {
+			dark++
+			return
+		}
+
+		key := uint16(c.R>>4)<<8 | uint16(c.G>>4)<<4 | uint16(c.B>>4)
+
+		bk, ok := buckets[key]
+		if !ok {
+			bk = &bucket{}
+			buckets[key] = bk
+		}
+
+		bk.r += uint64(c.R)
+		bk.g += uint64(c.G)
+		bk.b += uint64(c.B)
+		bk.n++
+	})
+
+	var best *bucket
+	var bestKey uint16
+	for key, bk := range buckets {
+		// Ties go to the lowest key so the result doesn't depend on map order.
+		if best == nil || bk.n > best.n || (bk.n == best.n && key < bestKey) {
+			best, bestKey = bk, key
+		}
+	}
+
+	if best == nil || dark > total*9/10 {
+		return Average(img, region)
+	}
+
+	return color.RGBA{uint8(best.r / best.n), uint8(best.g / best.n), uint8(best.b / best.n), 255}
+}
+
+func each(img image.Image, region Region, fn func(color.RGBA)) {
+	rect := region.rect(img.Bounds())
+	if rect.Empty() {
+		return
+	}
+
+	stepX := max(1, rect.Dx()/samples)
+	stepY := max(1, rect.Dy()/samples)
+
+	for y := rect.Min.Y; y < rect.Max.Y; y += stepY {
+		for x := rect.Min.X; x < rect.Max.X; x += stepX {
+			fn(color.RGBAModel.Convert(img.At(x, y)).(color.RGBA))
+		}
+	}
+}
+
+// Zone assigns lamps to a region of the frame.
+type Zone struct {
+	Region Region
+	Lamps  []Target
+
+	// Use the dominant color instead of the average color.
+	Dominant bool
+}
+
+/*
+Sync reads frames from the source and pushes the color of every zone to its lamps.
+*/
+type Sync struct {
+	Source Source
+	Zones  []Zone
+
+	// Frames per second, default 25. Streams like stdin are also paced by the producer.
+	FPS int
+
+	// How much of the previous color is kept each frame, range 0 ~ 1, default 0.5. Higher values are calmer.
+	Smoothing float64
+
+	// Called with the color sent to every zone after each frame.
+	OnFrame func(colors []color.RGBA)
+
+	state []zoneState
+}
+
+type zoneState struct {
+	r, g, b    float64
+	sent       color.RGBA
+	brightness int
+	started    bool
+}
+
+/*
+This function is used to run the sync until the source is drained or the context is cancelled.
+A drained source returns nil.
+*/
+func (s *Sync) Run(ctx context.Context) error {
+	fps := s.FPS
+	if fps <= 0 {
+		fps = 25
+	}
+
+	smoothing := s.Smoothing
+	if smoothing == 0 {
+		smoothing = 0.5
+	}
+
+	s.state = make([]zoneState, len(s.Zones))
+	duration := int(time.Second / time.Duration(fps) / time.Millisecond)
+
+	ticker := time.NewTicker(time.Second / time.Duration(fps))
+	defer ticker.Stop()
+
+	for {
+		img, err := s.Source.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		colors := make([]color.RGBA, len(s.Zones))
+		for i, zone := range s.Zones {
+			c := Average(img, zone.Region)
+			if zone.Dominant {
+				c = Dominant(img, zone.Region)
+			}
+
+			colors[i], err = s.push(i, c, smoothing, duration)
+			if err != nil {
+				return err
+			}
+		}
+
+		if s.OnFrame != nil {
+			s.OnFrame(colors)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Sync) push(i int, c color.RGBA, smoothing float64, duration int) (color.RGBA, error) {
+	st := &s.state[i]
+
+	if st.started {
+		st.r = st.r*smoothing + float64(c.R)*(1-smoothing)
+		st.g = st.g*smoothing + float64(c.G)*(1-smoothing)
+		st.b = st.b*smoothing + float64(c.B)*(1-smoothing)
+	} else {
+		st.r, st.g, st.b = float64(c.R), float64(c.G), float64(c.B)
+	}
+
+	smoothed := color.RGBA{uint8(math.Round(st.r)), uint8(math.Round(st.g)), uint8(math.Round(st.b)), 255}
+
+	// The lamp shows the hue at full value, the value itself becomes the brightness.
+	value := math.Max(st.r, math.Max(st.g, st.b))
+	brightness := 1 + int(math.Round(99*value/255))
+
+	hue := color.RGBA{A: 255}
+	if value > 0 {
+		hue = color.RGBA{
+			uint8(math.Round(st.r * 255 / value)),
+			uint8(math.Round(st.g * 255 / value)),
+			uint8(math.Round(st.b * 255 / value)),
+			255,
+		}
+	}
+
+	for _, lamp := range s.Zones[i].Lamps {
+		if !st.started || hue != st.sent {
+			if err := lamp.SetRGB(int(hue.R), int(hue.G), int(hue.B), "smooth", duration); err != nil {
+				return smoothed, err
+			}
+		}
+
+		if !st.started || brightness != st.brightness {
+			if err := lamp.SetBright(brightness, "smooth", duration); err != nil {
+				return smoothed, err
+			}
+		}
+	}
+
+	st.sent, st.brightness, st.started = hue, brightness, true
+
+	return smoothed, nil
+}
@@ -0,0 +1,109 @@
+package ambient
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Source gives frames one by one, io.EOF means there are no more frames.
+type Source interface {
+	Next() (image.Image, error)
+}
+
+type files struct {
+	paths []string
+}
+
+/*
+This function is used to read PNG or JPEG files as frames, in the given order.
+*/
+func Files(paths ...string) Source {
+	return &files{paths}
+}
+
+/*
+This function is used to read an image sequence directory. PNG and JPEG files are read in name order,
+so "frame0001.png", "frame0002.png" and so on.
+*/
+func Dir(path string) (Source, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".png", ".jpg", ".jpeg":
+			paths = append(paths, filepath.Join(path, e.Name()))
+		}
+	}
+
+	sort.Strings(paths)
+
+	return &files{paths}, nil
+}
+
+func (f *files) Next() (image.Image, error) {
+	if len(f.paths) == 0 {
+		return nil, io.EOF
+	}
+
+	path := f.paths[0]
+	f.paths = f.paths[1:]
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return img, nil
+}
+
+type raw struct {
+	r      io.Reader
+	width  int
+	height int
+}
+
+/*
+This function is used to read raw RGB frames, 3 bytes per pixel without padding, for example from stdin:
+
+	ffmpeg -i movie.mkv -vf scale=64:36 -f rawvideo -pix_fmt rgb24 - | myapp
+*/
+func Raw(r io.Reader, width, height int) Source {
+	return &raw{r, width, height}
+}
+
+func (r *raw) Next() (image.Image, error) {
+	img := image.NewRGBA(image.Rect(0, 0, r.width, r.height))
+	buf := make([]byte, r.width*r.height*3)
+
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+
+		return nil, err
+	}
+
+	for i := 0; i < r.width*r.height; i++ {
+		copy(img.Pix[i*4:], buf[i*3:i*3+3])
+		img.Pix[i*4+3] = 255
+	}
+
+	return img, nil
+}
@@ -0,0 +1,181 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Features is what the analyzer found in one frame of audio.
+type Features struct {
+	// Root mean square of the samples, range 0 ~ 1.
+	Energy float64
+
+	// Share of the spectrum in each band, together they sum up to 1.
+	Bass   float64
+	Mid    float64
+	Treble float64
+
+	// Spectral centroid in Hz, the "brightness" of the sound.
+	Centroid float64
+
+	// Beat is true when the energy jumps above the recent average.
+	Beat bool
+}
+
+/*
+Analyzer does energy based beat detection and a spectral analysis of consecutive frames.
+The zero value is ready to use.
+*/
+type Analyzer struct {
+	// A frame is a beat when its energy is Sensitivity times the average of the last second, default 1.4.
+	Sensitivity float64
+
+	// Frames quieter than this are never a beat, default 0.02.
+	Threshold float64
+
+	history []float64
+	next    int
+	hold    int
+}
+
+/*
+This function is used to analyze one frame of mono samples. Frames should be passed in order and have the same length,
+the beat detection compares each frame with the frames of the last second.
+*/
+func (a *Analyzer) Analyze(samples []float64, sampleRate int) Features {
+	var f Features
+	if len(samples) == 0 {
+		return f
+	}
+
+	var sum float64
+	for _, s := range samples {
+		sum += s * s
+	}
+	f.Energy = math.Sqrt(sum / float64(len(samples)))
+
+	f.Bass, f.Mid, f.Treble, f.Centroid = spectrum(samples, sampleRate)
+	f.Beat = a.beat(f.Energy, sampleRate/len(samples))
+
+	return f
+}
+
+func (a *Analyzer) beat(energy float64, fps int) bool {
+	sensitivity := a.Sensitivity
+	if sensitivity == 0 {
+		sensitivity = 1.4
+	}
+
+	threshold := a.Threshold
+	if threshold == 0 {
+		threshold = 0.02
+	}
+
+	if fps < 1 {
+		fps = 1
+	}
+
+	if cap(a.history) != fps {
+		a.history = make([]float64, 0, fps)
+		a.next = 0
+	}
+
+	var avg float64
+	for _, e := range a.history {
+		avg += e
+	}
+
+	beat := false
+	if len(a.history) > 0 && a.hold == 0 {
+		avg /= float64(len(a.history))
+		beat = energy > threshold && energy > avg*sensitivity
+	}
+
+	// A kick rings over a few frames, ignore the next 125ms after a beat.
+	if beat {
+		a.hold = (fps + 7) / 8
+	} else if a.hold > 0 {
+		a.hold--
+	}
+
+	if len(a.history) < cap(a.history) {
+		a.history = append(a.history, energy)
+	} else {
+		a.history[a.next] = energy
+		a.next = (a.next + 1) % len(a.history)
+	}
+
+	return beat
+}
+
+func spectrum(samples []float64, sampleRate int) (bass, mid, treble, centroid float64) {
+	n := 1
+	for n < len(samples) {
+		n <<= 1
+	}
+
+	x := make([]complex128, n)
+	for i, s := range samples {
+		// Hann window against spectral leakage.
+		w := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(len(samples)))
+		x[i] = complex(s*w, 0)
+	}
+
+	fft(x)
+
+	var total, weighted float64
+	for k := 1; k < n/2; k++ {
+		hz := float64(k) * float64(sampleRate) / float64(n)
+		power := cmplx.Abs(x[k])
+		power *= power
+
+		switch {
+		case hz < 250:
+			bass += power
+		case hz < 2000:
+			mid += power
+		default:
+			treble += power
+		}
+
+		total += power
+		weighted += hz * power
+	}
+
+	if total == 0 {
+		return 0, 0, 0, 0
+	}
+
+	return bass / total, mid / total, treble / total, weighted / total
+}
+
+// fft is an in place radix-2 Cooley-Tukey transform, len(x) should be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := x[start+k], w*x[start+k+size/2]
+				x[start+k] = even + odd
+				x[start+k+size/2] = even - odd
+				w *= step
+			}
+		}
+	}
+}
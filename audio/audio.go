@@ -0,0 +1,182 @@
+/*
+Package audio makes a lamp pulse with music. Samples are read from a WAV file or a raw PCM stream, analyzed frame by frame
+and streamed to the lamp over a music mode connection at a fixed frame rate.
+
+Example:
+
+	m, err := y.StartMusic()
+	if err != nil {
+		...
+	}
+
+	defer m.Close()
+
+	src, err := audio.ReadWAV(file)
+	if err != nil {
+		...
+	}
+
+	d := &audio.Driver{Source: src, Target: m}
+	err = d.Run(ctx)
+*/
+package audio
+
+import (
+	"context"
+	"io"
+	"math"
+	"time"
+
+	"github.com/LordAur/yeelight"
+)
+
+// Target is where the frames are sent, usually a *yeelight.Music.
+type Target interface {
+	SetScene(scene yeelight.Scene) error
+}
+
+/*
+Mapper turns audio features into a color and a brightness. The hue follows the spectral centroid, bass heavy sound
+is red and treble heavy sound is violet. The brightness follows the energy with an automatic gain and flashes on beats.
+The zero value is ready to use.
+*/
+type Mapper struct {
+	// Brightness range, default 1 ~ 100.
+	MinBrightness int
+	MaxBrightness int
+
+	// How much of the previous level is kept each frame, default 0.85. Lower values make a snappier lamp.
+	Decay float64
+
+	peak  float64
+	level float64
+}
+
+/*
+This function is used to map the features of one frame to a "hsv" scene.
+*/
+func (m *Mapper) Map(f Features) yeelight.Scene {
+	min, max := m.MinBrightness, m.MaxBrightness
+	if min == 0 {
+		min = 1
+	}
+
+	if max == 0 {
+		max = 100
+	}
+
+	decay := m.Decay
+	if decay == 0 {
+		decay = 0.85
+	}
+
+	// Automatic gain: the loudest recent frame is full brightness, it slowly forgets.
+	m.peak = math.Max(m.peak*0.995, f.Energy)
+
+	level := 0.0
+	if m.peak > 0 {
+		level = f.Energy / m.peak
+	}
+
+	if f.Beat {
+		level = 1
+	}
+
+	m.level = math.Max(level, m.level*decay)
+
+	hue := 0.0
+	if f.Centroid > 0 {
+		// 100 Hz is red, 5 kHz is violet, on a logarithmic scale.
+		hue = 300 * math.Log(f.Centroid/100) / math.Log(50)
+		hue = math.Max(0, math.Min(300, hue))
+	}
+
+	return yeelight.Scene{
+		Action:     "hsv",
+		Hue:        int(math.Round(hue)),
+		Saturation: 100,
+		Brightness: min + int(math.Round(float64(max-min)*m.level)),
+	}
+}
+
+/*
+Driver reads a source, analyzes it and sends one scene per frame to the target.
+*/
+type Driver struct {
+	Source Source
+	Target Target
+
+	// Frames per second, default 20.
+	FPS int
+
+	Analyzer Analyzer
+	Mapper   Mapper
+
+	// Called for every frame after it was sent, useful for a level meter or for tests.
+	OnFrame func(f Features, scene yeelight.Scene)
+}
+
+/*
+This function is used to run the driver until the source is drained or the context is cancelled.
+A drained source returns nil.
+*/
+func (d *Driver) Run(ctx context.Context) error {
+	fps := d.FPS
+	if fps <= 0 {
+		fps = 20
+	}
+
+	rate := d.Source.SampleRate()
+	size := rate / fps
+	if size < 1 {
+		size = 1
+	}
+
+	ticker := time.NewTicker(time.Second / time.Duration(fps))
+	defer ticker.Stop()
+
+	buf := make([]float64, size)
+	for {
+		n, err := fill(d.Source, buf)
+		if n > 0 {
+			f := d.Analyzer.Analyze(buf[:n], rate)
+			scene := d.Mapper.Map(f)
+
+			if err := d.Target.SetScene(scene); err != nil {
+				return err
+			}
+
+			if d.OnFrame != nil {
+				d.OnFrame(f, scene)
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func fill(src Source, buf []float64) (int, error) {
+	total := 0
+	for total < len(buf) {
+		n, err := src.Read(buf[total:])
+		total += n
+
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
@@ -0,0 +1,187 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Source gives mono samples in range -1 ~ 1.
+type Source interface {
+	SampleRate() int
+	Read(buf []float64) (int, error)
+}
+
+const (
+	formatPCM        = 1
+	formatFloat      = 3
+	formatExtensible = 0xFFFE
+)
+
+type pcm struct {
+	r          io.Reader
+	sampleRate int
+	channels   int
+	bits       int
+	float      bool
+	buf        []byte
+}
+
+/*
+This function is used to read a WAV file. 8, 16, 24 and 32 bit integer PCM and 32 bit float are supported,
+multiple channels are mixed down to mono.
+*/
+func ReadWAV(r io.Reader) (Source, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil, errors.New("not a WAV file")
+	}
+
+	var p *pcm
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, fmt.Errorf("WAV file has no data chunk: %w", err)
+		}
+
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			body := make([]byte, size)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return nil, err
+			}
+
+			if size < 16 {
+				return nil, errors.New("WAV fmt chunk is too short")
+			}
+
+			format := binary.LittleEndian.Uint16(body[0:2])
+			if format == formatExtensible && size >= 26 {
+				format = binary.LittleEndian.Uint16(body[24:26])
+			}
+
+			p = &pcm{
+				sampleRate: int(binary.LittleEndian.Uint32(body[4:8])),
+				channels:   int(binary.LittleEndian.Uint16(body[2:4])),
+				bits:       int(binary.LittleEndian.Uint16(body[14:16])),
+				float:      format == formatFloat,
+			}
+
+			if format != formatPCM && format != formatFloat {
+				return nil, fmt.Errorf("WAV format %d is not supported", format)
+			}
+
+			if err := p.check(); err != nil {
+				return nil, err
+			}
+		case "data":
+			if p == nil {
+				return nil, errors.New("WAV data chunk comes before fmt chunk")
+			}
+
+			p.r = io.LimitReader(r, size)
+
+			return p, nil
+		default:
+			// Chunks are padded to an even size.
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+/*
+This function is used to read raw signed 16 bit little endian PCM, for example from stdin:
+
+	arecord -f S16_LE -r 44100 -c 2 | myapp
+*/
+func NewRaw(r io.Reader, sampleRate, channels int) (Source, error) {
+	p := &pcm{
+		r:          r,
+		sampleRate: sampleRate,
+		channels:   channels,
+		bits:       16,
+	}
+
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *pcm) check() error {
+	if p.sampleRate <= 0 || p.channels <= 0 {
+		return errors.New("sample rate and channels should be more than 0")
+	}
+
+	if p.float && p.bits != 32 {
+		return fmt.Errorf("%d bit float samples are not supported", p.bits)
+	}
+
+	if p.bits != 8 && p.bits != 16 && p.bits != 24 && p.bits != 32 {
+		return fmt.Errorf("%d bit samples are not supported", p.bits)
+	}
+
+	return nil
+}
+
+func (p *pcm) SampleRate() int {
+	return p.sampleRate
+}
+
+func (p *pcm) Read(buf []float64) (int, error) {
+	width := p.bits / 8
+	frame := width * p.channels
+
+	if cap(p.buf) < len(buf)*frame {
+		p.buf = make([]byte, len(buf)*frame)
+	}
+
+	n, err := io.ReadFull(p.r, p.buf[:len(buf)*frame])
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+
+	frames := n / frame
+	if frames == 0 && err == nil {
+		err = io.EOF
+	}
+
+	for i := 0; i < frames; i++ {
+		var sum float64
+		for ch := 0; ch < p.channels; ch++ {
+			sum += p.sample(p.buf[i*frame+ch*width:])
+		}
+
+		buf[i] = sum / float64(p.channels)
+	}
+
+	return frames, err
+}
+
+func (p *pcm) sample(b []byte) float64 {
+	switch {
+	case p.float:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	case p.bits == 8:
+		return (float64(b[0]) - 128) / 128
+	case p.bits == 16:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / 32768
+	case p.bits == 24:
+		v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+		return float64(v) / 8388608
+	default:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / 2147483648
+	}
+}
@@ -0,0 +1,99 @@
+package yeelight
+
+import "math"
+
+/*
+BrightnessScale maps the brightness you ask for to the value the device gets. The device output is about linear
+in light, so low values jump visibly and the top half looks the same. Set Config.BrightnessScale to use a perceptual
+scale where 50 looks like half brightness.
+
+Example:
+
+	y := yeelight.New(&yeelight.Config{
+		IpAddress:       "192.168.0.0",
+		Port:            55443,
+		BrightnessScale: yeelight.CIELightness{},
+	})
+*/
+type BrightnessScale interface {
+	// ToDevice maps a perceived brightness 1 ~ 100 to a device brightness 1 ~ 100.
+	ToDevice(brightness int) int
+
+	// FromDevice maps a device brightness 1 ~ 100 back to a perceived brightness 1 ~ 100.
+	FromDevice(brightness int) int
+}
+
+// Gamma is a power curve, the device gets 100 * (brightness / 100) ^ gamma. 2.2 is a common choice.
+type Gamma float64
+
+func (g Gamma) ToDevice(brightness int) int {
+	return scaled(math.Pow(float64(brightness)/100, float64(g)))
+}
+
+func (g Gamma) FromDevice(brightness int) int {
+	return scaled(math.Pow(float64(brightness)/100, 1/float64(g)))
+}
+
+// CIELightness uses the CIE 1976 L* lightness, brightness is taken as L* and the device gets the matching luminance.
+type CIELightness struct{}
+
+func (CIELightness) ToDevice(brightness int) int {
+	l := float64(brightness)
+	if l > 8 {
+		return scaled(math.Pow((l+16)/116, 3))
+	}
+
+	return scaled(l / 903.3)
+}
+
+func (CIELightness) FromDevice(brightness int) int {
+	y := float64(brightness) / 100
+	if y > 216.0/24389 {
+		return int(math.Round(clampFloat(116*math.Cbrt(y)-16, 1, 100)))
+	}
+
+	return int(math.Round(clampFloat(903.3*y, 1, 100)))
+}
+
+// scaled turns a fraction into a brightness, never below 1 so the lamp doesn't look switched off.
+func scaled(f float64) int {
+	return int(math.Round(clampFloat(f*100, 1, 100)))
+}
+
+func clampFloat(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, v))
+}
+
+func deviceBrightness(scale BrightnessScale, brightness int) int {
+	if scale == nil {
+		return brightness
+	}
+
+	if brightness < 1 {
+		brightness = 1
+	}
+
+	if brightness > 100 {
+		brightness = 100
+	}
+
+	return scale.ToDevice(brightness)
+}
+
+// userBrightness maps a device brightness back to a perceived one, preferring one that ToDevice maps back exactly.
+func userBrightness(scale BrightnessScale, brightness int) int {
+	brightness = max(1, min(100, brightness))
+	if scale == nil {
+		return brightness
+	}
+
+	// Rounding in FromDevice may miss the exact one by a step.
+	user := scale.FromDevice(brightness)
+	for _, candidate := range []int{user, user - 1, user + 1} {
+		if candidate >= 1 && candidate <= 100 && scale.ToDevice(candidate) == brightness {
+			return candidate
+		}
+	}
+
+	return user
+}
@@ -0,0 +1,303 @@
+package yeelight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The properties read to seed the cache, unsupported ones come back empty and are left out.
+var cachedProps = []interface{}{
+	"power", "bright", "ct", "rgb", "hue", "sat", "color_mode", "flowing", "delayoff", "flow_params", "music_on", "name",
+	"bg_power", "bg_flowing", "bg_flow_params", "bg_ct", "bg_lmode", "bg_bright", "bg_rgb", "bg_hue", "bg_sat",
+	"nl_br", "active_mode",
+}
+
+/*
+Properties is the cached state of a device, values are keyed and formatted like the answer of "get_prop".
+The pseudo property "online" is "true" while the connection to the device is up and "false" once it was lost.
+Updated is when a value last changed or was confirmed, use it to judge how stale the state may be.
+*/
+type Properties struct {
+	Values  map[string]string `json:"values"`
+	Updated time.Time         `json:"updated"`
+}
+
+/*
+This function is used to read a property, empty when the device did not report it.
+*/
+func (p Properties) Get(name string) string {
+	return p.Values[name]
+}
+
+/*
+This function is used to read a numeric property like "bright" or "ct".
+*/
+func (p Properties) Int(name string) (int, error) {
+	v, ok := p.Values[name]
+	if !ok {
+		return 0, fmt.Errorf("property %s is unknown", name)
+	}
+
+	return strconv.Atoi(v)
+}
+
+/*
+This function is used to get how long ago the state was last updated.
+*/
+func (p Properties) Age() time.Duration {
+	return time.Since(p.Updated)
+}
+
+type propCache struct {
+	seeded  bool
+	values  map[string]string
+	updated time.Time
+}
+
+// remember stores values in the cache and tells the subscribers what changed. The lock must be held.
+func (c *Conn) remember(values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+
+	if c.cache.values == nil {
+		c.cache.values = map[string]string{}
+	}
+
+	now := time.Now()
+
+	// A value seen for the first time is not a change, there is nothing to compare it to.
+	var changes []Change
+	for k, v := range values {
+		if old, ok := c.cache.values[k]; ok && old != v {
+			changes = append(changes, Change{Property: k, Old: old, New: v, Time: now})
+		}
+
+		c.cache.values[k] = v
+	}
+
+	c.cache.updated = now
+
+	if len(changes) == 0 {
+		return
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Property < changes[j].Property
+	})
+
+	for s := range c.subs {
+		if s.changed != nil && !s.changed(changes) {
+			delete(c.subs, s)
+			s.end()
+		}
+	}
+}
+
+// learn updates the cache with the effect of a successful call. The lock must be held.
+func (c *Conn) learn(method string, params []interface{}, r Response) {
+	arg := func(i int) string {
+		if i >= len(params) {
+			return ""
+		}
+
+		return propString(params[i])
+	}
+
+	if method == "get_prop" {
+		if len(r.Result) != len(params) {
+			return
+		}
+
+		values := map[string]string{}
+		for i := range params {
+			if v := propString(r.Result[i]); v != "" {
+				values[arg(i)] = v
+			}
+		}
+
+		c.remember(values)
+
+		return
+	}
+
+	if len(r.Result) == 0 || propString(r.Result[0]) != "ok" {
+		return
+	}
+
+	prefix := ""
+	if strings.HasPrefix(method, "bg_") {
+		prefix, method = "bg_", strings.TrimPrefix(method, "bg_")
+	}
+
+	mode := "color_mode"
+	if prefix != "" {
+		mode = "lmode"
+	}
+
+	values := map[string]string{}
+	switch method {
+	case "set_power":
+		values["power"] = arg(0)
+	case "toggle":
+		if power, ok := c.cache.values[prefix+"power"]; ok {
+			values["power"] = map[string]string{"on": "off", "off": "on"}[power]
+		}
+	case "set_bright":
+		values["bright"] = arg(0)
+	case "set_ct_abx":
+		values["ct"], values[mode] = arg(0), "2"
+	case "set_rgb":
+		values["rgb"], values[mode] = arg(0), "1"
+	case "set_hsv":
+		values["hue"], values["sat"], values[mode] = arg(0), arg(1), "3"
+	case "start_cf":
+		values["flowing"] = "1"
+	case "stop_cf":
+		values["flowing"] = "0"
+	case "set_name":
+		values["name"] = arg(0)
+	case "set_scene":
+		values["power"] = "on"
+
+		switch arg(0) {
+		case "color":
+			values["rgb"], values["bright"], values[mode] = arg(1), arg(2), "1"
+		case "hsv":
+			values["hue"], values["sat"], values["bright"], values[mode] = arg(1), arg(2), arg(3), "3"
+		case "ct":
+			values["ct"], values["bright"], values[mode] = arg(1), arg(2), "2"
+		case "cf":
+			values["flowing"] = "1"
+		case "auto_delay_off":
+			values["bright"], values["delayoff"] = arg(1), arg(2)
+		}
+	}
+
+	prefixed := map[string]string{}
+	for k, v := range values {
+		if v != "" {
+			prefixed[prefix+k] = v
+		}
+	}
+
+	c.remember(prefixed)
+}
+
+// propString formats a param or a property value like the device does in "get_prop".
+func propString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.RawMessage:
+		var s string
+		if json.Unmarshal(v, &s) == nil {
+			return s
+		}
+
+		return string(v)
+	case nil:
+		return ""
+	}
+
+	return fmt.Sprint(v)
+}
+
+/*
+This function is used to read the cached state of the device without a round trip. The first read seeds the cache
+with one "get_prop", after that it is kept current by notifications and by the successful commands sent through
+this device's connection, from any Config or proxy client sharing it.
+*/
+func (c *Config) Properties() (Properties, error) {
+	if c.conn == nil {
+		return Properties{}, fmt.Errorf("not connected")
+	}
+
+	c.conn.mu.Lock()
+	seeded := c.conn.cache.seeded
+	c.conn.mu.Unlock()
+
+	if !seeded {
+		if err := c.Refresh(); err != nil {
+			return Properties{}, err
+		}
+	}
+
+	p, _ := c.Cached()
+
+	return p, nil
+}
+
+/*
+This function is used to read the cached state as it is, it never sends a request. False means the cache was not
+seeded yet and holds only what was learned so far.
+*/
+func (c *Config) Cached() (Properties, bool) {
+	if c.conn == nil {
+		return Properties{}, false
+	}
+
+	c.conn.mu.Lock()
+	defer c.conn.mu.Unlock()
+
+	p := Properties{
+		Values:  make(map[string]string, len(c.conn.cache.values)),
+		Updated: c.conn.cache.updated,
+	}
+
+	for k, v := range c.conn.cache.values {
+		p.Values[k] = v
+	}
+
+	return p, c.conn.cache.seeded
+}
+
+/*
+This function is used to read the whole state again with one "get_prop", for example after the connection was lost
+and notifications may have been missed.
+*/
+func (c *Config) Refresh() error {
+	r, err := c.GetProps(cachedProps...)
+	if err != nil {
+		return err
+	}
+
+	if r.Error != nil {
+		return r.Error
+	}
+
+	if len(r.Result) != len(cachedProps) {
+		return fmt.Errorf("device returned %d properties, expected %d", len(r.Result), len(cachedProps))
+	}
+
+	c.conn.mu.Lock()
+	c.conn.cache.seeded = true
+	c.conn.cache.updated = time.Now()
+	c.conn.mu.Unlock()
+
+	return nil
+}
+
+/*
+This function is used to refresh the cache every "interval" until the context is cancelled.
+A failed refresh is tried again at the next interval.
+*/
+func (c *Config) RefreshEvery(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c.Refresh()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
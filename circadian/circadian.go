@@ -0,0 +1,319 @@
+/*
+Package circadian keeps Yeelight lamps following the sun. Color temperature and brightness are computed locally
+from latitude, longitude and the current time, no web service is needed.
+
+Example:
+
+	c := &circadian.Controller{
+		Lamps:     []*yeelight.Config{&y},
+		Latitude:  -6.2,
+		Longitude: 106.8,
+	}
+
+	err := c.Run(ctx)
+*/
+package circadian
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/LordAur/yeelight"
+)
+
+// Curve maps the sun elevation in degrees to a factor in range 0 ~ 1.
+type Curve func(elevation float64) float64
+
+/*
+This function is used to build a curve that stays 0 below "low" degrees, 1 above "high" degrees
+and eases smoothly in between.
+*/
+func Ramp(low, high float64) Curve {
+	return func(elevation float64) float64 {
+		if elevation <= low {
+			return 0
+		}
+
+		if elevation >= high {
+			return 1
+		}
+
+		x := (elevation - low) / (high - low)
+
+		return x * x * (3 - 2*x)
+	}
+}
+
+// DefaultCurve starts rising at civil twilight and reaches full daylight when the sun is 20° high.
+var DefaultCurve = Ramp(-6, 20)
+
+type Controller struct {
+	Lamps     []*yeelight.Config
+	Latitude  float64
+	Longitude float64
+
+	// Color temperature range in Kelvin, default 2200 ~ 6000. Clamped to the device range 1700 ~ 6500.
+	MinKelvin int
+	MaxKelvin int
+
+	// Brightness range, default 10 ~ 100.
+	MinBrightness int
+	MaxBrightness int
+
+	// Curves used for the temperature and the brightness, default DefaultCurve.
+	TemperatureCurve Curve
+	BrightnessCurve  Curve
+
+	// How often the lamps are updated, default 1 minute. Every update uses a smooth transition of the same length.
+	Interval time.Duration
+
+	// How long a lamp is left alone after somebody changed it by hand. Zero means until Resume is called.
+	PauseFor time.Duration
+
+	// Called when a lamp could not be updated or watched. The controller keeps running.
+	OnError func(lamp *yeelight.Config, err error)
+
+	mu    sync.Mutex
+	lamps map[*yeelight.Config]*lampState
+}
+
+type lampState struct {
+	ct          int
+	bright      int
+	pausedUntil time.Time
+}
+
+/*
+This function is used to compute the color temperature and brightness the lamps should have at the given time.
+*/
+func (c *Controller) Target(t time.Time) (temp int, brightness int) {
+	s := c.settings()
+	e := Elevation(t, c.Latitude, c.Longitude)
+
+	temp = s.minKelvin + int(math.Round(float64(s.maxKelvin-s.minKelvin)*s.temperatureCurve(e)))
+	brightness = s.minBrightness + int(math.Round(float64(s.maxBrightness-s.minBrightness)*s.brightnessCurve(e)))
+
+	return temp, brightness
+}
+
+/*
+This function is used to run the controller until the context is cancelled.
+Every lamp is watched for notifications, a lamp changed by hand is paused and left untouched.
+*/
+func (c *Controller) Run(ctx context.Context) error {
+	for _, lamp := range c.Lamps {
+		go c.watch(ctx, lamp)
+	}
+
+	ticker := time.NewTicker(c.settings().interval)
+	defer ticker.Stop()
+
+	c.apply(time.Now())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			c.apply(now)
+		}
+	}
+}
+
+/*
+This function is used to pause a lamp, the controller won't change it until PauseFor is elapsed or Resume is called.
+*/
+func (c *Controller) Pause(lamp *yeelight.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.state(lamp)
+	if c.PauseFor > 0 {
+		s.pausedUntil = time.Now().Add(c.PauseFor)
+	} else {
+		s.pausedUntil = time.Unix(math.MaxInt32, 0)
+	}
+}
+
+/*
+This function is used to give a paused lamp back to the controller. It is updated on the next interval.
+*/
+func (c *Controller) Resume(lamp *yeelight.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state(lamp).pausedUntil = time.Time{}
+}
+
+/*
+This function is used to check whether a lamp is paused.
+*/
+func (c *Controller) Paused(lamp *yeelight.Config) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return time.Now().Before(c.state(lamp).pausedUntil)
+}
+
+func (c *Controller) apply(now time.Time) {
+	temp, brightness := c.Target(now)
+	duration := int(c.settings().interval / time.Millisecond)
+
+	for _, lamp := range c.Lamps {
+		if c.Paused(lamp) {
+			continue
+		}
+
+		// Remember what we asked for before sending, the notification can arrive before the response.
+		c.mu.Lock()
+		s := c.state(lamp)
+		s.ct, s.bright = temp, brightness
+		if lamp.BrightnessScale != nil {
+			s.bright = lamp.BrightnessScale.ToDevice(brightness)
+		}
+		c.mu.Unlock()
+
+		if _, err := lamp.SetColorTemp(temp, "smooth", duration); err != nil {
+			c.fail(lamp, err)
+			continue
+		}
+
+		if _, err := lamp.SetBright(brightness, "smooth", duration); err != nil {
+			c.fail(lamp, err)
+		}
+	}
+}
+
+func (c *Controller) watch(ctx context.Context, lamp *yeelight.Config) {
+	notifications, stop := lamp.Notifications()
+	defer stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-notifications:
+			if !ok {
+				return
+			}
+
+			if c.manual(lamp, msg) {
+				c.Pause(lamp)
+			}
+		}
+	}
+}
+
+// manual reports whether a notification shows a change the controller did not ask for.
+func (c *Controller) manual(lamp *yeelight.Config, msg yeelight.ListenResponse) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.state(lamp)
+	p := msg.Params
+
+	if p.ColorMode != 0 && p.ColorMode != 2 {
+		return true
+	}
+
+	if p.ColorTemperature != 0 && p.ColorTemperature != s.ct {
+		return true
+	}
+
+	if p.Brightness != 0 && p.Brightness != s.bright {
+		return true
+	}
+
+	return false
+}
+
+func (c *Controller) fail(lamp *yeelight.Config, err error) {
+	if c.OnError != nil {
+		c.OnError(lamp, err)
+	}
+}
+
+func (c *Controller) state(lamp *yeelight.Config) *lampState {
+	if c.lamps == nil {
+		c.lamps = map[*yeelight.Config]*lampState{}
+	}
+
+	s, ok := c.lamps[lamp]
+	if !ok {
+		s = &lampState{}
+		c.lamps[lamp] = s
+	}
+
+	return s
+}
+
+// settings are the fields of a controller with the defaults applied, they are read and never written.
+type settings struct {
+	minKelvin, maxKelvin         int
+	minBrightness, maxBrightness int
+	temperatureCurve             Curve
+	brightnessCurve              Curve
+	interval                     time.Duration
+}
+
+func (c *Controller) settings() settings {
+	s := settings{
+		minKelvin:        c.MinKelvin,
+		maxKelvin:        c.MaxKelvin,
+		minBrightness:    c.MinBrightness,
+		maxBrightness:    c.MaxBrightness,
+		temperatureCurve: c.TemperatureCurve,
+		brightnessCurve:  c.BrightnessCurve,
+		interval:         c.Interval,
+	}
+
+	if s.minKelvin == 0 {
+		s.minKelvin = 2200
+	}
+
+	if s.maxKelvin == 0 {
+		s.maxKelvin = 6000
+	}
+
+	s.minKelvin = clamp(s.minKelvin, 1700, 6500)
+	s.maxKelvin = clamp(s.maxKelvin, s.minKelvin, 6500)
+
+	if s.minBrightness == 0 {
+		s.minBrightness = 10
+	}
+
+	if s.maxBrightness == 0 {
+		s.maxBrightness = 100
+	}
+
+	s.minBrightness = clamp(s.minBrightness, 1, 100)
+	s.maxBrightness = clamp(s.maxBrightness, s.minBrightness, 100)
+
+	if s.temperatureCurve == nil {
+		s.temperatureCurve = DefaultCurve
+	}
+
+	if s.brightnessCurve == nil {
+		s.brightnessCurve = DefaultCurve
+	}
+
+	if s.interval <= 0 {
+		s.interval = time.Minute
+	}
+
+	return s
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+
+	if v > max {
+		return max
+	}
+
+	return v
+}
@@ -0,0 +1,89 @@
+package circadian
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	degToRad = math.Pi / 180
+	radToDeg = 180 / math.Pi
+
+	// Apparent altitude of the sun's upper limb at sunrise and sunset, corrected for refraction.
+	horizon = -0.833
+)
+
+/*
+This function is used to compute the sun elevation in degrees above the horizon for the given time and position.
+The calculation is done locally with the low precision formulas from the Astronomical Almanac, accurate to about 0.01°.
+"lat" and "lon" are in degrees, north and east are positive.
+*/
+func Elevation(t time.Time, lat, lon float64) float64 {
+	n := julianDay(t) - 2451545.0
+
+	// Mean longitude and mean anomaly of the sun.
+	l := math.Mod(280.460+0.9856474*n, 360)
+	g := math.Mod(357.528+0.9856003*n, 360) * degToRad
+
+	// Ecliptic longitude and obliquity of the ecliptic.
+	lambda := (l + 1.915*math.Sin(g) + 0.020*math.Sin(2*g)) * degToRad
+	epsilon := (23.439 - 0.0000004*n) * degToRad
+
+	ra := math.Atan2(math.Cos(epsilon)*math.Sin(lambda), math.Cos(lambda))
+	dec := math.Asin(math.Sin(epsilon) * math.Sin(lambda))
+
+	gmst := math.Mod(280.46061837+360.98564736629*n, 360)
+	ha := (gmst+lon)*degToRad - ra
+
+	phi := lat * degToRad
+	sinAlt := math.Sin(phi)*math.Sin(dec) + math.Cos(phi)*math.Cos(dec)*math.Cos(ha)
+
+	return math.Asin(sinAlt) * radToDeg
+}
+
+/*
+This function is used to find sunrise and sunset of the day containing t, in t's location.
+"ok" is false when the sun does not cross the horizon that day (polar day or polar night).
+*/
+func SunTimes(t time.Time, lat, lon float64) (sunrise, sunset time.Time, ok bool) {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	step := 10 * time.Minute
+
+	prev := Elevation(start, lat, lon) - horizon
+	for at := start.Add(step); at.Sub(start) <= 24*time.Hour; at = at.Add(step) {
+		cur := Elevation(at, lat, lon) - horizon
+
+		if prev < 0 && cur >= 0 && sunrise.IsZero() {
+			sunrise = crossing(at.Add(-step), at, lat, lon)
+		}
+
+		if prev >= 0 && cur < 0 && sunset.IsZero() {
+			sunset = crossing(at.Add(-step), at, lat, lon)
+		}
+
+		prev = cur
+	}
+
+	return sunrise, sunset, !sunrise.IsZero() && !sunset.IsZero()
+}
+
+// crossing narrows down the moment between a and b where the sun passes the horizon.
+func crossing(a, b time.Time, lat, lon float64) time.Time {
+	rising := Elevation(a, lat, lon) < horizon
+
+	for b.Sub(a) > time.Second {
+		mid := a.Add(b.Sub(a) / 2)
+
+		if (Elevation(mid, lat, lon) < horizon) == rising {
+			a = mid
+		} else {
+			b = mid
+		}
+	}
+
+	return a.Round(time.Second)
+}
+
+func julianDay(t time.Time) float64 {
+	return float64(t.UTC().UnixNano())/float64(24*time.Hour) + 2440587.5
+}
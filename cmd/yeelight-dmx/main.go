@@ -0,0 +1,150 @@
+/*
+Command yeelight-dmx drives bulbs from a lighting console over sACN (E1.31) or Art-Net. Every bulb is patched to
+channels of a universe and runs in music mode while the command runs.
+
+Usage:
+
+	yeelight-dmx [-sacn] [-unicast] [-artnet] universe/address:mode=bulb[:port] ...
+
+Modes are dimmer (1 channel), rgb (3), drgb (dimmer, red, green, blue) and dct (dimmer, color temperature).
+
+Example:
+
+	yeelight-dmx -artnet 1/1:drgb=192.168.1.239 1/5:dct=192.168.1.240
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/dmx"
+)
+
+var modes = map[string]dmx.Mode{
+	"dimmer": dmx.Dimmer,
+	"rgb":    dmx.RGB,
+	"drgb":   dmx.DimmerRGB,
+	"dct":    dmx.DimmerCT,
+}
+
+func main() {
+	sacn := flag.Bool("sacn", true, "receive multicast sACN of the patched universes")
+	unicast := flag.Bool("unicast", false, "receive sACN sent to this host instead of multicast")
+	artnet := flag.Bool("artnet", false, "receive Art-Net")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] universe/address:mode=bulb[:port] ...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var patches []dmx.Patch
+	universes := map[int]bool{}
+
+	for _, arg := range flag.Args() {
+		p, bulb, err := parsePatch(arg)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ip, port := bulb, 55443
+		if h, ps, err := net.SplitHostPort(bulb); err == nil {
+			ip = h
+			if port, err = strconv.Atoi(ps); err != nil {
+				log.Fatalf("%q: %v", arg, err)
+			}
+		}
+
+		y := yeelight.New(&yeelight.Config{IpAddress: ip, Port: port})
+
+		m, err := y.StartMusic()
+		if err != nil {
+			log.Fatalf("%s: %v", bulb, err)
+		}
+		defer m.Close()
+
+		p.Lamp = m
+		patches = append(patches, p)
+		universes[p.Universe] = true
+	}
+
+	var conns []net.PacketConn
+
+	if *sacn && *unicast {
+		conn, err := net.ListenPacket("udp4", fmt.Sprintf(":%d", dmx.SACNPort))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		conns = append(conns, conn)
+	} else if *sacn {
+		var list []int
+		for u := range universes {
+			list = append(list, u)
+		}
+
+		multicast, err := dmx.ListenSACN(nil, list...)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		conns = append(conns, multicast...)
+	}
+
+	if *artnet {
+		conn, err := dmx.ListenArtNet()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		conns = append(conns, conn)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	r := &dmx.Receiver{Patches: patches}
+	if err := r.Serve(ctx, conns...); err != nil && ctx.Err() == nil {
+		log.Print(err)
+	}
+}
+
+// parsePatch reads universe/address:mode=bulb.
+func parsePatch(arg string) (dmx.Patch, string, error) {
+	channels, bulb, ok := strings.Cut(arg, "=")
+	if !ok {
+		return dmx.Patch{}, "", fmt.Errorf("%q should be universe/address:mode=bulb[:port]", arg)
+	}
+
+	position, name, ok := strings.Cut(channels, ":")
+	if !ok {
+		return dmx.Patch{}, "", fmt.Errorf("%q has no mode", arg)
+	}
+
+	mode, ok := modes[name]
+	if !ok {
+		return dmx.Patch{}, "", fmt.Errorf("%q: mode should be dimmer, rgb, drgb or dct", arg)
+	}
+
+	u, a, ok := strings.Cut(position, "/")
+	universe, err1 := strconv.Atoi(u)
+	address, err2 := strconv.Atoi(a)
+	if !ok || err1 != nil || err2 != nil || address < 1 || address > 512 {
+		return dmx.Patch{}, "", fmt.Errorf("%q: expected universe/address with address 1 ~ 512", arg)
+	}
+
+	return dmx.Patch{Universe: universe, Address: address, Mode: mode}, bulb, nil
+}
@@ -0,0 +1,78 @@
+/*
+Command yeelight-grpc serves the lamps of the LAN as the gRPC service of grpc/yeelight.proto. Lamps are discovered
+continuously and remembered in the registry file. The service is plain text HTTP/2, or TLS with -cert and -key.
+
+Usage:
+
+	yeelight-grpc [-listen :50051] [-registry devices.json] [-search 1m] [-cert cert.pem -key key.pem]
+
+Example:
+
+	grpcurl -plaintext -import-path grpc -proto yeelight.proto -d '{"device": "desk", "on": true}' \
+		localhost:50051 yeelight.v1.Yeelight/SetPower
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/grpc"
+)
+
+func main() {
+	listen := flag.String("listen", ":50051", "address of the gRPC service")
+	registryPath := flag.String("registry", "", "file remembering discovered lamps")
+	interval := flag.Duration("search", time.Minute, "how often to search the LAN for lamps")
+	cert := flag.String("cert", "", "TLS certificate file")
+	key := flag.String("key", "", "TLS key file")
+	flag.Parse()
+
+	registry, err := yeelight.NewRegistry(*registryPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer registry.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	go func() {
+		if err := registry.Watch(ctx, *interval); err != nil && ctx.Err() == nil {
+			log.Printf("discovery: %v", err)
+		}
+	}()
+
+	var protocols http.Protocols
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	srv := &http.Server{
+		Addr:      *listen,
+		Handler:   &grpc.Server{Registry: registry},
+		Protocols: &protocols,
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+
+	log.Printf("listening on %s", *listen)
+
+	if *cert != "" {
+		err = srv.ListenAndServeTLS(*cert, *key)
+	} else {
+		err = srv.ListenAndServe()
+	}
+
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Command yeelight-hue makes the lamps of the LAN look like the lights of a Philips Hue bridge, for apps and remotes
+that only speak the Hue API. Most apps expect the bridge on port 80 and need its IP address entered by hand.
+
+Usage:
+
+	yeelight-hue [-listen :80] [-name Yeelight] [-registry devices.json] [-groups groups.json] [-search 1m]
+
+The groups file maps group names to device IDs:
+
+	{"living": ["0x000000000015243f", "0x0000000000152440"]}
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/hue"
+)
+
+func main() {
+	listen := flag.String("listen", ":80", "HTTP address")
+	name := flag.String("name", "Yeelight", "bridge name shown by apps")
+	registryPath := flag.String("registry", "", "file remembering discovered lamps")
+	groupsPath := flag.String("groups", "", "JSON file of group names to device IDs")
+	interval := flag.Duration("search", time.Minute, "how often to search the LAN for lamps")
+	flag.Parse()
+
+	var groups map[string][]string
+	if *groupsPath != "" {
+		data, err := os.ReadFile(*groupsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := json.Unmarshal(data, &groups); err != nil {
+			log.Fatalf("%s: %v", *groupsPath, err)
+		}
+	}
+
+	registry, err := yeelight.NewRegistry(*registryPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer registry.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	go func() {
+		if err := registry.Watch(ctx, *interval); err != nil && ctx.Err() == nil {
+			log.Printf("discovery: %v", err)
+		}
+	}()
+
+	srv := &http.Server{
+		Addr:    *listen,
+		Handler: &hue.Bridge{Registry: registry, Groups: groups, Name: *name},
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+
+	log.Printf("listening on %s", *listen)
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
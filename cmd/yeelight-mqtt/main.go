@@ -0,0 +1,86 @@
+/*
+Command yeelight-mqtt bridges the lamps of the LAN to an MQTT broker. Lamps are discovered continuously, their state
+is mirrored to retained topics and Home Assistant discovery makes them appear without configuration.
+
+Usage:
+
+	yeelight-mqtt [-broker localhost:1883] [-user name] [-password secret] [-prefix yeelight]
+		[-discovery homeassistant] [-registry devices.json] [-effects effects.json] [-search 1m]
+
+The effects file maps effect names to scenes:
+
+	{"movie": {"action": "ct", "ct": 2700, "bright": 20}}
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/mqtt"
+)
+
+func main() {
+	broker := flag.String("broker", "localhost:1883", "MQTT broker address")
+	user := flag.String("user", "", "MQTT user name")
+	password := flag.String("password", os.Getenv("MQTT_PASSWORD"), "MQTT password, default $MQTT_PASSWORD")
+	prefix := flag.String("prefix", "yeelight", "root of the lamp topics")
+	discovery := flag.String("discovery", "homeassistant", `root of the Home Assistant discovery topics, "-" disables it`)
+	registryPath := flag.String("registry", "", "file remembering discovered lamps")
+	effectsPath := flag.String("effects", "", "JSON file of effect names to scenes")
+	interval := flag.Duration("search", time.Minute, "how often to search the LAN for lamps")
+	flag.Parse()
+
+	var effects map[string]yeelight.Scene
+	if *effectsPath != "" {
+		data, err := os.ReadFile(*effectsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := json.Unmarshal(data, &effects); err != nil {
+			log.Fatalf("%s: %v", *effectsPath, err)
+		}
+
+		for name, scene := range effects {
+			if err := yeelight.ValidateScene(scene); err != nil {
+				log.Fatalf("%s: effect %s: %v", *effectsPath, name, err)
+			}
+		}
+	}
+
+	registry, err := yeelight.NewRegistry(*registryPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer registry.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	go func() {
+		if err := registry.Watch(ctx, *interval); err != nil && ctx.Err() == nil {
+			log.Printf("discovery: %v", err)
+		}
+	}()
+
+	b := &mqtt.Bridge{
+		Registry:        registry,
+		Options:         mqtt.Options{Broker: *broker, Username: *user, Password: *password},
+		Prefix:          *prefix,
+		DiscoveryPrefix: *discovery,
+		Effects:         effects,
+	}
+
+	log.Printf("bridging to %s", *broker)
+
+	if err := b.Run(ctx); err != nil && ctx.Err() == nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Command yeelight-proxy lets several applications share the same bulbs. Every bulb gets a local port speaking the
+bulb's own protocol, the proxy holds one connection to the bulb and a rate budget shared by all clients.
+
+Usage:
+
+	yeelight-proxy [-listen 127.0.0.1] [-rate 60] port=bulb[:port] ...
+
+Example:
+
+	yeelight-proxy 55443=192.168.1.239 55444=192.168.1.240:55443
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/LordAur/yeelight"
+)
+
+func main() {
+	host := flag.String("listen", "127.0.0.1", "local address to listen on")
+	rate := flag.Int("rate", 60, "commands per minute for all clients of a bulb")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] port=bulb[:port] ...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	for _, arg := range flag.Args() {
+		port, bulb, ok := strings.Cut(arg, "=")
+		if !ok {
+			log.Fatalf("%q should be port=bulb[:port]", arg)
+		}
+
+		ip, bulbPort := bulb, 55443
+		if h, p, err := net.SplitHostPort(bulb); err == nil {
+			ip = h
+			if bulbPort, err = strconv.Atoi(p); err != nil {
+				log.Fatalf("%q: %v", arg, err)
+			}
+		}
+
+		listener, err := net.Listen("tcp", net.JoinHostPort(*host, port))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		y := yeelight.New(&yeelight.Config{IpAddress: ip, Port: bulbPort})
+		p := &yeelight.Proxy{Config: &y, Rate: *rate}
+
+		log.Printf("%s proxies %s", listener.Addr(), net.JoinHostPort(ip, strconv.Itoa(bulbPort)))
+
+		go func() {
+			log.Fatal(p.Serve(listener))
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	<-signals
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/LordAur/yeelight"
+)
+
+type command struct {
+	usage string
+	run   func(e *env, args []string) error
+}
+
+var order = []string{
+	"discover", "props", "on", "off", "toggle", "bright", "ct", "rgb", "hex", "hsv",
+	"flow", "scene", "timer", "rename", "watch",
+}
+
+var commands = map[string]command{
+	"discover": {"list the lamps on the LAN", discover},
+	"props":    {"[name...]  show properties, all common ones by default", props},
+	"on":       {"switch on", power(true)},
+	"off":      {"switch off", power(false)},
+	"toggle":   {"switch on when off and off when on", toggle},
+	"bright":   {"<1-100>  set the brightness", bright},
+	"ct":       {"<1700-6500>  set the color temperature in kelvin", ct},
+	"rgb":      {"<red> <green> <blue>  set the color, each 0-255", rgb},
+	"hex":      {"<#rrggbb>  set the color", hex},
+	"hsv":      {"<hue 0-359> <saturation 0-100>  set the color", hsv},
+	"flow":     {"<file>  start a color flow from a JSON file", flow},
+	"scene":    {"<name | json>  apply a scene of -scenes or a scene given as JSON", scene},
+	"timer":    {"[minutes | off]  switch off after some minutes, show or cancel the timer", timer},
+	"rename":   {"<name>  change the name stored in the lamp", rename},
+	"watch":    {"[name...]  print property changes until interrupted", watch},
+}
+
+var commonProps = []string{
+	"power", "bright", "ct", "rgb", "hue", "sat", "color_mode", "flowing", "delayoff", "music_on", "name",
+}
+
+func ints(args []string, n int) ([]int, error) {
+	if len(args) != n {
+		return nil, fmt.Errorf("expected %d arguments, got %d", n, len(args))
+	}
+
+	values := make([]int, n)
+	for i, a := range args {
+		v, err := strconv.Atoi(a)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", a)
+		}
+
+		values[i] = v
+	}
+
+	return values, nil
+}
+
+func discover(e *env, args []string) error {
+	devices, err := e.search()
+	if err != nil {
+		return err
+	}
+
+	if e.json {
+		if devices == nil {
+			devices = []yeelight.Device{}
+		}
+
+		return e.print(devices, "")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tADDRESS\tMODEL\tNAME\tPOWER\tBRIGHT")
+	for _, d := range devices {
+		fmt.Fprintf(w, "%s\t%s:%d\t%s\t%s\t%s\t%d\n", d.ID, d.IpAddress, d.Port, d.Model, d.Name, d.Power, d.Brightness)
+	}
+
+	return w.Flush()
+}
+
+func props(e *env, args []string) error {
+	if len(args) == 0 {
+		args = commonProps
+	}
+
+	y, err := e.lamp()
+	if err != nil {
+		return err
+	}
+
+	names := make([]interface{}, len(args))
+	for i, a := range args {
+		names[i] = a
+	}
+
+	r, err := y.GetProps(names...)
+	if err != nil {
+		return err
+	}
+
+	if r.Error != nil {
+		return r.Error
+	}
+
+	values := map[string]string{}
+	var lines []string
+	for i, name := range args {
+		if i < len(r.Result) {
+			values[name] = fmt.Sprint(r.Result[i])
+			lines = append(lines, fmt.Sprintf("%s: %s", name, values[name]))
+		}
+	}
+
+	return e.print(values, strings.Join(lines, "\n"))
+}
+
+func power(on bool) func(e *env, args []string) error {
+	return func(e *env, args []string) error {
+		y, err := e.lamp()
+		if err != nil {
+			return err
+		}
+
+		effect, duration := e.effect()
+
+		return e.result(y.SetPower(on, effect, duration))
+	}
+}
+
+func toggle(e *env, args []string) error {
+	y, err := e.lamp()
+	if err != nil {
+		return err
+	}
+
+	return e.result(y.Toggle())
+}
+
+func bright(e *env, args []string) error {
+	v, err := ints(args, 1)
+	if err != nil {
+		return err
+	}
+
+	y, err := e.lamp()
+	if err != nil {
+		return err
+	}
+
+	effect, duration := e.effect()
+
+	return e.result(y.SetBright(v[0], effect, duration))
+}
+
+func ct(e *env, args []string) error {
+	v, err := ints(args, 1)
+	if err != nil {
+		return err
+	}
+
+	y, err := e.lamp()
+	if err != nil {
+		return err
+	}
+
+	effect, duration := e.effect()
+
+	return e.result(y.SetColorTemp(v[0], effect, duration))
+}
+
+func rgb(e *env, args []string) error {
+	v, err := ints(args, 3)
+	if err != nil {
+		return err
+	}
+
+	y, err := e.lamp()
+	if err != nil {
+		return err
+	}
+
+	effect, duration := e.effect()
+
+	return e.result(y.SetRGB(v[0], v[1], v[2], effect, duration))
+}
+
+func hex(e *env, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected a color like #ff8800")
+	}
+
+	s := strings.TrimPrefix(args[0], "#")
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil || len(s) != 6 {
+		return fmt.Errorf("%q is not a color like #ff8800", args[0])
+	}
+
+	return rgb(e, []string{strconv.Itoa(int(v >> 16)), strconv.Itoa(int(v >> 8 & 0xFF)), strconv.Itoa(int(v & 0xFF))})
+}
+
+func hsv(e *env, args []string) error {
+	v, err := ints(args, 2)
+	if err != nil {
+		return err
+	}
+
+	y, err := e.lamp()
+	if err != nil {
+		return err
+	}
+
+	effect, duration := e.effect()
+
+	return e.result(y.SetHueSaturation(v[0], v[1], effect, duration))
+}
+
+/*
+flow reads a file with the expressions of a flow, either only the list or with the count and the action:
+
+	{"count": 0, "action": 0, "flow": [{"duration": 1000, "mode": 1, "value": 16711680, "bright": 100}]}
+*/
+func flow(e *env, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected a flow file")
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	var f struct {
+		Count  int                       `json:"count"`
+		Action int                       `json:"action"`
+		Flow   []yeelight.FlowExpression `json:"flow"`
+	}
+
+	if err := json.Unmarshal(data, &f.Flow); err != nil {
+		if err := json.Unmarshal(data, &f); err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+	}
+
+	y, err := e.lamp()
+	if err != nil {
+		return err
+	}
+
+	return e.result(y.SetColorFlow(f.Count, f.Action, f.Flow))
+}
+
+func scene(e *env, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected a scene name or a scene as JSON")
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(args[0]), "{") {
+		var s yeelight.Scene
+		if err := json.Unmarshal([]byte(args[0]), &s); err != nil {
+			return err
+		}
+
+		if err := yeelight.ValidateScene(s); err != nil {
+			return err
+		}
+
+		y, err := e.lamp()
+		if err != nil {
+			return err
+		}
+
+		return e.result(y.SetScene(s))
+	}
+
+	if e.scenes == "" {
+		return fmt.Errorf("applying a scene by name needs -scenes")
+	}
+
+	// The targets of the library are device IDs, they are looked up on the LAN when not known yet.
+	if len(e.registry.Devices()) == 0 {
+		if _, err := e.search(); err != nil {
+			return err
+		}
+	}
+
+	lib, err := yeelight.LoadScenes(e.scenes, e.registry)
+	if err != nil {
+		return err
+	}
+
+	results, err := lib.Apply(args[0])
+	if err != nil && results == nil {
+		return err
+	}
+
+	type outcome struct {
+		IpAddress string `json:"ip_address"`
+		Status    string `json:"status"`
+	}
+
+	outcomes := make([]outcome, len(results))
+	lines := make([]string, len(results))
+	for i, r := range results {
+		outcomes[i] = outcome{r.Member.IpAddress, "ok"}
+		if r.Err != nil {
+			outcomes[i].Status = r.Err.Error()
+		}
+
+		lines[i] = fmt.Sprintf("%s: %s", outcomes[i].IpAddress, outcomes[i].Status)
+	}
+
+	if perr := e.print(outcomes, strings.Join(lines, "\n")); perr != nil {
+		return perr
+	}
+
+	return err
+}
+
+func timer(e *env, args []string) error {
+	y, err := e.lamp()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		r, err := y.CronGet()
+		if err != nil {
+			return err
+		}
+
+		if r.Error != nil {
+			return r.Error
+		}
+
+		if len(r.Result) == 0 {
+			return e.print(r, "no timer")
+		}
+
+		return e.print(r, fmt.Sprintf("%v", r.Result[0]))
+	}
+
+	if args[0] == "off" {
+		return e.result(y.CronDelete())
+	}
+
+	v, err := ints(args, 1)
+	if err != nil {
+		return err
+	}
+
+	return e.result(y.CronAdd(v[0]))
+}
+
+func rename(e *env, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected the new name")
+	}
+
+	y, err := e.lamp()
+	if err != nil {
+		return err
+	}
+
+	return e.result(y.SetName(args[0]))
+}
+
+func watch(e *env, args []string) error {
+	y, err := e.lamp()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	changes, err := y.SubscribeWith(ctx, yeelight.SubscribeOptions{Policy: yeelight.DropOldest}, args...)
+	if err != nil {
+		return err
+	}
+
+	for c := range changes {
+		text := fmt.Sprintf("%s %s %s -> %s", c.Time.Format("15:04:05"), c.Property, c.Old, c.New)
+		if err := e.print(c, text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+/*
+Command yeelight controls lamps from the shell.
+
+Usage:
+
+	yeelight [flags] <command> [arguments]
+
+The lamp is selected with -d by IP address, device ID or name. IDs and names are looked up with a LAN search,
+without -d the only lamp found is used. With -json every command prints JSON for scripts.
+
+Examples:
+
+	yeelight discover
+	yeelight -d "Bed Bulb" on
+	yeelight -d 192.168.1.239 -duration 1000 ct 2700
+	yeelight -d 0x000000000015243f -json props power bright
+	yeelight -d desk watch
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LordAur/yeelight"
+)
+
+type env struct {
+	device   string
+	json     bool
+	duration int
+	timeout  time.Duration
+	scenes   string
+	registry *yeelight.Registry
+}
+
+func main() {
+	e := &env{}
+
+	flag.StringVar(&e.device, "d", os.Getenv("YEELIGHT_DEVICE"), "lamp by IP address, device ID or name (default $YEELIGHT_DEVICE)")
+	flag.BoolVar(&e.json, "json", false, "print JSON")
+	flag.IntVar(&e.duration, "duration", 300, "transition in milliseconds, 0 changes at once")
+	flag.DurationVar(&e.timeout, "timeout", 2*time.Second, "how long to search the LAN for lamps")
+	flag.StringVar(&e.scenes, "scenes", "", "scene library file for the scene command")
+	registryPath := flag.String("registry", "", "file remembering discovered lamps, searching is skipped for known ones")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	registry, err := yeelight.NewRegistry(*registryPath)
+	if err != nil {
+		fail(err)
+	}
+	defer registry.Close()
+
+	e.registry = registry
+
+	name, args := flag.Arg(0), flag.Args()[1:]
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(e, args); err != nil {
+		fail(err)
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+
+	fmt.Fprintf(out, "usage: %s [flags] <command> [arguments]\n\ncommands:\n", os.Args[0])
+	for _, name := range order {
+		fmt.Fprintf(out, "  %-8s %s\n", name, commands[name].usage)
+	}
+
+	fmt.Fprintf(out, "\nflags:\n")
+	flag.PrintDefaults()
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "yeelight: %v\n", err)
+	os.Exit(1)
+}
+
+// lamp resolves -d to the Config of one lamp.
+func (e *env) lamp() (*yeelight.Config, error) {
+	if ip := net.ParseIP(e.device); ip != nil {
+		return e.dial(ip.String(), 55443), nil
+	}
+
+	if host, port, err := net.SplitHostPort(e.device); err == nil && net.ParseIP(host) != nil {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", e.device, err)
+		}
+
+		return e.dial(host, p), nil
+	}
+
+	if d, ok := e.match(e.registry.Devices()); ok {
+		return e.registry.Get(d.ID)
+	}
+
+	devices, err := e.search()
+	if err != nil {
+		return nil, err
+	}
+
+	d, ok := e.match(devices)
+	if !ok {
+		if e.device == "" {
+			return nil, fmt.Errorf("found %d lamps, select one with -d", len(devices))
+		}
+
+		return nil, fmt.Errorf("no lamp %q found", e.device)
+	}
+
+	return e.registry.Get(d.ID)
+}
+
+func (e *env) dial(ip string, port int) *yeelight.Config {
+	y := yeelight.New(&yeelight.Config{IpAddress: ip, Port: port})
+	return &y
+}
+
+// match finds the device selected by ID or name, without -d the only device.
+func (e *env) match(devices []yeelight.Device) (yeelight.Device, bool) {
+	if e.device == "" {
+		if len(devices) == 1 {
+			return devices[0], true
+		}
+
+		return yeelight.Device{}, false
+	}
+
+	var found []yeelight.Device
+	for _, d := range devices {
+		if d.ID == e.device || strings.EqualFold(d.Name, e.device) {
+			found = append(found, d)
+		}
+	}
+
+	if len(found) != 1 {
+		return yeelight.Device{}, false
+	}
+
+	return found[0], true
+}
+
+// search looks for lamps on the LAN and remembers them in the registry.
+func (e *env) search() ([]yeelight.Device, error) {
+	devices, err := yeelight.Search(e.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range devices {
+		if err := e.registry.Update(d); err != nil {
+			return nil, err
+		}
+	}
+
+	return devices, nil
+}
+
+func (e *env) effect() (string, int) {
+	if e.duration <= 0 {
+		return "sudden", 30
+	}
+
+	return "smooth", e.duration
+}
+
+// print writes v as JSON with -json, the text otherwise.
+func (e *env) print(v interface{}, text string) error {
+	if e.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(v)
+	}
+
+	_, err := fmt.Println(text)
+
+	return err
+}
+
+// result prints the answer to a command, an error answered by the device is an error.
+func (e *env) result(r yeelight.Response, err error) error {
+	if err != nil {
+		return err
+	}
+
+	if r.Error != nil {
+		return r.Error
+	}
+
+	return e.print(r, "ok")
+}
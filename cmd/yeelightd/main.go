@@ -0,0 +1,122 @@
+/*
+Command yeelightd serves the lamps of the LAN over HTTP. Lamps are discovered continuously and remembered in the
+registry file, the API is described at /openapi.json.
+
+Usage:
+
+	yeelightd [-listen :8080] [-registry devices.json] [-search 1m] [-groups groups.json] [-webhooks hooks.json]
+	          [-origins https://example.com,...]
+
+The groups file maps group names to device IDs, the live streams at /events (Server-Sent Events) and /ws
+(WebSocket) can be filtered with ?group=name or ?device=id. Web pages of other sites than the server may only open
+the WebSocket when their origin is listed in -origins. Prometheus metrics are served at /metrics.
+
+The webhooks file is a JSON array of hooks, see package webhook:
+
+	[{"url": "https://example.com/lamps", "secret": "s3cret", "types": ["offline", "command_failed"]}]
+
+Example:
+
+	curl -X PUT localhost:8080/devices/desk/power -d '{"on": true}'
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/metrics"
+	"github.com/LordAur/yeelight/server"
+	"github.com/LordAur/yeelight/webhook"
+)
+
+func main() {
+	listen := flag.String("listen", ":8080", "HTTP address")
+	registryPath := flag.String("registry", "", "file remembering discovered lamps")
+	interval := flag.Duration("search", time.Minute, "how often to search the LAN for lamps")
+	groupsPath := flag.String("groups", "", "JSON file of group names to device IDs")
+	hooksPath := flag.String("webhooks", "", "JSON file of webhooks receiving the events of the lamps")
+	origins := flag.String("origins", "", "comma separated origins of other sites allowed to open the WebSocket")
+	flag.Parse()
+
+	var groups map[string][]string
+	if *groupsPath != "" {
+		data, err := os.ReadFile(*groupsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := json.Unmarshal(data, &groups); err != nil {
+			log.Fatalf("%s: %v", *groupsPath, err)
+		}
+	}
+
+	var hooks []webhook.Hook
+	if *hooksPath != "" {
+		data, err := os.ReadFile(*hooksPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := json.Unmarshal(data, &hooks); err != nil {
+			log.Fatalf("%s: %v", *hooksPath, err)
+		}
+	}
+
+	registry, err := yeelight.NewRegistry(*registryPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer registry.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	go func() {
+		if err := registry.Watch(ctx, *interval); err != nil && ctx.Err() == nil {
+			log.Printf("discovery: %v", err)
+		}
+	}()
+
+	if len(hooks) > 0 {
+		dispatcher := &webhook.Dispatcher{
+			Registry: registry,
+			Hooks:    hooks,
+			OnError: func(h webhook.Hook, e webhook.Event, err error) {
+				log.Printf("webhook: %s event %s: %v", e.Type, e.ID, err)
+			},
+		}
+
+		go dispatcher.Run(ctx)
+	}
+
+	api := &server.Server{Registry: registry, Groups: groups}
+	if *origins != "" {
+		api.Origins = strings.Split(*origins, ",")
+	}
+	api.Handle("GET /metrics", &metrics.Exporter{Registry: registry})
+
+	srv := &http.Server{
+		Addr:    *listen,
+		Handler: api,
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+
+	log.Printf("listening on %s", *listen)
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
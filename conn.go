@@ -0,0 +1,500 @@
+package yeelight
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by calls on a closed connection.
+var ErrClosed = errors.New("connection is closed")
+
+/*
+Conn is the one managed connection to a device. Requests, their answers and the "props" notifications of the device
+all share it: a single reader hands every answer to the call waiting for its ID and every notification to the
+subscribers. It dials lazily, reconnects after a failure and moves when the device gets a new address,
+so the device's limit on simultaneous connections is not spent on a second connection just for notifications.
+*/
+type Conn struct {
+	mu       sync.Mutex
+	addr     string
+	conn     net.Conn
+	closed   bool
+	id       int
+	pending  map[int]pendingCall
+	subs     map[*subscription]bool
+	deadline time.Time
+	cache    propCache
+	stats    connStats
+
+	// Closed and replaced when the deadline changes, so waiting calls look at it again.
+	wake chan struct{}
+
+	// The dial in progress, nil when none is.
+	dialing *dial
+
+	writeMu sync.Mutex
+}
+
+// dial is a dial in progress, done is closed when it ended. abandoned means the caller gave up on it.
+type dial struct {
+	done      chan struct{}
+	err       error
+	abandoned bool
+}
+
+type pendingCall struct {
+	conn net.Conn
+	ch   chan callResult
+}
+
+type callResult struct {
+	response Response
+	err      error
+}
+
+// notification is a "props" message decoded once for every subscriber.
+type notification struct {
+	message ListenResponse
+	params  map[string]interface{}
+	at      time.Time
+}
+
+/*
+subscription gets notifications from the reader, the changes of the cached state and the failed calls, any callback
+may be nil.
+They are called with the lock held and must not block, a subscription whose changed returns false is ended.
+*/
+type subscription struct {
+	deliver func(n notification)
+	changed func(changes []Change) bool
+	failed  func(f Failure)
+	end     func()
+}
+
+func newConn(addr string) *Conn {
+	return &Conn{
+		addr:    addr,
+		pending: map[int]pendingCall{},
+		subs:    map[*subscription]bool{},
+		wake:    make(chan struct{}),
+	}
+}
+
+// setAddr points the connection to a new address, the old connection is dropped.
+func (c *Conn) setAddr(addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.addr == addr {
+		return
+	}
+
+	c.addr = addr
+	if c.conn != nil {
+		c.drop(c.conn)
+	}
+}
+
+// drop forgets a broken connection, the next call dials again. The lock must be held.
+func (c *Conn) drop(conn net.Conn) {
+	conn.Close()
+
+	if c.conn == conn {
+		c.conn = nil
+		c.remember(map[string]string{"online": "false"})
+	}
+
+	for id, p := range c.pending {
+		if p.conn == conn {
+			p.ch <- callResult{err: fmt.Errorf("connection to %s lost: %w", c.addr, net.ErrClosed)}
+			delete(c.pending, id)
+		}
+	}
+}
+
+/*
+current returns the open connection or dials one. The dial runs without the lock, so the other users of the connection
+don't wait for an unreachable lamp, and calls that come in meanwhile wait for its result instead of dialing too.
+*/
+func (c *Conn) current(ctx context.Context) (net.Conn, error) {
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return nil, ErrClosed
+		}
+
+		if c.conn != nil {
+			conn := c.conn
+			c.mu.Unlock()
+
+			return conn, nil
+		}
+
+		if d := c.dialing; d != nil {
+			c.mu.Unlock()
+
+			select {
+			case <-d.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+
+			// A dial given up by its caller tells nothing about the lamp, it is tried again.
+			if d.err != nil && !d.abandoned {
+				return nil, d.err
+			}
+
+			continue
+		}
+
+		d := &dial{done: make(chan struct{})}
+		c.dialing = d
+		addr := c.addr
+		c.mu.Unlock()
+
+		conn, err := (&net.Dialer{Timeout: 5 * time.Second}).DialContext(ctx, "tcp", addr)
+
+		c.mu.Lock()
+		c.dialing = nil
+		d.err, d.abandoned = err, ctx.Err() != nil
+		close(d.done)
+
+		if err != nil {
+			c.mu.Unlock()
+
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			return nil, err
+		}
+
+		// The connection was closed or moved during the dial.
+		if c.closed || c.addr != addr {
+			c.mu.Unlock()
+			conn.Close()
+
+			continue
+		}
+
+		c.conn = conn
+		c.stats.connects++
+		c.remember(map[string]string{"online": "true"})
+		c.mu.Unlock()
+
+		go c.read(conn)
+
+		return conn, nil
+	}
+}
+
+func (c *Conn) read(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			break
+		}
+
+		c.dispatch(line)
+	}
+
+	c.mu.Lock()
+	c.drop(conn)
+	resubscribe := !c.closed && len(c.subs) > 0
+	c.mu.Unlock()
+
+	if resubscribe {
+		go c.reconnect()
+	}
+}
+
+func (c *Conn) dispatch(line []byte) {
+	var envelope struct {
+		ID     *int            `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+
+	if err := json.Unmarshal(line, &envelope); err != nil {
+		return
+	}
+
+	if envelope.ID != nil {
+		var r Response
+		if err := json.Unmarshal(line, &r); err != nil {
+			return
+		}
+
+		c.mu.Lock()
+		if p, ok := c.pending[r.ID]; ok {
+			p.ch <- callResult{response: r}
+			delete(c.pending, r.ID)
+		}
+		c.mu.Unlock()
+
+		return
+	}
+
+	if envelope.Method != "props" {
+		return
+	}
+
+	n := notification{at: time.Now()}
+	json.Unmarshal(line, &n.message)
+
+	// Numbers are kept as sent, a float64 would print rgb values in exponent notation.
+	decoder := json.NewDecoder(bytes.NewReader(envelope.Params))
+	decoder.UseNumber()
+	decoder.Decode(&n.params)
+
+	values := map[string]string{}
+	for k, v := range n.params {
+		values[k] = propString(v)
+	}
+
+	c.mu.Lock()
+	c.stats.notifications++
+	c.remember(values)
+	for s := range c.subs {
+		if s.deliver != nil {
+			s.deliver(n)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// reconnect keeps subscribers fed after the connection dropped, waiting longer after every failed attempt.
+func (c *Conn) reconnect() {
+	wait := time.Second
+	for {
+		c.mu.Lock()
+		done := c.closed || len(c.subs) == 0 || c.conn != nil
+		c.mu.Unlock()
+
+		if done {
+			return
+		}
+
+		if _, err := c.current(context.Background()); err == nil {
+			return
+		}
+
+		time.Sleep(wait)
+		wait = min(2*wait, 30*time.Second)
+	}
+}
+
+func (c *Conn) subscribe(s *subscription) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+
+	c.subs[s] = true
+	c.mu.Unlock()
+
+	// Notifications only arrive on an open connection.
+	go c.reconnect()
+
+	return nil
+}
+
+func (c *Conn) unsubscribe(s *subscription) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.subs[s] {
+		delete(c.subs, s)
+		s.end()
+	}
+}
+
+/*
+This function is used to send a request and wait for its answer. The request ID is assigned by the connection,
+an error object answered by the device is in Response.Error.
+*/
+func (c *Conn) Call(method string, params ...interface{}) (Response, error) {
+	return c.CallContext(context.Background(), method, params...)
+}
+
+/*
+This function is used to send a request like Call, but to stop waiting for the answer when the context is done.
+Only this call gives up, the connection and the other calls on it are not affected.
+*/
+func (c *Conn) CallContext(ctx context.Context, method string, params ...interface{}) (Response, error) {
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	start := time.Now()
+
+	// One retry on a fresh connection, the device closes idle connections.
+	for attempt := 0; ; attempt++ {
+		r, err, written := c.roundTrip(ctx, method, params)
+
+		c.mu.Lock()
+		if err == nil && r.Error == nil {
+			c.learn(method, params, r)
+		}
+
+		done := written || err == nil || attempt == 1 || errors.Is(err, ErrClosed) || ctx.Err() != nil
+		if done {
+			c.stats.record(method, time.Since(start), r, err)
+
+			if err != nil || r.Error != nil {
+				c.fail(method, params, r, err)
+			}
+		}
+		c.mu.Unlock()
+
+		if done {
+			return r, err
+		}
+	}
+}
+
+func (c *Conn) roundTrip(ctx context.Context, method string, params []interface{}) (Response, error, bool) {
+	if err := ctx.Err(); err != nil {
+		return Response{}, fmt.Errorf("%s not sent: %w", method, err), false
+	}
+
+	conn, err := c.current(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return Response{}, fmt.Errorf("%s not sent: %w", method, ctx.Err()), false
+		}
+
+		return Response{}, err, false
+	}
+
+	ch := make(chan callResult, 1)
+
+	c.mu.Lock()
+	c.id++
+	id := c.id
+	c.pending[id] = pendingCall{conn, ch}
+	c.mu.Unlock()
+
+	data, _ := json.Marshal(Request{
+		ID:     id,
+		Method: method,
+		Params: params,
+	})
+
+	c.writeMu.Lock()
+	_, err = conn.Write(append(data, '\r', '\n'))
+	c.writeMu.Unlock()
+
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.drop(conn)
+		c.mu.Unlock()
+
+		return Response{}, err, false
+	}
+
+	for {
+		c.mu.Lock()
+		deadline, wake := c.deadline, c.wake
+		c.mu.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			timeout = timer.C
+		}
+
+		select {
+		case res := <-ch:
+			stopTimer(timer)
+			return res.response, res.err, true
+		case <-wake:
+			// The deadline changed, the timer of the old one is not needed anymore.
+			stopTimer(timer)
+		case <-timeout:
+			c.mu.Lock()
+			delete(c.pending, id)
+			c.mu.Unlock()
+
+			return Response{}, fmt.Errorf("no answer to %s: %w", method, os.ErrDeadlineExceeded), true
+		case <-ctx.Done():
+			stopTimer(timer)
+
+			c.mu.Lock()
+			delete(c.pending, id)
+			c.mu.Unlock()
+
+			return Response{}, fmt.Errorf("no answer to %s: %w", method, ctx.Err()), true
+		}
+	}
+}
+
+func stopTimer(t *time.Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
+
+/*
+This function is used to limit how long calls wait for their answer, including the calls already waiting.
+The zero time means no limit.
+*/
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.deadline = t
+	close(c.wake)
+	c.wake = make(chan struct{})
+
+	return nil
+}
+
+/*
+This function is used to get the local address of the connection, it dials when not connected.
+*/
+func (c *Conn) LocalAddr() net.Addr {
+	conn, err := c.current(context.Background())
+	if err != nil {
+		return nil
+	}
+
+	return conn.LocalAddr()
+}
+
+/*
+This function is used to close the connection, waiting calls fail and notification channels are closed.
+*/
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+
+	c.closed = true
+	if c.conn != nil {
+		c.drop(c.conn)
+	}
+
+	for s := range c.subs {
+		delete(c.subs, s)
+		s.end()
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+package yeelight
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ssdpAddress = "239.255.255.250:1982"
+
+// Device is what a device tells about itself when it answers a search or advertises itself.
+type Device struct {
+	ID               string   `json:"id"`
+	IpAddress        string   `json:"ip_address"`
+	Port             int      `json:"port"`
+	Model            string   `json:"model,omitempty"`
+	FirmwareVersion  int      `json:"fw_ver,omitempty"`
+	Support          []string `json:"support,omitempty"`
+	Name             string   `json:"name,omitempty"`
+	Power            string   `json:"power,omitempty"`
+	Brightness       int      `json:"bright,omitempty"`
+	ColorMode        int      `json:"color_mode,omitempty"`
+	ColorTemperature int      `json:"ct,omitempty"`
+	Rgb              int      `json:"rgb,omitempty"`
+	Hue              int      `json:"hue,omitempty"`
+	Saturation       int      `json:"sat,omitempty"`
+}
+
+/*
+This function is used to search Yeelight devices with the SSDP like multicast search from the spec.
+Unlike Discovery it returns the stable device ID and the supported methods. Answers are collected until the timeout.
+*/
+func Search(timeout time.Duration) ([]Device, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	addr, err := net.ResolveUDPAddr("udp4", ssdpAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddress + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"ST: wifi_bulb\r\n"
+
+	_, err = conn.WriteTo([]byte(search), addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	var devices []Device
+	seen := map[string]bool{}
+	buf := make([]byte, 4096)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return devices, nil
+			}
+
+			return devices, err
+		}
+
+		d, err := ParseAdvertisement(buf[:n])
+		if err != nil || seen[d.ID] {
+			continue
+		}
+
+		seen[d.ID] = true
+		devices = append(devices, d)
+	}
+}
+
+/*
+This function is used to receive the advertisements devices send to the multicast group, for example
+when they join the network or get a new address. The channel is closed when the context is cancelled.
+*/
+func Advertisements(ctx context.Context) (<-chan Device, error) {
+	addr, err := net.ResolveUDPAddr("udp4", ssdpAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenMulticastUDP("udp4", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	devices := make(chan Device)
+
+	go func() {
+		defer close(devices)
+
+		buf := make([]byte, 4096)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			d, err := ParseAdvertisement(buf[:n])
+			if err != nil {
+				continue
+			}
+
+			select {
+			case devices <- d:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return devices, nil
+}
+
+/*
+This function is used to parse a search answer or a NOTIFY advertisement.
+*/
+func ParseAdvertisement(msg []byte) (Device, error) {
+	var d Device
+
+	scanner := bufio.NewScanner(bytes.NewReader(msg))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "location":
+			u, err := url.Parse(value)
+			if err != nil || u.Scheme != "yeelight" {
+				return d, fmt.Errorf("location %q is not a yeelight address", value)
+			}
+
+			d.IpAddress = u.Hostname()
+			d.Port, _ = strconv.Atoi(u.Port())
+		case "id":
+			d.ID = value
+		case "model":
+			d.Model = value
+		case "fw_ver":
+			d.FirmwareVersion, _ = strconv.Atoi(value)
+		case "support":
+			d.Support = strings.Fields(value)
+		case "name":
+			d.Name = value
+		case "power":
+			d.Power = value
+		case "bright":
+			d.Brightness, _ = strconv.Atoi(value)
+		case "color_mode":
+			d.ColorMode, _ = strconv.Atoi(value)
+		case "ct":
+			d.ColorTemperature, _ = strconv.Atoi(value)
+		case "rgb":
+			d.Rgb, _ = strconv.Atoi(value)
+		case "hue":
+			d.Hue, _ = strconv.Atoi(value)
+		case "sat":
+			d.Saturation, _ = strconv.Atoi(value)
+		}
+	}
+
+	if d.ID == "" || d.IpAddress == "" {
+		return d, fmt.Errorf("message is not a yeelight advertisement")
+	}
+
+	if d.Port == 0 {
+		d.Port = 55443
+	}
+
+	return d, nil
+}
+
+/*
+This function is used to check whether the device supports a method, for example "bg_set_rgb".
+*/
+func (d Device) Supports(method string) bool {
+	for _, s := range d.Support {
+		if s == method {
+			return true
+		}
+	}
+
+	return false
+}
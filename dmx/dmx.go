@@ -0,0 +1,423 @@
+/*
+Package dmx drives lamps from lighting consoles. DMX is received as sACN (E1.31) or Art-Net over UDP, every lamp is
+patched to channels of a universe and follows them over music mode, which has no rate limit.
+
+Sources of a universe are arbitrated like E1.31 receivers do: the highest priority wins, a source that stops sending
+for SourceTimeout or terminates its stream is dropped and the next one takes over. When the last source is gone the
+lamps keep their last look.
+
+Example:
+
+	desk, err := y.StartMusic()
+	if err != nil {
+		...
+	}
+
+	defer desk.Close()
+
+	conns, err := dmx.ListenSACN(nil, 1)
+	if err != nil {
+		...
+	}
+
+	r := &dmx.Receiver{
+		Patches: []dmx.Patch{
+			{Universe: 1, Address: 1, Mode: dmx.DimmerRGB, Lamp: desk},
+		},
+	}
+
+	err = r.Serve(ctx, conns...)
+*/
+package dmx
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Target is a lamp driven by the console, usually a *yeelight.Music.
+type Target interface {
+	SetPower(power bool, effect string, duration int) error
+	SetRGB(red, green, blue int, effect string, duration int) error
+	SetBright(brightness int, effect string, duration int) error
+	SetColorTemp(temp int, effect string, duration int) error
+}
+
+// Mode is the channel layout of a patch, channels are read from Address on.
+type Mode int
+
+const (
+	// One channel: brightness, 0 switches off.
+	Dimmer Mode = iota
+
+	// Three channels: red, green, blue. The brightest channel is the brightness.
+	RGB
+
+	// Four channels: brightness, red, green, blue.
+	DimmerRGB
+
+	// Two channels: brightness, color temperature from 1700 K at 0 to 6500 K at 255.
+	DimmerCT
+)
+
+func (m Mode) channels() int {
+	switch m {
+	case RGB:
+		return 3
+	case DimmerRGB:
+		return 4
+	case DimmerCT:
+		return 2
+	}
+
+	return 1
+}
+
+// Patch connects a lamp to channels of a universe. Art-Net universes are the 15 bit port address, sACN starts at 1.
+type Patch struct {
+	Universe int
+
+	// First channel, 1 ~ 512.
+	Address int
+	Mode    Mode
+	Lamp    Target
+}
+
+// Receiver arbitrates the sources of every universe and drives the patched lamps.
+type Receiver struct {
+	Patches []Patch
+
+	// Time without packets after which a source is dropped, default 2.5 seconds as E1.31 specifies.
+	SourceTimeout time.Duration
+
+	// Updates sent to a lamp per second at most, default 30. Consoles send up to 44 frames per second.
+	MaxRate int
+
+	mu        sync.Mutex
+	universes map[int]*universe
+	lamps     []*lamp
+}
+
+type universe struct {
+	sources map[string]*source
+	active  string
+}
+
+type source struct {
+	priority int
+	since    time.Time
+	seen     time.Time
+	sequence byte
+	data     []byte
+}
+
+/*
+This function is used to receive DMX on the connections until the context is cancelled or a connection fails.
+sACN and Art-Net packets are told apart by their header, so any connection can carry either.
+*/
+func (r *Receiver) Serve(ctx context.Context, conns ...net.PacketConn) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r.mu.Lock()
+	r.universes = map[int]*universe{}
+	r.lamps = make([]*lamp, len(r.Patches))
+	for i, p := range r.Patches {
+		r.lamps[i] = &lamp{target: p.Lamp, wake: make(chan struct{}, 1)}
+	}
+	r.mu.Unlock()
+
+	rate := r.MaxRate
+	if rate <= 0 {
+		rate = 30
+	}
+
+	var wg sync.WaitGroup
+	for _, l := range r.lamps {
+		wg.Add(1)
+		go func(l *lamp) {
+			defer wg.Done()
+			l.run(ctx, time.Second/time.Duration(rate))
+		}(l)
+	}
+
+	errs := make(chan error, len(conns))
+	for _, conn := range conns {
+		go func(conn net.PacketConn) {
+			errs <- r.read(ctx, conn)
+		}(conn)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case err = <-errs:
+	}
+
+	cancel()
+	wg.Wait()
+
+	return err
+}
+
+// read handles the packets of a connection, the read deadline lets it drop silent sources in time.
+func (r *Receiver) read(ctx context.Context, conn net.PacketConn) error {
+	buf := make([]byte, 1500)
+
+	for ctx.Err() == nil {
+		conn.SetReadDeadline(time.Now().Add(250 * time.Millisecond))
+
+		n, from, err := conn.ReadFrom(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			r.expire(time.Now())
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if f, ok := parse(buf[:n], from); ok {
+			r.receive(f, time.Now())
+		}
+	}
+
+	return ctx.Err()
+}
+
+func (r *Receiver) timeout() time.Duration {
+	if r.SourceTimeout <= 0 {
+		return 2500 * time.Millisecond
+	}
+
+	return r.SourceTimeout
+}
+
+func (r *Receiver) receive(f frame, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.universes[f.universe]
+	if !ok {
+		u = &universe{sources: map[string]*source{}}
+		r.universes[f.universe] = u
+	}
+
+	s, ok := u.sources[f.source]
+
+	if f.terminated {
+		if ok {
+			delete(u.sources, f.source)
+			r.arbitrate(f.universe, u, now)
+		}
+
+		return
+	}
+
+	if ok {
+		// E1.31 discards a packet up to 20 behind the last one, anything further back means the source restarted.
+		if diff := int8(f.sequence - s.sequence); f.sequenced && diff <= 0 && diff > -20 {
+			return
+		}
+	} else {
+		s = &source{since: now}
+		u.sources[f.source] = s
+	}
+
+	s.priority, s.seen, s.sequence = f.priority, now, f.sequence
+	s.data = append(s.data[:0], f.data...)
+
+	r.arbitrate(f.universe, u, now)
+}
+
+// expire drops the sources that went silent.
+func (r *Receiver) expire(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for number, u := range r.universes {
+		changed := false
+		for id, s := range u.sources {
+			if now.Sub(s.seen) > r.timeout() {
+				delete(u.sources, id)
+				changed = true
+			}
+		}
+
+		if changed {
+			r.arbitrate(number, u, now)
+		}
+	}
+}
+
+/*
+arbitrate picks the source of a universe and hands its data to the lamps. The highest priority wins and among equal
+priorities the source sending the longest keeps control, so two consoles do not make the lamps flicker.
+The lock must be held.
+*/
+func (r *Receiver) arbitrate(number int, u *universe, now time.Time) {
+	var best string
+	for id, s := range u.sources {
+		if now.Sub(s.seen) > r.timeout() {
+			continue
+		}
+
+		if b, ok := u.sources[best]; !ok || s.priority > b.priority || (s.priority == b.priority && s.since.Before(b.since)) {
+			best = id
+		}
+	}
+
+	u.active = best
+	if best == "" {
+		return
+	}
+
+	data := u.sources[best].data
+	for i, p := range r.Patches {
+		if p.Universe == number {
+			r.lamps[i].set(lookOf(p, data))
+		}
+	}
+}
+
+// look is what a lamp should show, rgb is -1 and ct 0 when the mode does not set them.
+type look struct {
+	on     bool
+	bright int
+	rgb    int
+	ct     int
+}
+
+func lookOf(p Patch, data []byte) look {
+	channel := func(i int) int {
+		if at := p.Address - 1 + i; at >= 0 && at < len(data) {
+			return int(data[at])
+		}
+
+		return 0
+	}
+
+	percent := func(v int) int {
+		return max(1, (v*100+127)/255)
+	}
+
+	l := look{rgb: -1}
+
+	switch p.Mode {
+	case Dimmer:
+		l.on, l.bright = channel(0) > 0, percent(channel(0))
+	case RGB:
+		red, green, blue := channel(0), channel(1), channel(2)
+		peak := max(red, green, blue)
+		l.on, l.bright = peak > 0, percent(peak)
+
+		// The color at full brightness, the brightness is set on its own.
+		if peak > 0 {
+			l.rgb = (red*255/peak)<<16 | (green*255/peak)<<8 | blue*255/peak
+		}
+	case DimmerRGB:
+		red, green, blue := channel(1), channel(2), channel(3)
+		l.on, l.bright = channel(0) > 0 && max(red, green, blue) > 0, percent(channel(0))
+		l.rgb = red<<16 | green<<8 | blue
+	case DimmerCT:
+		l.on, l.bright = channel(0) > 0, percent(channel(0))
+		l.ct = 1700 + channel(1)*(6500-1700)/255
+	}
+
+	return l
+}
+
+// lamp sends the wanted look to one target, at most once per interval and only what changed.
+type lamp struct {
+	target Target
+	wake   chan struct{}
+
+	mu   sync.Mutex
+	want look
+	sent *look
+}
+
+func (l *lamp) set(want look) {
+	l.mu.Lock()
+	l.want = want
+	l.mu.Unlock()
+
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (l *lamp) run(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-l.wake:
+		}
+
+		l.mu.Lock()
+		want, sent := l.want, l.sent
+		l.mu.Unlock()
+
+		if sent == nil || want != *sent {
+			if err := l.apply(want, sent); err == nil {
+				l.mu.Lock()
+				l.sent = &want
+				l.mu.Unlock()
+			} else {
+				l.mu.Lock()
+				l.sent = nil
+				l.mu.Unlock()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// apply sends the differences between two looks, everything when the sent look is unknown.
+func (l *lamp) apply(want look, sent *look) error {
+	const effect, duration = "sudden", 30
+
+	if !want.on {
+		if sent == nil || sent.on {
+			return l.target.SetPower(false, effect, duration)
+		}
+
+		return nil
+	}
+
+	if sent == nil || !sent.on {
+		if err := l.target.SetPower(true, effect, duration); err != nil {
+			return err
+		}
+	}
+
+	if want.rgb >= 0 && (sent == nil || want.rgb != sent.rgb) {
+		if err := l.target.SetRGB(want.rgb>>16, want.rgb>>8&0xFF, want.rgb&0xFF, effect, duration); err != nil {
+			return err
+		}
+	}
+
+	if want.ct > 0 && (sent == nil || want.ct != sent.ct) {
+		if err := l.target.SetColorTemp(want.ct, effect, duration); err != nil {
+			return err
+		}
+	}
+
+	if sent == nil || want.bright != sent.bright || !sent.on {
+		return l.target.SetBright(want.bright, effect, duration)
+	}
+
+	return nil
+}
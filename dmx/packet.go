@@ -0,0 +1,146 @@
+package dmx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+)
+
+// Default ports of the protocols.
+const (
+	SACNPort   = 5568
+	ArtNetPort = 6454
+)
+
+// Art-Net has no priority, its sources compete with sACN sources at the E1.31 default.
+const artNetPriority = 100
+
+var (
+	acnIdentifier = []byte("ASC-E1.17\x00\x00\x00")
+	artNetID      = []byte("Art-Net\x00")
+)
+
+// frame is the DMX data of one packet.
+type frame struct {
+	source     string
+	universe   int
+	priority   int
+	sequence   byte
+	sequenced  bool
+	terminated bool
+	data       []byte
+}
+
+// parse reads an E1.31 data packet or an ArtDmx packet, other packets are ignored with ok false.
+func parse(packet []byte, from net.Addr) (frame, bool) {
+	switch {
+	case len(packet) >= 126 && bytes.Equal(packet[4:16], acnIdentifier):
+		return parseSACN(packet)
+	case len(packet) >= 18 && bytes.Equal(packet[:8], artNetID):
+		return parseArtNet(packet, from)
+	}
+
+	return frame{}, false
+}
+
+/*
+parseSACN reads the root, framing and DMP layers of an E1.31 data packet. Preview data and alternate start codes,
+like the per address priority of 0xDD, are ignored.
+*/
+func parseSACN(p []byte) (frame, bool) {
+	if binary.BigEndian.Uint32(p[18:22]) != 0x00000004 || binary.BigEndian.Uint32(p[40:44]) != 0x00000002 || p[117] != 0x02 {
+		return frame{}, false
+	}
+
+	options := p[112]
+	if options&0x80 != 0 || p[125] != 0x00 {
+		return frame{}, false
+	}
+
+	count := int(binary.BigEndian.Uint16(p[123:125])) - 1
+	if count < 0 || 126+count > len(p) {
+		return frame{}, false
+	}
+
+	return frame{
+		source:     "sacn/" + hex.EncodeToString(p[22:38]),
+		universe:   int(binary.BigEndian.Uint16(p[113:115])),
+		priority:   int(p[108]),
+		sequence:   p[111],
+		sequenced:  true,
+		terminated: options&0x40 != 0,
+		data:       p[126 : 126+count],
+	}, true
+}
+
+// parseArtNet reads an ArtDmx packet, the universe is the 15 bit port address.
+func parseArtNet(p []byte, from net.Addr) (frame, bool) {
+	if binary.LittleEndian.Uint16(p[8:10]) != 0x5000 {
+		return frame{}, false
+	}
+
+	length := int(binary.BigEndian.Uint16(p[16:18]))
+	if 18+length > len(p) {
+		return frame{}, false
+	}
+
+	source := "artnet"
+	if from != nil {
+		source += "/" + from.String()
+	}
+
+	return frame{
+		source:   source,
+		universe: int(p[15]&0x7F)<<8 | int(p[14]),
+		priority: artNetPriority,
+		sequence: p[12],
+
+		// Art-Net sends 0 when it does not count.
+		sequenced: p[12] != 0,
+		data:      p[18 : 18+length],
+	}, true
+}
+
+/*
+This function is used to receive the multicast sACN traffic of some universes, one connection per universe.
+A nil interface lets the system choose. Consoles sending unicast need a connection of their own instead:
+
+	conn, err := net.ListenPacket("udp4", ":5568")
+*/
+func ListenSACN(ifi *net.Interface, universes ...int) ([]net.PacketConn, error) {
+	var conns []net.PacketConn
+
+	for _, u := range universes {
+		if u < 1 || u > 63999 {
+			closeAll(conns)
+			return nil, fmt.Errorf("sACN universe %d should be in range 1 ~ 63999", u)
+		}
+
+		group := &net.UDPAddr{IP: net.IPv4(239, 255, byte(u>>8), byte(u)), Port: SACNPort}
+
+		conn, err := net.ListenMulticastUDP("udp4", ifi, group)
+		if err != nil {
+			closeAll(conns)
+			return nil, err
+		}
+
+		conns = append(conns, conn)
+	}
+
+	return conns, nil
+}
+
+/*
+This function is used to receive Art-Net, which consoles broadcast or send unicast to port 6454.
+*/
+func ListenArtNet() (net.PacketConn, error) {
+	return net.ListenPacket("udp4", fmt.Sprintf(":%d", ArtNetPort))
+}
+
+func closeAll(conns []net.PacketConn) {
+	for _, c := range conns {
+		c.Close()
+	}
+}
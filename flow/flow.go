@@ -0,0 +1,191 @@
+/*
+Package flow converts animations into color flows for SetColorFlow.
+
+Example:
+
+	file, _ := os.Open("sunset.gif")
+
+	exprs, err := flow.Converter{}.GIF(file)
+	if err != nil {
+		...
+	}
+
+	y.SetColorFlow(0, 1, exprs)
+*/
+package flow
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"math"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/ambient"
+)
+
+const (
+	// DefaultMaxLength is a conservative number of expressions a device accepts in one flow.
+	DefaultMaxLength = 32
+
+	// DefaultTolerance is the RGB distance below which consecutive colors are merged.
+	DefaultTolerance = 12
+
+	// Browsers show GIF frames without a delay for 100 milliseconds, so do we.
+	defaultDelay = 100
+)
+
+/*
+Converter samples animations into flow expressions. Every frame becomes a transition to its average color
+that lasts as long as the frame delay. Similar consecutive frames are merged, and when the flow is still too long
+the most similar neighbours are merged until it fits. The zero value is ready to use.
+*/
+type Converter struct {
+	// Maximum number of expressions, default DefaultMaxLength.
+	MaxLength int
+
+	// Consecutive colors closer than this are merged, default DefaultTolerance. Use a negative value to keep every frame.
+	Tolerance float64
+}
+
+type step struct {
+	r, g, b  float64
+	duration int
+}
+
+/*
+This function is used to convert an animated GIF. Frames are composited with their disposal method
+before they are sampled, the delays are honoured with a minimum of 30 milliseconds.
+*/
+func (c Converter) GIF(r io.Reader) ([]yeelight.FlowExpression, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	canvas := image.NewRGBA(bounds)
+
+	var steps []step
+	for i, frame := range g.Image {
+		var previous *image.RGBA
+		if i < len(g.Disposal) && g.Disposal[i] == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		delay := defaultDelay
+		if i < len(g.Delay) && g.Delay[i] > 1 {
+			delay = g.Delay[i] * 10
+		}
+
+		avg := ambient.Average(canvas, ambient.Region{X: 0, Y: 0, W: 1, H: 1})
+		steps = append(steps, step{float64(avg.R), float64(avg.G), float64(avg.B), delay})
+
+		if i < len(g.Disposal) {
+			switch g.Disposal[i] {
+			case gif.DisposalBackground:
+				draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+			case gif.DisposalPrevious:
+				canvas = previous
+			}
+		}
+	}
+
+	return c.convert(steps), nil
+}
+
+/*
+This function is used to convert a list of palette swatches, every swatch is shown for "duration" milliseconds.
+*/
+func (c Converter) Palette(colors []color.Color, duration int) []yeelight.FlowExpression {
+	steps := make([]step, 0, len(colors))
+	for _, col := range colors {
+		rgba := color.RGBAModel.Convert(col).(color.RGBA)
+		steps = append(steps, step{float64(rgba.R), float64(rgba.G), float64(rgba.B), duration})
+	}
+
+	return c.convert(steps)
+}
+
+func (c Converter) convert(steps []step) []yeelight.FlowExpression {
+	limit := c.MaxLength
+	if limit <= 0 {
+		limit = DefaultMaxLength
+	}
+
+	tolerance := c.Tolerance
+	if tolerance == 0 {
+		tolerance = DefaultTolerance
+	}
+
+	for i := range steps {
+		if steps[i].duration < 30 {
+			steps[i].duration = 30
+		}
+	}
+
+	var merged []step
+	for _, s := range steps {
+		if n := len(merged); n > 0 && distance(merged[n-1], s) < tolerance {
+			merged[n-1] = merge(merged[n-1], s)
+			continue
+		}
+
+		merged = append(merged, s)
+	}
+
+	for len(merged) > limit {
+		best := 0
+		for i := 1; i < len(merged)-1; i++ {
+			if distance(merged[i], merged[i+1]) < distance(merged[best], merged[best+1]) {
+				best = i
+			}
+		}
+
+		merged[best] = merge(merged[best], merged[best+1])
+		merged = append(merged[:best+1], merged[best+2:]...)
+	}
+
+	exprs := make([]yeelight.FlowExpression, 0, len(merged))
+	for _, s := range merged {
+		exprs = append(exprs, expression(s))
+	}
+
+	return exprs
+}
+
+// expression shows the hue at full value and turns the value into the brightness.
+func expression(s step) yeelight.FlowExpression {
+	value := math.Max(s.r, math.Max(s.g, s.b))
+	if value == 0 {
+		return yeelight.FlowExpression{Duration: s.duration, Mode: 1, Value: 0, Brightness: 1}
+	}
+
+	red := int(math.Round(s.r * 255 / value))
+	green := int(math.Round(s.g * 255 / value))
+	blue := int(math.Round(s.b * 255 / value))
+
+	return yeelight.FlowExpression{
+		Duration:   s.duration,
+		Mode:       1,
+		Value:      (red * 65536) + (green * 256) + blue,
+		Brightness: max(1, int(math.Round(value*100/255))),
+	}
+}
+
+func distance(a, b step) float64 {
+	return math.Sqrt((a.r-b.r)*(a.r-b.r) + (a.g-b.g)*(a.g-b.g) + (a.b-b.b)*(a.b-b.b))
+}
+
+// merge averages two steps weighted by how long they are shown.
+func merge(a, b step) step {
+	total := a.duration + b.duration
+	wa, wb := float64(a.duration)/float64(total), float64(b.duration)/float64(total)
+
+	return step{a.r*wa + b.r*wb, a.g*wa + b.g*wb, a.b*wa + b.b*wb, total}
+}
@@ -0,0 +1,325 @@
+package yeelight
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Phase gives the time shift of member i out of n for a flow lasting "cycle".
+type Phase func(i, n int, cycle time.Duration) time.Duration
+
+/*
+This function is used to build a chase, every member runs "step" behind the previous one.
+*/
+func Chase(step time.Duration) Phase {
+	return func(i, n int, cycle time.Duration) time.Duration {
+		return time.Duration(i) * step
+	}
+}
+
+/*
+This function is used to build a wave, the members are spread evenly over one cycle of the flow.
+*/
+func Wave() Phase {
+	return func(i, n int, cycle time.Duration) time.Duration {
+		return time.Duration(i) * cycle / time.Duration(n)
+	}
+}
+
+/*
+SyncFlow starts the same color flow on several lamps at the same moment. The round trip of every member is measured,
+then each request is written ahead of a common start time by the member's latency, so the flows don't drift apart
+like they do when started one after another.
+
+With a Phase every member runs the same flow shifted in time. A looping flow (count 0) is rotated, so every member
+starts at once somewhere in the cycle. A flow with a count is started later by the shift instead.
+
+Example:
+
+	s := &yeelight.SyncFlow{
+		Members: []*yeelight.Config{&a, &b, &c},
+		Phase:   yeelight.Chase(300 * time.Millisecond),
+	}
+
+	results, err := s.Start(0, 0, exprs)
+*/
+type SyncFlow struct {
+	Members []*Config
+
+	// Shift of every member, nil runs all members in sync.
+	Phase Phase
+
+	// Round trips measured per member, default 5. The median is used.
+	Probes int
+
+	// Extra time before the common start, default 50 milliseconds.
+	Margin time.Duration
+
+	mu      sync.Mutex
+	latency map[*Config]time.Duration
+}
+
+/*
+This function is used to measure the latency of every member. Start calls it for the members that were not measured
+yet, call it again when the network changed. A member that can't be measured is left out, the error joins a
+MemberError for each of them.
+*/
+func (s *SyncFlow) Calibrate() error {
+	latency, err := s.measure(s.Members)
+
+	s.mu.Lock()
+	s.latency = latency
+	s.mu.Unlock()
+
+	return err
+}
+
+// measure takes the median round trip of members, the failed ones are not in the map.
+func (s *SyncFlow) measure(members []*Config) (map[*Config]time.Duration, error) {
+	probes := s.Probes
+	if probes <= 0 {
+		probes = 5
+	}
+
+	latency := map[*Config]time.Duration{}
+	var errs []error
+
+	for _, m := range members {
+		if m.conn == nil {
+			errs = append(errs, &MemberError{m, fmt.Errorf("not connected")})
+			continue
+		}
+
+		var rtts []time.Duration
+		for i := 0; i < probes; i++ {
+			start := time.Now()
+			if _, err := m.GetProps("power"); err != nil {
+				errs = append(errs, &MemberError{m, err})
+				break
+			}
+			rtts = append(rtts, time.Since(start))
+		}
+
+		if len(rtts) == probes {
+			sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+			latency[m] = rtts[len(rtts)/2] / 2
+		}
+	}
+
+	return latency, errors.Join(errs...)
+}
+
+/*
+This function is used to start the flow on every member, see Config.SetColorFlow for the arguments.
+Results are in the order of Members, the error joins a MemberError for every failed member.
+*/
+func (s *SyncFlow) Start(count, action int, exprs []FlowExpression) ([]Result, error) {
+	flows := make([][]FlowExpression, len(s.Members))
+	for i := range flows {
+		flows[i] = exprs
+	}
+
+	return s.StartEach(count, action, flows)
+}
+
+/*
+This function is used to start a different flow on every member at the same moment, flows are in the order of Members.
+The Phase shift is applied to each flow like in Start. Members without a measured latency are measured first, one that
+still can't be is started without compensation and its calibration error is joined to the error.
+*/
+func (s *SyncFlow) StartEach(count, action int, flows [][]FlowExpression) ([]Result, error) {
+	if len(flows) != len(s.Members) {
+		return nil, fmt.Errorf("got %d flows for %d members", len(flows), len(s.Members))
+	}
+
+	var missing []*Config
+
+	s.mu.Lock()
+	for _, m := range s.Members {
+		if _, ok := s.latency[m]; !ok {
+			missing = append(missing, m)
+		}
+	}
+	s.mu.Unlock()
+
+	var calibration error
+	if len(missing) > 0 {
+		var measured map[*Config]time.Duration
+		measured, calibration = s.measure(missing)
+
+		s.mu.Lock()
+		if s.latency == nil {
+			s.latency = map[*Config]time.Duration{}
+		}
+		for m, latency := range measured {
+			s.latency[m] = latency
+		}
+		s.mu.Unlock()
+
+		if calibration != nil {
+			calibration = fmt.Errorf("started without latency compensation: %w", calibration)
+		}
+	}
+
+	margin := s.Margin
+	if margin <= 0 {
+		margin = 50 * time.Millisecond
+	}
+
+	// Params are built before the clock starts, only the calls are timed.
+	n := len(s.Members)
+	requests := make([][]interface{}, n)
+	delays := make([]time.Duration, n)
+	results := make([]Result, n)
+
+	var slowest time.Duration
+	for i, m := range s.Members {
+		exprs := flows[i]
+		flow, delay := exprs, time.Duration(0)
+
+		var cycle time.Duration
+		for _, expr := range exprs {
+			cycle += time.Duration(max(expr.Duration, 30)) * time.Millisecond
+		}
+
+		if s.Phase != nil {
+			shift := s.Phase(i, n, cycle)
+			if count == 0 && cycle > 0 {
+				flow = rotateFlow(exprs, time.Duration(int64(shift)%int64(cycle)))
+			} else {
+				delay = shift
+			}
+		}
+
+		params, err := flowParams(m.BrightnessScale, count, action, flow)
+		if err != nil {
+			return nil, err
+		}
+
+		requests[i] = params
+
+		s.mu.Lock()
+		latency := s.latency[m]
+		s.mu.Unlock()
+
+		delays[i] = delay - latency
+		slowest = max(slowest, latency)
+	}
+
+	at := time.Now().Add(slowest + margin)
+
+	var wg sync.WaitGroup
+	for i, m := range s.Members {
+		wg.Add(1)
+
+		go func(i int, m *Config) {
+			defer wg.Done()
+
+			time.Sleep(time.Until(at.Add(delays[i])))
+
+			r, err := s.dispatch(m, requests[i])
+			results[i] = Result{m, r, err}
+		}(i, m)
+	}
+
+	wg.Wait()
+
+	errs := []error{calibration}
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, &MemberError{r.Member, r.Err})
+		}
+	}
+
+	return results, errors.Join(errs...)
+}
+
+func (s *SyncFlow) dispatch(m *Config, params []interface{}) (Response, error) {
+	r, err := m.call("start_cf", params...)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if r.Error != nil {
+		return r, r.Error
+	}
+
+	return r, nil
+}
+
+/*
+rotateFlow returns a looping flow that starts "shift" into the original one. The expression the shift falls into
+is split at the interpolated state, so every loop still passes exactly the same states in the same time.
+*/
+func rotateFlow(exprs []FlowExpression, shift time.Duration) []FlowExpression {
+	flow := make([]FlowExpression, len(exprs))
+	for i, expr := range exprs {
+		expr.Duration = max(expr.Duration, 30)
+		flow[i] = expr
+	}
+
+	offset := int(shift / time.Millisecond)
+	for k, expr := range flow {
+		if offset >= expr.Duration {
+			offset -= expr.Duration
+			continue
+		}
+
+		// Parts shorter than the 30 ms minimum snap to the nearest boundary.
+		if offset < 30 {
+			return append(append([]FlowExpression{}, flow[k:]...), flow[:k]...)
+		}
+
+		if expr.Duration-offset < 30 {
+			next := (k + 1) % len(flow)
+			return append(append([]FlowExpression{}, flow[next:]...), flow[:next]...)
+		}
+
+		previous := flow[(k+len(flow)-1)%len(flow)]
+		f := float64(offset) / float64(expr.Duration)
+
+		head := expr
+		head.Duration = expr.Duration - offset
+
+		tail := interpolate(previous, expr, f)
+		tail.Duration = offset
+
+		rotated := append([]FlowExpression{head}, flow[k+1:]...)
+		rotated = append(rotated, flow[:k]...)
+
+		return append(rotated, tail)
+	}
+
+	return flow
+}
+
+// interpolate gives the state a fraction f of the way from a to b.
+func interpolate(a, b FlowExpression, f float64) FlowExpression {
+	lerp := func(x, y int) int {
+		return int(math.Round(float64(x) + (float64(y)-float64(x))*f))
+	}
+
+	switch {
+	case b.Mode == 7:
+		return FlowExpression{Mode: 7, Value: b.Value, Brightness: b.Brightness}
+	case a.Mode != b.Mode:
+		// Color and temperature don't mix, take the closer one.
+		if f < 0.5 && a.Mode != 7 {
+			return FlowExpression{Mode: a.Mode, Value: a.Value, Brightness: a.Brightness}
+		}
+
+		return FlowExpression{Mode: b.Mode, Value: b.Value, Brightness: b.Brightness}
+	case b.Mode == 1:
+		value := lerp(a.Value>>16&0xff, b.Value>>16&0xff)<<16 |
+			lerp(a.Value>>8&0xff, b.Value>>8&0xff)<<8 |
+			lerp(a.Value&0xff, b.Value&0xff)
+
+		return FlowExpression{Mode: 1, Value: value, Brightness: lerp(a.Brightness, b.Brightness)}
+	default:
+		return FlowExpression{Mode: b.Mode, Value: lerp(a.Value, b.Value), Brightness: lerp(a.Brightness, b.Brightness)}
+	}
+}
@@ -0,0 +1,210 @@
+package yeelight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+Group runs the same operation on every member at the same time. A slow or offline member only costs its own timeout,
+the results are returned per member together with a combined error.
+
+Example:
+
+	g := &yeelight.Group{
+		Members: []*yeelight.Config{&kitchen, &hall, &desk},
+		Timeout: 2 * time.Second,
+	}
+
+	results, err := g.SetPower(true, "smooth", 500)
+	if err != nil {
+		// Some members failed, the others in results are switched on.
+	}
+*/
+type Group struct {
+	Members []*Config
+
+	// How long a member may take to answer, zero means no limit.
+	Timeout time.Duration
+
+	// Stop waiting for the other members as soon as one fails. By default every member is tried (best effort).
+	FailFast bool
+}
+
+// Result is the outcome of an operation on one member.
+type Result struct {
+	Member   *Config
+	Response Response
+	Err      error
+}
+
+// MemberError is the error of one member inside the combined error of a group.
+type MemberError struct {
+	Member *Config
+	Err    error
+}
+
+func (e *MemberError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Member.IpAddress, e.Err)
+}
+
+func (e *MemberError) Unwrap() error {
+	return e.Err
+}
+
+// ErrAborted is the error of members still running when another member failed in a fail fast group.
+var ErrAborted = errors.New("aborted after another member failed")
+
+/*
+This function is used to run any operation on every member. Results are in the order of Members,
+the error joins a MemberError for every failed member. An error object answered by the device counts as a failure.
+fn gets a copy of the member bound to the timeout of the group, see Config.WithContext.
+*/
+func (g *Group) Do(fn func(c *Config) (Response, error)) ([]Result, error) {
+	return g.each(func(i int, c *Config) (Response, error) {
+		return fn(c)
+	})
+}
+
+// each runs Do with the index of the member, for operations that look up something per member.
+func (g *Group) each(fn func(i int, c *Config) (Response, error)) ([]Result, error) {
+	results := make([]Result, len(g.Members))
+
+	// Cancelled when a member fails in a fail fast group, only the calls of this operation give up.
+	ctx, abort := context.WithCancel(context.Background())
+	defer abort()
+
+	var wg sync.WaitGroup
+
+	for i, m := range g.Members {
+		wg.Add(1)
+
+		go func(i int, m *Config) {
+			defer wg.Done()
+
+			r, err := g.run(ctx, m, func(c *Config) (Response, error) { return fn(i, c) })
+			if err != nil && errors.Is(err, context.Canceled) {
+				err = ErrAborted
+			}
+			results[i] = Result{m, r, err}
+
+			if err != nil && g.FailFast {
+				abort()
+			}
+		}(i, m)
+	}
+
+	wg.Wait()
+
+	var errs []error
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, &MemberError{r.Member, r.Err})
+		}
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// run calls fn with a copy of the member bound to the timeout of the group, the shared connection is left as it is.
+func (g *Group) run(ctx context.Context, m *Config, fn func(c *Config) (Response, error)) (Response, error) {
+	if m.conn == nil {
+		return Response{}, fmt.Errorf("not connected")
+	}
+
+	if g.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.Timeout)
+		defer cancel()
+	}
+
+	r, err := fn(m.WithContext(ctx))
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return r, fmt.Errorf("no answer within %v", g.Timeout)
+		}
+
+		return r, err
+	}
+
+	if r.Error != nil {
+		return r, r.Error
+	}
+
+	return r, nil
+}
+
+/*
+This function is used to switch every member on or off, see Config.SetPower.
+*/
+func (g *Group) SetPower(power bool, effect string, duration int) ([]Result, error) {
+	return g.Do(func(c *Config) (Response, error) {
+		return c.SetPower(power, effect, duration)
+	})
+}
+
+/*
+This function is used to change the brightness of every member, see Config.SetBright.
+*/
+func (g *Group) SetBright(brightness int, effect string, duration int) ([]Result, error) {
+	return g.Do(func(c *Config) (Response, error) {
+		return c.SetBright(brightness, effect, duration)
+	})
+}
+
+/*
+This function is used to change the color of every member, see Config.SetRGB.
+*/
+func (g *Group) SetRGB(red int, green int, blue int, effect string, duration int) ([]Result, error) {
+	return g.Do(func(c *Config) (Response, error) {
+		return c.SetRGB(red, green, blue, effect, duration)
+	})
+}
+
+/*
+This function is used to change the color temperature of every member, see Config.SetColorTemp.
+*/
+func (g *Group) SetColorTemp(temp int, effect string, duration int) ([]Result, error) {
+	return g.Do(func(c *Config) (Response, error) {
+		return c.SetColorTemp(temp, effect, duration)
+	})
+}
+
+/*
+This function is used to change the hue and saturation of every member, see Config.SetHueSaturation.
+*/
+func (g *Group) SetHueSaturation(hue int, sat int, effect string, duration int) ([]Result, error) {
+	return g.Do(func(c *Config) (Response, error) {
+		return c.SetHueSaturation(hue, sat, effect, duration)
+	})
+}
+
+/*
+This function is used to set the same scene on every member, see Config.SetScene.
+*/
+func (g *Group) SetScene(scene Scene) ([]Result, error) {
+	return g.Do(func(c *Config) (Response, error) {
+		return c.SetScene(scene)
+	})
+}
+
+/*
+This function is used to start the same color flow on every member, see Config.SetColorFlow.
+*/
+func (g *Group) SetColorFlow(count, action int, exprs []FlowExpression) ([]Result, error) {
+	return g.Do(func(c *Config) (Response, error) {
+		return c.SetColorFlow(count, action, exprs)
+	})
+}
+
+/*
+This function is used to stop the color flow of every member, see Config.StopColorFlow.
+*/
+func (g *Group) StopColorFlow() ([]Result, error) {
+	return g.Do(func(c *Config) (Response, error) {
+		return c.StopColorFlow()
+	})
+}
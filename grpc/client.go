@@ -0,0 +1,199 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+/*
+Client calls the service over unencrypted HTTP/2, for Go programs that don't want to depend on a gRPC library.
+Clients generated from yeelight.proto work just as well. Errors of calls are *Status.
+
+Example:
+
+	c := grpc.NewClient("192.168.1.10:50051")
+	defer c.Close()
+
+	var res grpc.CommandResponse
+	err := c.Invoke(ctx, "SetPower", &grpc.SetPowerRequest{Device: "desk", On: true}, &res)
+*/
+type Client struct {
+	target string
+	http   *http.Client
+}
+
+/*
+This function is used to create a client of the server at addr, host:port. It connects on the first call.
+*/
+func NewClient(addr string) *Client {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+
+	return &Client{
+		target: "http://" + addr,
+		http:   &http.Client{Transport: &http.Transport{Protocols: &protocols}},
+	}
+}
+
+/*
+This function is used to close the idle connection to the server.
+*/
+func (c *Client) Close() {
+	c.http.CloseIdleConnections()
+}
+
+/*
+This function is used to call a unary method by its name, like "SetPower", and read its response into out.
+*/
+func (c *Client) Invoke(ctx context.Context, method string, in, out Message) error {
+	res, err := c.call(ctx, method, in)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	payload, err := readMessage(res.Body)
+	if err != nil && err != io.EOF {
+		return transportError(err)
+	}
+
+	// The status comes after the message.
+	io.Copy(io.Discard, res.Body)
+
+	if err := responseStatus(res); err != nil {
+		return err
+	}
+
+	if payload == nil {
+		return errorf(Internal, "%s answered without a message", method)
+	}
+
+	return out.Unmarshal(payload)
+}
+
+// WatchStream is a running Watch call.
+type WatchStream struct {
+	res *http.Response
+}
+
+/*
+This function is used to start streaming the changes of devices, see Recv. The stream ends with the context.
+*/
+func (c *Client) Watch(ctx context.Context, req *WatchRequest) (*WatchStream, error) {
+	res, err := c.call(ctx, "Watch", req)
+	if err != nil {
+		return nil, err
+	}
+
+	// A status in the headers means the call failed before it started.
+	if res.Header.Get("Grpc-Status") != "" {
+		defer res.Body.Close()
+
+		if err := responseStatus(res); err != nil {
+			return nil, err
+		}
+
+		return nil, errorf(Internal, "Watch ended before it started")
+	}
+
+	return &WatchStream{res: res}, nil
+}
+
+/*
+This function is used to wait for the next change, io.EOF when the server ended the stream.
+*/
+func (w *WatchStream) Recv() (*Event, error) {
+	payload, err := readMessage(w.res.Body)
+	if err == io.EOF {
+		if err := responseStatus(w.res); err != nil {
+			return nil, err
+		}
+
+		return nil, io.EOF
+	}
+
+	if err != nil {
+		return nil, transportError(err)
+	}
+
+	var e Event
+
+	return &e, e.Unmarshal(payload)
+}
+
+/*
+This function is used to stop the stream.
+*/
+func (w *WatchStream) Close() error {
+	return w.res.Body.Close()
+}
+
+func (c *Client) call(ctx context.Context, method string, in Message) (*http.Response, error) {
+	payload := in.Marshal()
+
+	body := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(payload)))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.target+"/"+Service+"/"+method, bytes.NewReader(append(body, payload...)))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("Te", "trailers")
+
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", fmt.Sprintf("%dm", max(1, time.Until(deadline).Milliseconds())))
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, transportError(err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, errorf(Unknown, "unexpected HTTP status %s", res.Status)
+	}
+
+	return res, nil
+}
+
+// responseStatus reads the status of a finished response, from the trailers or the headers of a response without body.
+func responseStatus(res *http.Response) error {
+	value, message := res.Trailer.Get("Grpc-Status"), res.Trailer.Get("Grpc-Message")
+	if value == "" {
+		value, message = res.Header.Get("Grpc-Status"), res.Header.Get("Grpc-Message")
+	}
+
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		return errorf(Internal, "response without a valid grpc-status %q", value)
+	}
+
+	if code == int(OK) {
+		return nil
+	}
+
+	if decoded, err := url.PathUnescape(message); err == nil {
+		message = decoded
+	}
+
+	return &Status{Code: Code(code), Message: message}
+}
+
+// transportError is a failed request or response, Unavailable unless the context ended.
+func transportError(err error) *Status {
+	if s := statusOf(err); s.Code == Canceled || s.Code == DeadlineExceeded {
+		return s
+	}
+
+	return &Status{Code: Unavailable, Message: err.Error()}
+}
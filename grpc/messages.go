@@ -0,0 +1,669 @@
+package grpc
+
+import (
+	"time"
+
+	"github.com/LordAur/yeelight"
+)
+
+// Message is a protobuf message of yeelight.proto, field numbers follow the definition there.
+type Message interface {
+	Marshal() []byte
+	Unmarshal(b []byte) error
+}
+
+type ListDevicesRequest struct{}
+
+type ListDevicesResponse struct {
+	Devices []yeelight.Device
+}
+
+type DiscoverRequest struct {
+	// Sent in milliseconds, default 3 seconds.
+	Timeout time.Duration
+}
+
+type DeviceRequest struct {
+	Device string
+}
+
+type State struct {
+	Device     yeelight.Device
+	Properties yeelight.Properties
+}
+
+type SetPowerRequest struct {
+	Device   string
+	On       bool
+	Effect   string
+	Duration int
+}
+
+type SetBrightRequest struct {
+	Device   string
+	Bright   int
+	Effect   string
+	Duration int
+}
+
+type SetRGBRequest struct {
+	Device   string
+	Rgb      int
+	Effect   string
+	Duration int
+}
+
+type SetHueSaturationRequest struct {
+	Device   string
+	Hue      int
+	Sat      int
+	Effect   string
+	Duration int
+}
+
+type SetColorTempRequest struct {
+	Device           string
+	ColorTemperature int
+	Effect           string
+	Duration         int
+}
+
+type StartColorFlowRequest struct {
+	Device string
+	Count  int
+	Action int
+	Flow   []yeelight.FlowExpression
+}
+
+type SetSceneRequest struct {
+	Device string
+	Scene  yeelight.Scene
+}
+
+type SetAdjustRequest struct {
+	Device string
+	Action string
+	Prop   string
+}
+
+type AdjustRequest struct {
+	Device     string
+	Percentage int
+	Duration   int
+}
+
+type SetNameRequest struct {
+	Device string
+	Name   string
+}
+
+type CronAddRequest struct {
+	Device  string
+	Minutes int
+}
+
+type CommandResponse struct {
+	Result []string
+}
+
+type WatchRequest struct {
+	Devices    []string
+	Properties []string
+}
+
+type Event struct {
+	Device   string
+	Property string
+	Old      string
+	New      string
+	Time     time.Time
+}
+
+func (m *ListDevicesRequest) Marshal() []byte {
+	return nil
+}
+
+func (m *ListDevicesRequest) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error { return nil })
+}
+
+func (m *ListDevicesResponse) Marshal() []byte {
+	var b []byte
+	for _, d := range m.Devices {
+		b = appendBytes(b, 1, marshalDevice(d))
+	}
+
+	return b
+}
+
+func (m *ListDevicesResponse) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		if f.number == 1 {
+			d, err := unmarshalDevice(f.bytes)
+			if err != nil {
+				return err
+			}
+
+			m.Devices = append(m.Devices, d)
+		}
+
+		return nil
+	})
+}
+
+func (m *DiscoverRequest) Marshal() []byte {
+	return appendInt(nil, 1, m.Timeout.Milliseconds())
+}
+
+func (m *DiscoverRequest) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		if f.number == 1 {
+			m.Timeout = time.Duration(f.int32()) * time.Millisecond
+		}
+
+		return nil
+	})
+}
+
+func (m *DeviceRequest) Marshal() []byte {
+	return appendString(nil, 1, m.Device)
+}
+
+func (m *DeviceRequest) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		if f.number == 1 {
+			m.Device = f.string()
+		}
+
+		return nil
+	})
+}
+
+func (m *State) Marshal() []byte {
+	b := appendBytes(nil, 1, marshalDevice(m.Device))
+	for k, v := range m.Properties.Values {
+		b = appendBytes(b, 2, appendString(appendString(nil, 1, k), 2, v))
+	}
+
+	return appendTime(b, 3, m.Properties.Updated)
+}
+
+func (m *State) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		var err error
+
+		switch f.number {
+		case 1:
+			m.Device, err = unmarshalDevice(f.bytes)
+		case 2:
+			var k, v string
+			err = decode(f.bytes, func(f field) error {
+				switch f.number {
+				case 1:
+					k = f.string()
+				case 2:
+					v = f.string()
+				}
+
+				return nil
+			})
+
+			if m.Properties.Values == nil {
+				m.Properties.Values = map[string]string{}
+			}
+
+			if err == nil {
+				m.Properties.Values[k] = v
+			}
+		case 3:
+			m.Properties.Updated, err = decodeTime(f.bytes)
+		}
+
+		return err
+	})
+}
+
+func (m *SetPowerRequest) Marshal() []byte {
+	b := appendString(nil, 1, m.Device)
+	b = appendBool(b, 2, m.On)
+	b = appendString(b, 3, m.Effect)
+
+	return appendInt(b, 4, int64(m.Duration))
+}
+
+func (m *SetPowerRequest) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		switch f.number {
+		case 1:
+			m.Device = f.string()
+		case 2:
+			m.On = f.varint != 0
+		case 3:
+			m.Effect = f.string()
+		case 4:
+			m.Duration = f.int()
+		}
+
+		return nil
+	})
+}
+
+func (m *SetBrightRequest) Marshal() []byte {
+	b := appendString(nil, 1, m.Device)
+	b = appendInt(b, 2, int64(m.Bright))
+	b = appendString(b, 3, m.Effect)
+
+	return appendInt(b, 4, int64(m.Duration))
+}
+
+func (m *SetBrightRequest) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		switch f.number {
+		case 1:
+			m.Device = f.string()
+		case 2:
+			m.Bright = f.int()
+		case 3:
+			m.Effect = f.string()
+		case 4:
+			m.Duration = f.int()
+		}
+
+		return nil
+	})
+}
+
+func (m *SetRGBRequest) Marshal() []byte {
+	b := appendString(nil, 1, m.Device)
+	b = appendInt(b, 2, int64(uint32(m.Rgb)))
+	b = appendString(b, 3, m.Effect)
+
+	return appendInt(b, 4, int64(m.Duration))
+}
+
+func (m *SetRGBRequest) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		switch f.number {
+		case 1:
+			m.Device = f.string()
+		case 2:
+			m.Rgb = int(uint32(f.varint))
+		case 3:
+			m.Effect = f.string()
+		case 4:
+			m.Duration = f.int()
+		}
+
+		return nil
+	})
+}
+
+func (m *SetHueSaturationRequest) Marshal() []byte {
+	b := appendString(nil, 1, m.Device)
+	b = appendInt(b, 2, int64(m.Hue))
+	b = appendInt(b, 3, int64(m.Sat))
+	b = appendString(b, 4, m.Effect)
+
+	return appendInt(b, 5, int64(m.Duration))
+}
+
+func (m *SetHueSaturationRequest) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		switch f.number {
+		case 1:
+			m.Device = f.string()
+		case 2:
+			m.Hue = f.int()
+		case 3:
+			m.Sat = f.int()
+		case 4:
+			m.Effect = f.string()
+		case 5:
+			m.Duration = f.int()
+		}
+
+		return nil
+	})
+}
+
+func (m *SetColorTempRequest) Marshal() []byte {
+	b := appendString(nil, 1, m.Device)
+	b = appendInt(b, 2, int64(m.ColorTemperature))
+	b = appendString(b, 3, m.Effect)
+
+	return appendInt(b, 4, int64(m.Duration))
+}
+
+func (m *SetColorTempRequest) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		switch f.number {
+		case 1:
+			m.Device = f.string()
+		case 2:
+			m.ColorTemperature = f.int()
+		case 3:
+			m.Effect = f.string()
+		case 4:
+			m.Duration = f.int()
+		}
+
+		return nil
+	})
+}
+
+func (m *StartColorFlowRequest) Marshal() []byte {
+	b := appendString(nil, 1, m.Device)
+	b = appendInt(b, 2, int64(m.Count))
+	b = appendInt(b, 3, int64(m.Action))
+	for _, e := range m.Flow {
+		b = appendBytes(b, 4, marshalFlowExpression(e))
+	}
+
+	return b
+}
+
+func (m *StartColorFlowRequest) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		switch f.number {
+		case 1:
+			m.Device = f.string()
+		case 2:
+			m.Count = f.int()
+		case 3:
+			m.Action = f.int()
+		case 4:
+			e, err := unmarshalFlowExpression(f.bytes)
+			if err != nil {
+				return err
+			}
+
+			m.Flow = append(m.Flow, e)
+		}
+
+		return nil
+	})
+}
+
+func (m *SetSceneRequest) Marshal() []byte {
+	b := appendString(nil, 1, m.Device)
+
+	return appendBytes(b, 2, marshalScene(m.Scene))
+}
+
+func (m *SetSceneRequest) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		var err error
+
+		switch f.number {
+		case 1:
+			m.Device = f.string()
+		case 2:
+			m.Scene, err = unmarshalScene(f.bytes)
+		}
+
+		return err
+	})
+}
+
+func (m *SetAdjustRequest) Marshal() []byte {
+	b := appendString(nil, 1, m.Device)
+	b = appendString(b, 2, m.Action)
+
+	return appendString(b, 3, m.Prop)
+}
+
+func (m *SetAdjustRequest) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		switch f.number {
+		case 1:
+			m.Device = f.string()
+		case 2:
+			m.Action = f.string()
+		case 3:
+			m.Prop = f.string()
+		}
+
+		return nil
+	})
+}
+
+func (m *AdjustRequest) Marshal() []byte {
+	b := appendString(nil, 1, m.Device)
+	b = appendInt(b, 2, int64(m.Percentage))
+
+	return appendInt(b, 3, int64(m.Duration))
+}
+
+func (m *AdjustRequest) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		switch f.number {
+		case 1:
+			m.Device = f.string()
+		case 2:
+			m.Percentage = f.int()
+		case 3:
+			m.Duration = f.int()
+		}
+
+		return nil
+	})
+}
+
+func (m *SetNameRequest) Marshal() []byte {
+	b := appendString(nil, 1, m.Device)
+
+	return appendString(b, 2, m.Name)
+}
+
+func (m *SetNameRequest) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		switch f.number {
+		case 1:
+			m.Device = f.string()
+		case 2:
+			m.Name = f.string()
+		}
+
+		return nil
+	})
+}
+
+func (m *CronAddRequest) Marshal() []byte {
+	b := appendString(nil, 1, m.Device)
+
+	return appendInt(b, 2, int64(m.Minutes))
+}
+
+func (m *CronAddRequest) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		switch f.number {
+		case 1:
+			m.Device = f.string()
+		case 2:
+			m.Minutes = f.int()
+		}
+
+		return nil
+	})
+}
+
+func (m *CommandResponse) Marshal() []byte {
+	return appendStrings(nil, 1, m.Result)
+}
+
+func (m *CommandResponse) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		if f.number == 1 {
+			m.Result = append(m.Result, f.string())
+		}
+
+		return nil
+	})
+}
+
+func (m *WatchRequest) Marshal() []byte {
+	b := appendStrings(nil, 1, m.Devices)
+
+	return appendStrings(b, 2, m.Properties)
+}
+
+func (m *WatchRequest) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		switch f.number {
+		case 1:
+			m.Devices = append(m.Devices, f.string())
+		case 2:
+			m.Properties = append(m.Properties, f.string())
+		}
+
+		return nil
+	})
+}
+
+func (m *Event) Marshal() []byte {
+	b := appendString(nil, 1, m.Device)
+	b = appendString(b, 2, m.Property)
+	b = appendString(b, 3, m.Old)
+	b = appendString(b, 4, m.New)
+
+	return appendTime(b, 5, m.Time)
+}
+
+func (m *Event) Unmarshal(b []byte) error {
+	return decode(b, func(f field) error {
+		var err error
+
+		switch f.number {
+		case 1:
+			m.Device = f.string()
+		case 2:
+			m.Property = f.string()
+		case 3:
+			m.Old = f.string()
+		case 4:
+			m.New = f.string()
+		case 5:
+			m.Time, err = decodeTime(f.bytes)
+		}
+
+		return err
+	})
+}
+
+func marshalDevice(d yeelight.Device) []byte {
+	b := appendString(nil, 1, d.ID)
+	b = appendString(b, 2, d.IpAddress)
+	b = appendInt(b, 3, int64(d.Port))
+	b = appendString(b, 4, d.Model)
+	b = appendInt(b, 5, int64(d.FirmwareVersion))
+	b = appendStrings(b, 6, d.Support)
+
+	return appendString(b, 7, d.Name)
+}
+
+func unmarshalDevice(b []byte) (yeelight.Device, error) {
+	var d yeelight.Device
+
+	err := decode(b, func(f field) error {
+		switch f.number {
+		case 1:
+			d.ID = f.string()
+		case 2:
+			d.IpAddress = f.string()
+		case 3:
+			d.Port = f.int()
+		case 4:
+			d.Model = f.string()
+		case 5:
+			d.FirmwareVersion = f.int()
+		case 6:
+			d.Support = append(d.Support, f.string())
+		case 7:
+			d.Name = f.string()
+		}
+
+		return nil
+	})
+
+	return d, err
+}
+
+func marshalFlowExpression(e yeelight.FlowExpression) []byte {
+	b := appendInt(nil, 1, int64(e.Duration))
+	b = appendInt(b, 2, int64(e.Mode))
+	b = appendInt(b, 3, int64(e.Value))
+
+	return appendInt(b, 4, int64(e.Brightness))
+}
+
+func unmarshalFlowExpression(b []byte) (yeelight.FlowExpression, error) {
+	var e yeelight.FlowExpression
+
+	err := decode(b, func(f field) error {
+		switch f.number {
+		case 1:
+			e.Duration = f.int()
+		case 2:
+			e.Mode = f.int()
+		case 3:
+			e.Value = f.int()
+		case 4:
+			e.Brightness = f.int()
+		}
+
+		return nil
+	})
+
+	return e, err
+}
+
+func marshalScene(s yeelight.Scene) []byte {
+	b := appendString(nil, 1, s.Action)
+	b = appendInt(b, 2, int64(s.Color))
+	b = appendInt(b, 3, int64(s.ColorTemperature))
+	b = appendInt(b, 4, int64(s.Hue))
+	b = appendInt(b, 5, int64(s.Saturation))
+	for _, e := range s.ColorFlow {
+		b = appendBytes(b, 6, marshalFlowExpression(e))
+	}
+	b = appendInt(b, 7, int64(s.Mode))
+	b = appendInt(b, 8, int64(s.Brightness))
+
+	return appendInt(b, 9, int64(s.Duration))
+}
+
+func unmarshalScene(b []byte) (yeelight.Scene, error) {
+	var s yeelight.Scene
+
+	err := decode(b, func(f field) error {
+		switch f.number {
+		case 1:
+			s.Action = f.string()
+		case 2:
+			s.Color = f.int()
+		case 3:
+			s.ColorTemperature = f.int()
+		case 4:
+			s.Hue = f.int()
+		case 5:
+			s.Saturation = f.int()
+		case 6:
+			e, err := unmarshalFlowExpression(f.bytes)
+			if err != nil {
+				return err
+			}
+
+			s.ColorFlow = append(s.ColorFlow, e)
+		case 7:
+			s.Mode = f.int()
+		case 8:
+			s.Brightness = f.int()
+		case 9:
+			s.Duration = f.int()
+		}
+
+		return nil
+	})
+
+	return s, err
+}
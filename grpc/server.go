@@ -0,0 +1,515 @@
+/*
+Package grpc serves the lamps of a registry as the gRPC service of yeelight.proto, for clients in any language.
+The protocol is implemented on net/http: the server speaks HTTP/2 over TLS or, with unencrypted HTTP/2 enabled,
+in plain text like most gRPC clients expect on a LAN. Messages are not compressed.
+
+Every command of the library is a unary call, Watch streams the property changes of the lamps. Errors of the library
+are mapped to status codes, see yeelight.proto.
+
+Example:
+
+	registry, err := yeelight.NewRegistry("devices.json")
+	if err != nil {
+		...
+	}
+
+	go registry.Watch(ctx, time.Minute)
+
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+
+	srv := &http.Server{Addr: ":50051", Handler: &grpc.Server{Registry: registry}, Protocols: &protocols}
+	srv.ListenAndServe()
+*/
+package grpc
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LordAur/yeelight"
+)
+
+// Service is the full name of the service, methods are served at /yeelight.v1.Yeelight/<method>.
+const Service = "yeelight.v1.Yeelight"
+
+// Messages are limited to 4 MB like the gRPC default.
+const maxMessage = 4 << 20
+
+type Server struct {
+	Registry *yeelight.Registry
+
+	once    sync.Once
+	methods map[string]method
+}
+
+// method reads its request with read and answers a message or an error mapped by statusOf. The lamp commands it
+// sends give up when ctx is done.
+type method func(ctx context.Context, read func(Message) error) (Message, error)
+
+func (s *Server) routes() {
+	s.methods = map[string]method{
+		"ListDevices": func(ctx context.Context, read func(Message) error) (Message, error) {
+			if err := read(&ListDevicesRequest{}); err != nil {
+				return nil, err
+			}
+
+			return &ListDevicesResponse{Devices: s.Registry.Devices()}, nil
+		},
+		"Discover": func(ctx context.Context, read func(Message) error) (Message, error) {
+			var req DiscoverRequest
+			if err := read(&req); err != nil {
+				return nil, err
+			}
+
+			if req.Timeout <= 0 {
+				req.Timeout = 3 * time.Second
+			}
+
+			devices, err := yeelight.Search(req.Timeout)
+			if err != nil {
+				return nil, errorf(Unavailable, "search: %v", err)
+			}
+
+			for _, d := range devices {
+				s.Registry.Update(d)
+			}
+
+			return &ListDevicesResponse{Devices: devices}, nil
+		},
+		"GetState": func(ctx context.Context, read func(Message) error) (Message, error) {
+			var req DeviceRequest
+			if err := read(&req); err != nil {
+				return nil, err
+			}
+
+			d, c, err := s.lookup(req.Device)
+			if err != nil {
+				return nil, err
+			}
+
+			p, err := c.WithContext(ctx).Properties()
+			if err != nil {
+				return nil, err
+			}
+
+			return &State{Device: d, Properties: p}, nil
+		},
+		"SetPower": func(ctx context.Context, read func(Message) error) (Message, error) {
+			var req SetPowerRequest
+			if err := read(&req); err != nil {
+				return nil, err
+			}
+
+			effect, duration := transition(req.Effect, req.Duration)
+
+			return s.command(ctx, req.Device, func(c *yeelight.Config) (yeelight.Response, error) {
+				return c.SetPower(req.On, effect, duration)
+			})
+		},
+		"Toggle": s.simple((*yeelight.Config).Toggle),
+		"SetBright": func(ctx context.Context, read func(Message) error) (Message, error) {
+			var req SetBrightRequest
+			if err := read(&req); err != nil {
+				return nil, err
+			}
+
+			effect, duration := transition(req.Effect, req.Duration)
+
+			return s.command(ctx, req.Device, func(c *yeelight.Config) (yeelight.Response, error) {
+				return c.SetBright(req.Bright, effect, duration)
+			})
+		},
+		"SetRGB": func(ctx context.Context, read func(Message) error) (Message, error) {
+			var req SetRGBRequest
+			if err := read(&req); err != nil {
+				return nil, err
+			}
+
+			if req.Rgb > 0xFFFFFF {
+				return nil, errorf(InvalidArgument, "rgb should be in range 0 ~ 0xFFFFFF")
+			}
+
+			effect, duration := transition(req.Effect, req.Duration)
+
+			return s.command(ctx, req.Device, func(c *yeelight.Config) (yeelight.Response, error) {
+				return c.SetRGB(req.Rgb>>16, req.Rgb>>8&0xFF, req.Rgb&0xFF, effect, duration)
+			})
+		},
+		"SetHueSaturation": func(ctx context.Context, read func(Message) error) (Message, error) {
+			var req SetHueSaturationRequest
+			if err := read(&req); err != nil {
+				return nil, err
+			}
+
+			effect, duration := transition(req.Effect, req.Duration)
+
+			return s.command(ctx, req.Device, func(c *yeelight.Config) (yeelight.Response, error) {
+				return c.SetHueSaturation(req.Hue, req.Sat, effect, duration)
+			})
+		},
+		"SetColorTemp": func(ctx context.Context, read func(Message) error) (Message, error) {
+			var req SetColorTempRequest
+			if err := read(&req); err != nil {
+				return nil, err
+			}
+
+			effect, duration := transition(req.Effect, req.Duration)
+
+			return s.command(ctx, req.Device, func(c *yeelight.Config) (yeelight.Response, error) {
+				return c.SetColorTemp(req.ColorTemperature, effect, duration)
+			})
+		},
+		"SetDefault": s.simple((*yeelight.Config).SetDefault),
+		"StartColorFlow": func(ctx context.Context, read func(Message) error) (Message, error) {
+			var req StartColorFlowRequest
+			if err := read(&req); err != nil {
+				return nil, err
+			}
+
+			flow := yeelight.Scene{Action: "cf", Duration: req.Count, Mode: req.Action, ColorFlow: req.Flow}
+			if err := yeelight.ValidateScene(flow); err != nil {
+				return nil, err
+			}
+
+			return s.command(ctx, req.Device, func(c *yeelight.Config) (yeelight.Response, error) {
+				return c.SetColorFlow(req.Count, req.Action, req.Flow)
+			})
+		},
+		"StopColorFlow": s.simple((*yeelight.Config).StopColorFlow),
+		"SetScene": func(ctx context.Context, read func(Message) error) (Message, error) {
+			var req SetSceneRequest
+			if err := read(&req); err != nil {
+				return nil, err
+			}
+
+			if err := yeelight.ValidateScene(req.Scene); err != nil {
+				return nil, err
+			}
+
+			return s.command(ctx, req.Device, func(c *yeelight.Config) (yeelight.Response, error) {
+				return c.SetScene(req.Scene)
+			})
+		},
+		"SetAdjust": func(ctx context.Context, read func(Message) error) (Message, error) {
+			var req SetAdjustRequest
+			if err := read(&req); err != nil {
+				return nil, err
+			}
+
+			return s.command(ctx, req.Device, func(c *yeelight.Config) (yeelight.Response, error) {
+				return c.SetAdjust(req.Action, req.Prop)
+			})
+		},
+		"AdjustBright": func(ctx context.Context, read func(Message) error) (Message, error) {
+			var req AdjustRequest
+			if err := read(&req); err != nil {
+				return nil, err
+			}
+
+			return s.command(ctx, req.Device, func(c *yeelight.Config) (yeelight.Response, error) {
+				return c.AdjustBright(req.Percentage, req.Duration)
+			})
+		},
+		"AdjustColorTemp": func(ctx context.Context, read func(Message) error) (Message, error) {
+			var req AdjustRequest
+			if err := read(&req); err != nil {
+				return nil, err
+			}
+
+			return s.command(ctx, req.Device, func(c *yeelight.Config) (yeelight.Response, error) {
+				return c.AdjustColorTemperature(req.Percentage, req.Duration)
+			})
+		},
+		"SetName": func(ctx context.Context, read func(Message) error) (Message, error) {
+			var req SetNameRequest
+			if err := read(&req); err != nil {
+				return nil, err
+			}
+
+			return s.command(ctx, req.Device, func(c *yeelight.Config) (yeelight.Response, error) {
+				return c.SetName(req.Name)
+			})
+		},
+		"CronAdd": func(ctx context.Context, read func(Message) error) (Message, error) {
+			var req CronAddRequest
+			if err := read(&req); err != nil {
+				return nil, err
+			}
+
+			if req.Minutes < 1 {
+				return nil, errorf(InvalidArgument, "minutes should be at least 1")
+			}
+
+			return s.command(ctx, req.Device, func(c *yeelight.Config) (yeelight.Response, error) {
+				return c.CronAdd(req.Minutes)
+			})
+		},
+		"CronGet":    s.simple((*yeelight.Config).CronGet),
+		"CronDelete": s.simple((*yeelight.Config).CronDelete),
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.once.Do(s.routes)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "gRPC calls are POST requests", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "expected content type application/grpc", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	ctx := r.Context()
+	if timeout, ok := parseTimeout(r.Header.Get("Grpc-Timeout")); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	st := &stream{w: w}
+	w.Header().Set("Content-Type", "application/grpc+proto")
+
+	if r.Header.Get("Grpc-Encoding") != "" && r.Header.Get("Grpc-Encoding") != "identity" {
+		st.finish(errorf(Unimplemented, "compression %s is not supported", r.Header.Get("Grpc-Encoding")))
+		return
+	}
+
+	// Every method takes one request message, it is read here as the body can't be read once the handler returned.
+	payload, err := readMessage(r.Body)
+	if err != nil {
+		st.finish(errorf(Internal, "reading request: %v", err))
+		return
+	}
+
+	read := func(m Message) error {
+		if err := m.Unmarshal(payload); err != nil {
+			return errorf(Internal, "decoding request: %v", err)
+		}
+
+		return nil
+	}
+
+	service, name, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if !ok || service != Service {
+		st.finish(errorf(Unimplemented, "unknown service %s", service))
+		return
+	}
+
+	if name == "Watch" {
+		st.finish(s.watch(ctx, st, read))
+		return
+	}
+
+	m, ok := s.methods[name]
+	if !ok {
+		st.finish(errorf(Unimplemented, "unknown method %s", name))
+		return
+	}
+
+	res, err := m(ctx, read)
+	if err == nil {
+		err = st.send(res)
+	}
+
+	st.finish(err)
+}
+
+/*
+This function is used to find a device by ID or by name, like the HTTP server does.
+*/
+func (s *Server) lookup(idOrName string) (yeelight.Device, *yeelight.Config, error) {
+	d, ok := s.Registry.Device(idOrName)
+	if !ok {
+		for _, candidate := range s.Registry.Devices() {
+			if strings.EqualFold(candidate.Name, idOrName) {
+				d, ok = candidate, true
+				break
+			}
+		}
+	}
+
+	if !ok {
+		return yeelight.Device{}, nil, errorf(NotFound, "device %s is unknown", idOrName)
+	}
+
+	c, err := s.Registry.Get(d.ID)
+	if err != nil {
+		return yeelight.Device{}, nil, errorf(NotFound, "%v", err)
+	}
+
+	return d, c, nil
+}
+
+/*
+command runs fn on a device and answers its result, an error answered by the lamp is an error of the call.
+The command is sent with ctx, past the deadline of the call it is not sent anymore.
+*/
+func (s *Server) command(ctx context.Context, device string, fn func(c *yeelight.Config) (yeelight.Response, error)) (Message, error) {
+	_, c, err := s.lookup(device)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := fn(c.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	result := make([]string, len(res.Result))
+	for i, v := range res.Result {
+		if text, ok := v.(string); ok {
+			result[i] = text
+			continue
+		}
+
+		data, _ := json.Marshal(v)
+		result[i] = string(data)
+	}
+
+	return &CommandResponse{Result: result}, nil
+}
+
+// simple is a command without parameters.
+func (s *Server) simple(fn func(c *yeelight.Config) (yeelight.Response, error)) method {
+	return func(ctx context.Context, read func(Message) error) (Message, error) {
+		var req DeviceRequest
+		if err := read(&req); err != nil {
+			return nil, err
+		}
+
+		return s.command(ctx, req.Device, fn)
+	}
+}
+
+// transition fills in a smooth transition of 300 milliseconds when the request has no effect.
+func transition(effect string, duration int) (string, int) {
+	if effect == "" {
+		if duration == 0 {
+			return "smooth", 300
+		}
+
+		return "smooth", duration
+	}
+
+	return effect, duration
+}
+
+// stream writes the messages of a response and its status, as trailers or in the headers when nothing was sent.
+type stream struct {
+	w     http.ResponseWriter
+	wrote bool
+}
+
+func (st *stream) send(m Message) error {
+	payload := m.Marshal()
+
+	frame := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+
+	st.start()
+
+	if _, err := st.w.Write(append(frame, payload...)); err != nil {
+		return err
+	}
+
+	st.flush()
+
+	return nil
+}
+
+// start sends the headers, the status goes to the trailers from now on.
+func (st *stream) start() {
+	if !st.wrote {
+		st.w.WriteHeader(http.StatusOK)
+		st.wrote = true
+	}
+}
+
+func (st *stream) flush() {
+	if f, ok := st.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (st *stream) finish(err error) {
+	status := &Status{Code: OK}
+	if err != nil {
+		status = statusOf(err)
+	}
+
+	prefix := http.TrailerPrefix
+	if !st.wrote {
+		prefix = ""
+	}
+
+	st.w.Header().Set(prefix+"Grpc-Status", strconv.Itoa(int(status.Code)))
+	if status.Message != "" {
+		st.w.Header().Set(prefix+"Grpc-Message", encodeMessage(status.Message))
+	}
+
+	if !st.wrote {
+		st.w.WriteHeader(http.StatusOK)
+	}
+}
+
+// readMessage reads one length prefixed message.
+func readMessage(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	if header[0] != 0 {
+		return nil, fmt.Errorf("compressed messages are not supported")
+	}
+
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > maxMessage {
+		return nil, fmt.Errorf("message of %d bytes is larger than %d", length, maxMessage)
+	}
+
+	payload := make([]byte, length)
+	_, err := io.ReadFull(r, payload)
+
+	return payload, err
+}
+
+// parseTimeout reads grpc-timeout, up to 8 digits and a unit.
+func parseTimeout(s string) (time.Duration, bool) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, false
+	}
+
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+
+	unit, ok := units[s[len(s)-1]]
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if !ok || err != nil || n < 0 {
+		return 0, false
+	}
+
+	return time.Duration(n) * unit, true
+}
@@ -0,0 +1,93 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/LordAur/yeelight"
+)
+
+// Code is a gRPC status code, only the ones the service answers with are named.
+type Code int
+
+const (
+	OK                 Code = 0
+	Canceled           Code = 1
+	Unknown            Code = 2
+	InvalidArgument    Code = 3
+	DeadlineExceeded   Code = 4
+	NotFound           Code = 5
+	ResourceExhausted  Code = 8
+	FailedPrecondition Code = 9
+	Unimplemented      Code = 12
+	Internal           Code = 13
+	Unavailable        Code = 14
+)
+
+// Status is the error of a call, sent in the grpc-status and grpc-message trailers.
+type Status struct {
+	Code    Code
+	Message string
+}
+
+func (s *Status) Error() string {
+	return fmt.Sprintf("rpc error: code %d: %s", s.Code, s.Message)
+}
+
+func errorf(code Code, format string, args ...interface{}) *Status {
+	return &Status{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+/*
+statusOf maps an error of the library to a status. A lamp that can't be reached is Unavailable, an error answered
+by the lamp depends on its message and anything else was refused by a setter, which is an invalid argument.
+*/
+func statusOf(err error) *Status {
+	var s *Status
+	if errors.As(err, &s) {
+		return s
+	}
+
+	var device *yeelight.ResponseError
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return &Status{Code: Canceled, Message: err.Error()}
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return &Status{Code: DeadlineExceeded, Message: err.Error()}
+	case errors.As(err, &device):
+		message := strings.ToLower(device.Message)
+
+		switch {
+		case strings.Contains(message, "quota"):
+			return &Status{Code: ResourceExhausted, Message: err.Error()}
+		case strings.Contains(message, "not supported") || strings.Contains(message, "unsupported"):
+			return &Status{Code: Unimplemented, Message: err.Error()}
+		}
+
+		return &Status{Code: FailedPrecondition, Message: err.Error()}
+	case errors.As(err, &netErr), errors.Is(err, net.ErrClosed), errors.Is(err, yeelight.ErrClosed):
+		return &Status{Code: Unavailable, Message: err.Error()}
+	}
+
+	return &Status{Code: InvalidArgument, Message: err.Error()}
+}
+
+// encodeMessage percent encodes grpc-message, which is limited to printable ASCII.
+func encodeMessage(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c > 0x7E || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
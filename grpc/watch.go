@@ -0,0 +1,75 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/LordAur/yeelight"
+)
+
+/*
+watch streams the changes of the requested devices until the client goes away. Every device has a subscription of
+its own, devices added later or lamps that were unreachable are picked up by Registry.Follow.
+*/
+func (s *Server) watch(ctx context.Context, st *stream, read func(Message) error) error {
+	var req WatchRequest
+	if err := read(&req); err != nil {
+		return err
+	}
+
+	wanted := map[string]bool{}
+	for _, idOrName := range req.Devices {
+		d, _, err := s.lookup(idOrName)
+		if err != nil {
+			return err
+		}
+
+		wanted[d.ID] = true
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := make(chan *Event, 64)
+
+	// The headers go out at once, so the client knows the stream is up before the first change.
+	st.start()
+	st.flush()
+
+	followed := make(chan struct{})
+	defer func() {
+		cancel()
+		<-followed
+	}()
+
+	go func() {
+		defer close(followed)
+
+		s.Registry.Follow(ctx, func(d yeelight.Device) bool {
+			return len(wanted) == 0 || wanted[d.ID]
+		}, func(ctx context.Context, id string, c *yeelight.Config) {
+			changes, err := c.SubscribeWith(ctx, yeelight.SubscribeOptions{Policy: yeelight.DropOldest}, req.Properties...)
+			if err != nil {
+				return
+			}
+
+			for c := range changes {
+				select {
+				case events <- &Event{Device: id, Property: c.Property, Old: c.Old, New: c.New, Time: c.Time}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e := <-events:
+			if err := st.send(e); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package grpc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Wire types of the protobuf encoding, the messages of the service only use varints and length delimited fields.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func appendTag(b []byte, number, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(number)<<3|uint64(wire))
+}
+
+// appendInt writes an int32, int64 or uint32 field, negative values take ten bytes like protobuf does.
+func appendInt(b []byte, number int, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+
+	return binary.AppendUvarint(appendTag(b, number, wireVarint), uint64(v))
+}
+
+func appendBool(b []byte, number int, v bool) []byte {
+	if !v {
+		return b
+	}
+
+	return append(appendTag(b, number, wireVarint), 1)
+}
+
+func appendString(b []byte, number int, s string) []byte {
+	if s == "" {
+		return b
+	}
+
+	return appendBytes(b, number, []byte(s))
+}
+
+// appendBytes writes a length delimited field even when it is empty, which is how a set message is written.
+func appendBytes(b []byte, number int, v []byte) []byte {
+	b = binary.AppendUvarint(appendTag(b, number, wireBytes), uint64(len(v)))
+
+	return append(b, v...)
+}
+
+func appendStrings(b []byte, number int, list []string) []byte {
+	for _, s := range list {
+		b = appendBytes(b, number, []byte(s))
+	}
+
+	return b
+}
+
+// appendTime writes a google.protobuf.Timestamp, the zero time is left out.
+func appendTime(b []byte, number int, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+
+	var ts []byte
+	ts = appendInt(ts, 1, t.Unix())
+	ts = appendInt(ts, 2, int64(t.Nanosecond()))
+
+	return appendBytes(b, number, ts)
+}
+
+// field is one field read from a message, varint is set for varint fields and bytes for length delimited ones.
+type field struct {
+	number int
+	wire   int
+	varint uint64
+	bytes  []byte
+}
+
+func (f field) int32() int32 {
+	return int32(f.varint)
+}
+
+func (f field) int() int {
+	return int(int32(f.varint))
+}
+
+func (f field) string() string {
+	return string(f.bytes)
+}
+
+/*
+decode calls fn for every field of a message in the order they were written. Fixed size fields are skipped,
+they are unknown to every message of the service.
+*/
+func decode(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return fmt.Errorf("malformed field tag")
+		}
+		b = b[n:]
+
+		f := field{number: int(tag >> 3), wire: int(tag & 7)}
+
+		switch f.wire {
+		case wireVarint:
+			if f.varint, n = binary.Uvarint(b); n <= 0 {
+				return fmt.Errorf("malformed varint of field %d", f.number)
+			}
+			b = b[n:]
+		case wireBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || length > uint64(len(b)-n) {
+				return fmt.Errorf("malformed length of field %d", f.number)
+			}
+			f.bytes, b = b[n:n+int(length)], b[n+int(length):]
+		case wireFixed64, wireFixed32:
+			size := 8
+			if f.wire == wireFixed32 {
+				size = 4
+			}
+
+			if len(b) < size {
+				return fmt.Errorf("field %d is cut off", f.number)
+			}
+			b = b[size:]
+
+			continue
+		default:
+			return fmt.Errorf("unsupported wire type %d of field %d", f.wire, f.number)
+		}
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeTime(b []byte) (time.Time, error) {
+	var seconds, nanos int64
+
+	err := decode(b, func(f field) error {
+		switch f.number {
+		case 1:
+			seconds = int64(f.varint)
+		case 2:
+			nanos = int64(f.int32())
+		}
+
+		return nil
+	})
+
+	return time.Unix(seconds, nanos), err
+}
@@ -0,0 +1,543 @@
+/*
+Package hue emulates the REST API (v1) of a Philips Hue bridge, so apps and remotes that only speak Hue can control
+the lamps of a registry. Lamps are Hue lights numbered in the order they are first seen, groups are Hue groups
+numbered in the order of their names and group 0 is every light. Apps remember lights by number, so the numbers
+of a registry saved to a file are saved next to it: "devices.json" keeps them in "devices.hue.json".
+
+The link button is always pressed: POST /api gives a user name to any app and every user name is accepted, so
+the emulation belongs on a trusted network only.
+
+Example:
+
+	b := &hue.Bridge{
+		Registry: registry,
+		Groups:   map[string][]string{"living": {"0x000000000015243f", "0x0000000000152440"}},
+	}
+
+	err := http.ListenAndServe(":80", b)
+*/
+package hue
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/LordAur/yeelight"
+)
+
+type Bridge struct {
+	Registry *yeelight.Registry
+
+	// Named lists of device IDs, exposed as Hue groups.
+	Groups map[string][]string
+
+	// Name of the bridge shown by apps, default "Yeelight".
+	Name string
+
+	// Bridge ID of the config, 16 hex digits, default "001788FFFE000001".
+	BridgeID string
+
+	once sync.Once
+	mux  *http.ServeMux
+
+	mu      sync.Mutex
+	numbers map[string]int
+	next    int
+}
+
+// light is a lamp with its Hue number.
+type light struct {
+	number string
+	device yeelight.Device
+	config *yeelight.Config
+}
+
+func (b *Bridge) routes() {
+	b.mux = http.NewServeMux()
+
+	b.mux.HandleFunc("POST /api", b.createUser)
+	b.mux.HandleFunc("GET /api/config", b.config)
+	b.mux.HandleFunc("GET /api/{user}", b.full)
+	b.mux.HandleFunc("GET /api/{user}/config", b.config)
+	b.mux.HandleFunc("GET /api/{user}/lights", b.lights)
+	b.mux.HandleFunc("GET /api/{user}/lights/{n}", b.light)
+	b.mux.HandleFunc("PUT /api/{user}/lights/{n}/state", b.setLight)
+	b.mux.HandleFunc("GET /api/{user}/groups", b.groups)
+	b.mux.HandleFunc("GET /api/{user}/groups/{n}", b.group)
+	b.mux.HandleFunc("PUT /api/{user}/groups/{n}/action", b.setGroup)
+}
+
+func (b *Bridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.once.Do(b.routes)
+	b.mux.ServeHTTP(w, r)
+}
+
+// all lists the lamps of the registry, new lamps get the next free number.
+func (b *Bridge) all() []light {
+	devices := b.Registry.Devices()
+
+	b.mu.Lock()
+	if b.numbers == nil {
+		b.load()
+	}
+
+	added := false
+	lights := make([]light, 0, len(devices))
+	for _, d := range devices {
+		n, ok := b.numbers[d.ID]
+		if !ok {
+			b.next++
+			n = b.next
+			b.numbers[d.ID] = n
+			added = true
+		}
+
+		lights = append(lights, light{number: strconv.Itoa(n), device: d})
+	}
+
+	// A file that cannot be written only costs the numbers of the new lamps at the next start.
+	if added {
+		b.save()
+	}
+	b.mu.Unlock()
+
+	sort.Slice(lights, func(i, j int) bool {
+		x, _ := strconv.Atoi(lights[i].number)
+		y, _ := strconv.Atoi(lights[j].number)
+
+		return x < y
+	})
+
+	for i := range lights {
+		lights[i].config, _ = b.Registry.Get(lights[i].device.ID)
+	}
+
+	return lights
+}
+
+// numbersPath is the file of the light numbers, next to the registry file.
+func (b *Bridge) numbersPath() string {
+	path := b.Registry.Path()
+	if path == "" {
+		return ""
+	}
+
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".hue.json"
+}
+
+// load reads the light numbers saved by an earlier start, lamps seen since then are numbered after them.
+func (b *Bridge) load() {
+	b.numbers = map[string]int{}
+
+	path := b.numbersPath()
+	if path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+
+	if err != nil || json.Unmarshal(data, &b.numbers) != nil {
+		b.numbers = map[string]int{}
+		return
+	}
+
+	for _, n := range b.numbers {
+		b.next = max(b.next, n)
+	}
+}
+
+// save writes the light numbers next to the file and renames it, a crash never leaves half a file.
+func (b *Bridge) save() error {
+	path := b.numbersPath()
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(b.numbers, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (b *Bridge) find(number string) (light, bool) {
+	for _, l := range b.all() {
+		if l.number == number && l.config != nil {
+			return l, true
+		}
+	}
+
+	return light{}, false
+}
+
+// groupNames are the group names in the order of their numbers, group 1 is the first.
+func (b *Bridge) groupNames() []string {
+	names := make([]string, 0, len(b.Groups))
+	for name := range b.Groups {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// members resolves a group number among the lights, "0" is every light.
+func (b *Bridge) members(number string, lights []light) (string, []light, bool) {
+	if number == "0" {
+		var all []light
+		for _, l := range lights {
+			if l.config != nil {
+				all = append(all, l)
+			}
+		}
+
+		return "All lights", all, true
+	}
+
+	names := b.groupNames()
+
+	i, err := strconv.Atoi(number)
+	if err != nil || i < 1 || i > len(names) {
+		return "", nil, false
+	}
+
+	var members []light
+	for _, l := range lights {
+		if l.config != nil && slices.Contains(b.Groups[names[i-1]], l.device.ID) {
+			members = append(members, l)
+		}
+	}
+
+	return names[i-1], members, true
+}
+
+func (b *Bridge) createUser(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		DeviceType string `json:"devicetype"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, []interface{}{hueError(2, "/", "body contains invalid json")})
+		return
+	}
+
+	if body.DeviceType == "" {
+		writeJSON(w, []interface{}{hueError(5, "/", "invalid/missing parameters in body")})
+		return
+	}
+
+	user := make([]byte, 16)
+	rand.Read(user)
+
+	writeJSON(w, []interface{}{map[string]interface{}{"success": map[string]string{"username": hex.EncodeToString(user)}}})
+}
+
+func (b *Bridge) bridgeID() string {
+	if len(b.BridgeID) != 16 {
+		return "001788FFFE000001"
+	}
+
+	return b.BridgeID
+}
+
+func (b *Bridge) configuration() map[string]interface{} {
+	name := b.Name
+	if name == "" {
+		name = "Yeelight"
+	}
+
+	id := b.bridgeID()
+	mac := fmt.Sprintf("%s:%s:%s:%s:%s:%s", id[0:2], id[2:4], id[4:6], id[10:12], id[12:14], id[14:16])
+
+	return map[string]interface{}{
+		"name":             name,
+		"bridgeid":         id,
+		"mac":              mac,
+		"modelid":          "BSB002",
+		"apiversion":       "1.56.0",
+		"swversion":        "1956000000",
+		"datastoreversion": "131",
+		"factorynew":       false,
+		"replacesbridgeid": nil,
+		"linkbutton":       true,
+	}
+}
+
+func (b *Bridge) config(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, b.configuration())
+}
+
+func (b *Bridge) full(w http.ResponseWriter, r *http.Request) {
+	lights := b.all()
+
+	writeJSON(w, map[string]interface{}{
+		"lights":        b.lightObjects(lights),
+		"groups":        b.groupObjects(lights),
+		"config":        b.configuration(),
+		"scenes":        map[string]interface{}{},
+		"schedules":     map[string]interface{}{},
+		"sensors":       map[string]interface{}{},
+		"rules":         map[string]interface{}{},
+		"resourcelinks": map[string]interface{}{},
+	})
+}
+
+func (b *Bridge) lights(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, b.lightObjects(b.all()))
+}
+
+func (b *Bridge) light(w http.ResponseWriter, r *http.Request) {
+	l, ok := b.find(r.PathValue("n"))
+	if !ok {
+		writeJSON(w, []interface{}{unavailable("/lights/" + r.PathValue("n"))})
+		return
+	}
+
+	writeJSON(w, lightObject(l, state(l)))
+}
+
+// lightObjects reads the lamps at the same time, an unreachable lamp costs its dial timeout once.
+func (b *Bridge) lightObjects(lights []light) map[string]interface{} {
+	states := make([]map[string]interface{}, len(lights))
+
+	var wg sync.WaitGroup
+	for i, l := range lights {
+		if l.config == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, l light) {
+			defer wg.Done()
+
+			states[i] = state(l)
+		}(i, l)
+	}
+
+	wg.Wait()
+
+	objects := map[string]interface{}{}
+	for i, l := range lights {
+		if states[i] != nil {
+			objects[l.number] = lightObject(l, states[i])
+		}
+	}
+
+	return objects
+}
+
+func supports(d yeelight.Device, method string) bool {
+	return len(d.Support) == 0 || slices.Contains(d.Support, method)
+}
+
+func lightObject(l light, state map[string]interface{}) map[string]interface{} {
+	kind := "Dimmable light"
+	switch {
+	case supports(l.device, "set_rgb"):
+		kind = "Extended color light"
+	case supports(l.device, "set_ct_abx"):
+		kind = "Color temperature light"
+	}
+
+	name := l.device.Name
+	if name == "" {
+		name = l.device.ID
+	}
+
+	// The unique ID of a Hue light is its MAC-like Zigbee address, the device ID has 8 bytes too.
+	id, _ := strconv.ParseUint(l.device.ID, 0, 64)
+	unique := fmt.Sprintf("%016x", id)
+	for i := 14; i > 0; i -= 2 {
+		unique = unique[:i] + ":" + unique[i:]
+	}
+
+	return map[string]interface{}{
+		"state":            state,
+		"type":             kind,
+		"name":             name,
+		"modelid":          l.device.Model,
+		"manufacturername": "Yeelight",
+		"productname":      "Yeelight " + l.device.Model,
+		"uniqueid":         unique + "-0b",
+		"swversion":        strconv.Itoa(l.device.FirmwareVersion),
+	}
+}
+
+// state translates the cached properties of a lamp to a Hue light state.
+func state(l light) map[string]interface{} {
+	p, err := l.config.Properties()
+	if err != nil {
+		p, _ = l.config.Cached()
+	}
+
+	number := func(name string) int {
+		v, _ := p.Int(name)
+		return v
+	}
+
+	s := map[string]interface{}{
+		"on":        p.Get("power") == "on",
+		"bri":       percentToBri(number("bright")),
+		"alert":     "none",
+		"mode":      "homeautomation",
+		"reachable": err == nil && p.Get("online") == "true",
+	}
+
+	if supports(l.device, "set_ct_abx") {
+		s["ct"] = kelvinToMireds(number("ct"))
+		s["colormode"] = "ct"
+	}
+
+	if supports(l.device, "set_rgb") {
+		rgb := number("rgb")
+		x, y := rgbToXY(rgb>>16, rgb>>8&0xFF, rgb&0xFF)
+
+		s["hue"] = degreesToHue(number("hue"))
+		s["sat"] = percentToSat(number("sat"))
+		s["xy"] = []float64{x, y}
+		s["effect"] = "none"
+
+		switch p.Get("color_mode") {
+		case "1":
+			s["colormode"] = "xy"
+		case "3":
+			s["colormode"] = "hs"
+		}
+	}
+
+	return s
+}
+
+func (b *Bridge) groups(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, b.groupObjects(b.all()))
+}
+
+func (b *Bridge) groupObjects(lights []light) map[string]interface{} {
+	objects := map[string]interface{}{}
+
+	for i := range b.groupNames() {
+		number := strconv.Itoa(i + 1)
+		name, members, _ := b.members(number, lights)
+		objects[number] = groupObject(name, members)
+	}
+
+	return objects
+}
+
+func (b *Bridge) group(w http.ResponseWriter, r *http.Request) {
+	name, members, ok := b.members(r.PathValue("n"), b.all())
+	if !ok {
+		writeJSON(w, []interface{}{unavailable("/groups/" + r.PathValue("n"))})
+		return
+	}
+
+	writeJSON(w, groupObject(name, members))
+}
+
+// groupObject describes a group, its action is the state of the first member like on a real bridge.
+func groupObject(name string, members []light) map[string]interface{} {
+	numbers := []string{}
+	action := map[string]interface{}{"on": false}
+	allOn, anyOn := len(members) > 0, false
+
+	for i, l := range members {
+		numbers = append(numbers, l.number)
+
+		s := state(l)
+		if i == 0 {
+			action = s
+		}
+
+		on, _ := s["on"].(bool)
+		allOn, anyOn = allOn && on, anyOn || on
+	}
+
+	return map[string]interface{}{
+		"name":   name,
+		"lights": numbers,
+		"type":   "LightGroup",
+		"action": action,
+		"state":  map[string]bool{"all_on": allOn, "any_on": anyOn},
+	}
+}
+
+func (b *Bridge) setLight(w http.ResponseWriter, r *http.Request) {
+	address := "/lights/" + r.PathValue("n")
+
+	l, ok := b.find(r.PathValue("n"))
+	if !ok {
+		writeJSON(w, []interface{}{unavailable(address)})
+		return
+	}
+
+	b.change(w, r, address+"/state", []*yeelight.Config{l.config})
+}
+
+func (b *Bridge) setGroup(w http.ResponseWriter, r *http.Request) {
+	address := "/groups/" + r.PathValue("n")
+
+	_, members, ok := b.members(r.PathValue("n"), b.all())
+	if !ok {
+		writeJSON(w, []interface{}{unavailable(address)})
+		return
+	}
+
+	configs := make([]*yeelight.Config, 0, len(members))
+	for _, l := range members {
+		configs = append(configs, l.config)
+	}
+
+	b.change(w, r, address+"/action", configs)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// Hue answers errors with 200 and a list of error objects, one per failed part of the request.
+func hueError(kind int, address, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"error": map[string]interface{}{"type": kind, "address": address, "description": description},
+	}
+}
+
+func unavailable(address string) map[string]interface{} {
+	return hueError(3, address, fmt.Sprintf("resource, %s, not available", address))
+}
+
+func success(address string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{"success": map[string]interface{}{address: value}}
+}
@@ -0,0 +1,113 @@
+package hue
+
+import "math"
+
+// The Hue API ranges, converted to and from the ranges of the lamps.
+const (
+	minMireds = 153
+	maxMireds = 500
+	maxBri    = 254
+	maxHue    = 65535
+	maxSat    = 254
+)
+
+func briToPercent(bri int) int {
+	return max(1, int(math.Round(float64(bri)*100/maxBri)))
+}
+
+func percentToBri(percent int) int {
+	return max(1, min(maxBri, int(math.Round(float64(percent)*maxBri/100))))
+}
+
+func miredsToKelvin(mireds int) int {
+	return min(6500, max(1700, int(math.Round(1e6/float64(mireds)))))
+}
+
+func kelvinToMireds(kelvin int) int {
+	if kelvin <= 0 {
+		return maxMireds
+	}
+
+	return min(maxMireds, max(minMireds, int(math.Round(1e6/float64(kelvin)))))
+}
+
+func hueToDegrees(hue int) int {
+	return int(float64(hue)*360/(maxHue+1)) % 360
+}
+
+func degreesToHue(degrees int) int {
+	return min(maxHue, int(math.Round(float64(degrees)*(maxHue+1)/360)))
+}
+
+func satToPercent(sat int) int {
+	return int(math.Round(float64(sat) * 100 / maxSat))
+}
+
+func percentToSat(percent int) int {
+	return min(maxSat, int(math.Round(float64(percent)*maxSat/100)))
+}
+
+/*
+xyToRGB converts a CIE xy point at full brightness to sRGB with the wide gamut conversion Philips documents
+for its lamps. Brightness is set separately, so the brightest color of the chromaticity is returned.
+*/
+func xyToRGB(x, y float64) (int, int, int) {
+	if y <= 0 {
+		return 255, 255, 255
+	}
+
+	z := 1 - x - y
+	bigY := 1.0
+	bigX := bigY / y * x
+	bigZ := bigY / y * z
+
+	r := bigX*1.656492 - bigY*0.354851 - bigZ*0.255038
+	g := -bigX*0.707196 + bigY*1.655397 + bigZ*0.036152
+	b := bigX*0.051713 - bigY*0.121364 + bigZ*1.011530
+
+	r, g, b = max(r, 0), max(g, 0), max(b, 0)
+	if m := max(r, g, b); m > 1 {
+		r, g, b = r/m, g/m, b/m
+	}
+
+	gamma := func(v float64) int {
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+
+		return int(math.Round(min(1, max(0, v)) * 255))
+	}
+
+	return gamma(r), gamma(g), gamma(b)
+}
+
+// rgbToXY is the inverse of xyToRGB, black gives 0, 0.
+func rgbToXY(red, green, blue int) (float64, float64) {
+	linear := func(c int) float64 {
+		v := float64(c) / 255
+		if v > 0.04045 {
+			return math.Pow((v+0.055)/1.055, 2.4)
+		}
+
+		return v / 12.92
+	}
+
+	r, g, b := linear(red), linear(green), linear(blue)
+
+	bigX := r*0.664511 + g*0.154324 + b*0.162028
+	bigY := r*0.283881 + g*0.668433 + b*0.047685
+	bigZ := r*0.000088 + g*0.072310 + b*0.986039
+
+	sum := bigX + bigY + bigZ
+	if sum == 0 {
+		return 0, 0
+	}
+
+	round := func(v float64) float64 {
+		return math.Round(v*10000) / 10000
+	}
+
+	return round(bigX / sum), round(bigY / sum)
+}
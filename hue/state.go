@@ -0,0 +1,162 @@
+package hue
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/LordAur/yeelight"
+)
+
+// stateChange is the body of a light state or group action, only the given attributes change.
+type stateChange struct {
+	On             *bool     `json:"on"`
+	Bri            *int      `json:"bri"`
+	Hue            *int      `json:"hue"`
+	Sat            *int      `json:"sat"`
+	XY             []float64 `json:"xy"`
+	CT             *int      `json:"ct"`
+	TransitionTime *int      `json:"transitiontime"`
+}
+
+// validate returns an error object for every attribute out of the Hue range.
+func (c stateChange) validate(address string) []interface{} {
+	var errs []interface{}
+	check := func(name string, v *int, low, high int) {
+		if v != nil && (*v < low || *v > high) {
+			errs = append(errs, invalid(address, name, *v))
+		}
+	}
+
+	check("bri", c.Bri, 1, maxBri)
+	check("hue", c.Hue, 0, maxHue)
+	check("sat", c.Sat, 0, maxSat)
+	check("ct", c.CT, minMireds, maxMireds)
+	check("transitiontime", c.TransitionTime, 0, 65535)
+
+	if c.XY != nil && (len(c.XY) != 2 || c.XY[0] < 0 || c.XY[0] > 1 || c.XY[1] < 0 || c.XY[1] > 1) {
+		errs = append(errs, invalid(address, "xy", c.XY))
+	}
+
+	return errs
+}
+
+func invalid(address, name string, value interface{}) map[string]interface{} {
+	data, _ := json.Marshal(value)
+	return hueError(7, address+"/"+name, fmt.Sprintf("invalid value, %s, for parameter, %s", data, name))
+}
+
+// transition turns the Hue transition time in tenths of a second into a lamp effect, the Hue default is 400 ms.
+func (c stateChange) transition() (string, int) {
+	if c.TransitionTime == nil {
+		return "smooth", 400
+	}
+
+	if *c.TransitionTime == 0 {
+		return "sudden", 30
+	}
+
+	return "smooth", max(30, *c.TransitionTime*100)
+}
+
+/*
+change applies a state change to every member at the same time and answers a success or an error per attribute.
+The lamp is switched on first and off last, so the other attributes apply to a lit lamp. Only one color is applied:
+xy before ct before hue and sat, like a Hue light does.
+*/
+func (b *Bridge) change(w http.ResponseWriter, r *http.Request, address string, members []*yeelight.Config) {
+	var c stateChange
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeJSON(w, []interface{}{hueError(2, address, "body contains invalid json")})
+		return
+	}
+
+	if errs := c.validate(address); len(errs) > 0 {
+		writeJSON(w, errs)
+		return
+	}
+
+	effect, duration := c.transition()
+	answers := []interface{}{}
+
+	apply := func(names []string, values []interface{}, fn func(y *yeelight.Config) (yeelight.Response, error)) {
+		g := &yeelight.Group{Members: members}
+		_, err := g.Do(fn)
+
+		for i, name := range names {
+			if err != nil {
+				description := strings.ReplaceAll(err.Error(), "\n", "; ")
+				answers = append(answers, hueError(901, address+"/"+name, "Internal error, "+description))
+			} else {
+				answers = append(answers, success(address+"/"+name, values[i]))
+			}
+		}
+	}
+
+	if c.On != nil && *c.On {
+		apply([]string{"on"}, []interface{}{true}, func(y *yeelight.Config) (yeelight.Response, error) {
+			return y.SetPower(true, effect, duration)
+		})
+	}
+
+	if c.Bri != nil {
+		apply([]string{"bri"}, []interface{}{*c.Bri}, func(y *yeelight.Config) (yeelight.Response, error) {
+			return y.SetBright(briToPercent(*c.Bri), effect, duration)
+		})
+	}
+
+	switch {
+	case c.XY != nil:
+		apply([]string{"xy"}, []interface{}{c.XY}, func(y *yeelight.Config) (yeelight.Response, error) {
+			red, green, blue := xyToRGB(c.XY[0], c.XY[1])
+			return y.SetRGB(red, green, blue, effect, duration)
+		})
+	case c.CT != nil:
+		apply([]string{"ct"}, []interface{}{*c.CT}, func(y *yeelight.Config) (yeelight.Response, error) {
+			return y.SetColorTemp(miredsToKelvin(*c.CT), effect, duration)
+		})
+	case c.Hue != nil || c.Sat != nil:
+		// Hue and saturation are set together, the one not given keeps the value of the lamp.
+		set := func(y *yeelight.Config) (yeelight.Response, error) {
+			p, _ := y.Cached()
+
+			hue, _ := p.Int("hue")
+			if c.Hue != nil {
+				hue = hueToDegrees(*c.Hue)
+			}
+
+			sat, _ := p.Int("sat")
+			if c.Sat != nil {
+				sat = satToPercent(*c.Sat)
+			}
+
+			return y.SetHueSaturation(hue, sat, effect, duration)
+		}
+
+		var names []string
+		var values []interface{}
+
+		if c.Hue != nil {
+			names, values = append(names, "hue"), append(values, *c.Hue)
+		}
+
+		if c.Sat != nil {
+			names, values = append(names, "sat"), append(values, *c.Sat)
+		}
+
+		apply(names, values, set)
+	}
+
+	if c.On != nil && !*c.On {
+		apply([]string{"on"}, []interface{}{false}, func(y *yeelight.Config) (yeelight.Response, error) {
+			return y.SetPower(false, effect, duration)
+		})
+	}
+
+	if c.TransitionTime != nil {
+		answers = append(answers, success(address+"/transitiontime", *c.TransitionTime))
+	}
+
+	writeJSON(w, answers)
+}
@@ -0,0 +1,279 @@
+/*
+Package metrics exports the lamps of a registry and the counters of their connections in the Prometheus text format,
+no client library is needed:
+
+	yeelight_device_info{device,name,model,firmware}        always 1
+	yeelight_up{device}                                     1 while the connection to the lamp is up
+	yeelight_power{device}                                  1 when the lamp is on
+	yeelight_brightness_percent{device}
+	yeelight_color_temperature_kelvin{device}
+	yeelight_commands_total{device,method}
+	yeelight_command_errors_total{device,method,code}       code is the device error code, "timeout", "canceled"
+	                                                        or "connection"
+	yeelight_command_duration_seconds{device,method}        histogram
+	yeelight_quota_rejections_total{device}
+	yeelight_reconnects_total{device}
+	yeelight_notifications_total{device}
+
+The state comes from the cache of every lamp, a scrape never waits for a lamp, not even for the dial to one that is
+unreachable. Lamps whose state was never read are read in the background and have their state gauges from a later
+scrape on.
+
+Example:
+
+	http.Handle("/metrics", &metrics.Exporter{Registry: registry})
+
+Applications with their own metrics registry can read the same values with Families and export them through it.
+*/
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/LordAur/yeelight"
+)
+
+type Exporter struct {
+	Registry *yeelight.Registry
+
+	// Prefix of the metric names, default "yeelight".
+	Namespace string
+
+	mu      sync.Mutex
+	seeding map[string]bool
+}
+
+// Family is a metric with all its samples.
+type Family struct {
+	Name string
+	Help string
+
+	// "gauge", "counter" or "histogram".
+	Type    string
+	Samples []Sample
+}
+
+// Sample is one value, Name is the family name with the "_bucket", "_sum" or "_count" suffix for histograms.
+type Sample struct {
+	Name   string
+	Labels []Label
+	Value  float64
+}
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+func (e *Exporter) namespace() string {
+	if e.Namespace == "" {
+		return "yeelight"
+	}
+
+	return e.Namespace
+}
+
+/*
+This function is used to collect every metric, families are in a fixed order and samples sorted by device.
+*/
+func (e *Exporter) Families() []Family {
+	ns := e.namespace()
+	family := func(name, help, kind string) *Family {
+		return &Family{Name: ns + "_" + name, Help: help, Type: kind}
+	}
+
+	info := family("device_info", "Lamp identity, always 1.", "gauge")
+	up := family("up", "Whether the connection to the lamp is up.", "gauge")
+	power := family("power", "Whether the lamp is on.", "gauge")
+	bright := family("brightness_percent", "Brightness of the lamp.", "gauge")
+	ct := family("color_temperature_kelvin", "Color temperature of the lamp.", "gauge")
+	commands := family("commands_total", "Commands sent to the lamp.", "counter")
+	errs := family("command_errors_total", "Commands that failed, by device error code, timeout, canceled or connection.", "counter")
+	latency := family("command_duration_seconds", "Time until the lamp answered a command.", "histogram")
+	quota := family("quota_rejections_total", "Commands refused because a quota was exceeded.", "counter")
+	reconnects := family("reconnects_total", "Connections to the lamp made again after the first one.", "counter")
+	notifications := family("notifications_total", "Property notifications received from the lamp.", "counter")
+
+	for _, d := range e.Registry.Devices() {
+		c, err := e.Registry.Get(d.ID)
+		if err != nil {
+			continue
+		}
+
+		device := Label{"device", d.ID}
+		gauge := func(f *Family, v float64, labels ...Label) {
+			f.Samples = append(f.Samples, Sample{Name: f.Name, Labels: append([]Label{device}, labels...), Value: v})
+		}
+
+		gauge(info, 1, Label{"name", d.Name}, Label{"model", d.Model}, Label{"firmware", strconv.Itoa(d.FirmwareVersion)})
+
+		p, seeded := c.Cached()
+		if !seeded {
+			e.seed(d.ID, c)
+		}
+
+		gauge(up, boolean(p.Get("online") == "true"))
+
+		if v := p.Get("power"); v != "" {
+			gauge(power, boolean(v == "on"))
+		}
+
+		if v, err := p.Int("bright"); err == nil {
+			gauge(bright, float64(v))
+		}
+
+		if v, err := p.Int("ct"); err == nil {
+			gauge(ct, float64(v))
+		}
+
+		stats := c.Stats()
+
+		methods := make([]string, 0, len(stats.Methods))
+		for method := range stats.Methods {
+			methods = append(methods, method)
+		}
+
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			m := stats.Methods[method]
+			label := Label{"method", method}
+
+			gauge(commands, float64(m.Calls), label)
+
+			codes := make([]string, 0, len(m.Errors))
+			for code := range m.Errors {
+				codes = append(codes, code)
+			}
+
+			sort.Strings(codes)
+
+			for _, code := range codes {
+				gauge(errs, float64(m.Errors[code]), label, Label{"code", code})
+			}
+
+			var cumulative int64
+			for i, bound := range yeelight.LatencyBuckets {
+				cumulative += m.Buckets[i]
+				latency.Samples = append(latency.Samples, Sample{
+					Name:   latency.Name + "_bucket",
+					Labels: []Label{device, label, {"le", formatFloat(bound)}},
+					Value:  float64(cumulative),
+				})
+			}
+
+			latency.Samples = append(latency.Samples,
+				Sample{Name: latency.Name + "_bucket", Labels: []Label{device, label, {"le", "+Inf"}}, Value: float64(m.Calls)},
+				Sample{Name: latency.Name + "_sum", Labels: []Label{device, label}, Value: m.Duration.Seconds()},
+				Sample{Name: latency.Name + "_count", Labels: []Label{device, label}, Value: float64(m.Calls)},
+			)
+		}
+
+		gauge(quota, float64(stats.QuotaRejections))
+		gauge(reconnects, float64(max(stats.Connects-1, 0)))
+		gauge(notifications, float64(stats.Notifications))
+	}
+
+	var families []Family
+	for _, f := range []*Family{info, up, power, bright, ct, commands, errs, latency, quota, reconnects, notifications} {
+		families = append(families, *f)
+	}
+
+	return families
+}
+
+// seed reads the state of a lamp in the background, once at a time.
+func (e *Exporter) seed(id string, c *yeelight.Config) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.seeding == nil {
+		e.seeding = map[string]bool{}
+	}
+
+	if e.seeding[id] {
+		return
+	}
+
+	e.seeding[id] = true
+
+	go func() {
+		c.Properties()
+
+		e.mu.Lock()
+		delete(e.seeding, id)
+		e.mu.Unlock()
+	}()
+}
+
+func boolean(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+/*
+This function is used to write families in the Prometheus text format, families without samples are left out.
+*/
+func Write(w io.Writer, families []Family) error {
+	var b strings.Builder
+
+	for _, f := range families {
+		if len(f.Samples) == 0 {
+			continue
+		}
+
+		help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(f.Help)
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", f.Name, help, f.Name, f.Type)
+
+		for _, s := range f.Samples {
+			b.WriteString(s.Name)
+
+			if len(s.Labels) > 0 {
+				b.WriteByte('{')
+				for i, l := range s.Labels {
+					if i > 0 {
+						b.WriteByte(',')
+					}
+
+					value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(l.Value)
+					fmt.Fprintf(&b, "%s=\"%s\"", l.Name, value)
+				}
+				b.WriteByte('}')
+			}
+
+			fmt.Fprintf(&b, " %s\n", formatFloat(s.Value))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	Write(w, e.Families())
+}
@@ -0,0 +1,503 @@
+/*
+Package mqtt bridges the lamps of a registry to an MQTT broker, with Home Assistant discovery so the lamps appear
+without configuration. The client is a small MQTT 3.1.1 implementation, no dependency is needed.
+
+Every property of a lamp is mirrored raw and retained as it changes, the way "get_prop" answers it:
+
+	yeelight/<id>/power          "on" or "off"
+	yeelight/<id>/bright         1 ~ 100
+	yeelight/<id>/rgb            the color as a decimal integer
+	yeelight/<id>/ct             Kelvin
+	yeelight/<id>/effect         the last effect applied through the bridge
+	yeelight/<id>/availability   "online" or "offline"
+	yeelight/bridge/availability "online" or "offline", the will of the bridge
+
+Commands are read from the topics below, retained ones are ignored so a restart never replays an old command:
+
+	yeelight/<id>/power/set      "on", "off" or "toggle"
+	yeelight/<id>/bright/set     1 ~ 100
+	yeelight/<id>/rgb/set        "255,136,0" or "#ff8800"
+	yeelight/<id>/ct/set         Kelvin
+	yeelight/<id>/effect/set     the name of an effect, or "stop" to stop a color flow
+
+Example:
+
+	b := &mqtt.Bridge{
+		Registry: registry,
+		Options:  mqtt.Options{Broker: "localhost:1883"},
+		Effects: map[string]yeelight.Scene{
+			"movie": {Action: "ct", ColorTemperature: 2700, Brightness: 20},
+		},
+	}
+
+	err := b.Run(ctx)
+*/
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LordAur/yeelight"
+)
+
+type Bridge struct {
+	Registry *yeelight.Registry
+
+	// The broker connection, the will and the message handler are set by the bridge.
+	Options Options
+
+	// Root of the lamp topics, default "yeelight".
+	Prefix string
+
+	// Root of the Home Assistant discovery topics, default "homeassistant". "-" disables discovery.
+	DiscoveryPrefix string
+
+	// Scenes offered as effects, by name.
+	Effects map[string]yeelight.Scene
+
+	// How long a command may wait for the lamp, default 5 seconds.
+	CommandTimeout time.Duration
+
+	mu       sync.Mutex
+	client   *Client
+	followed map[string]bool
+	effects  map[string]string
+	commands map[string]chan Message
+}
+
+// Changes to these properties are mirrored, the others are not useful to an MQTT client.
+var mirrored = []string{"power", "bright", "ct", "rgb", "hue", "sat", "color_mode", "flowing", "name", "online"}
+
+func (b *Bridge) prefix() string {
+	if b.Prefix == "" {
+		return "yeelight"
+	}
+
+	return b.Prefix
+}
+
+func (b *Bridge) discoveryPrefix() string {
+	if b.DiscoveryPrefix == "" {
+		return "homeassistant"
+	}
+
+	return b.DiscoveryPrefix
+}
+
+/*
+This function is used to run the bridge until the context is cancelled. An error connecting the first time is
+returned, it usually means the options are wrong. Later the bridge reconnects with a backoff of 1 to 30 seconds
+and publishes the discovery and the state of every lamp again.
+*/
+func (b *Bridge) Run(ctx context.Context) error {
+	opts := b.Options
+	if opts.ClientID == "" {
+		opts.ClientID = fmt.Sprintf("yeelight-%06x", rand.Intn(1<<24))
+	}
+
+	opts.Will = &Message{Topic: b.prefix() + "/bridge/availability", Payload: []byte("offline"), Retain: true}
+	opts.OnMessage = func(m Message) { b.dispatch(ctx, m) }
+
+	defer func() {
+		b.mu.Lock()
+		b.commands = nil
+		b.mu.Unlock()
+	}()
+
+	client, err := Connect(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	go b.follow(ctx)
+
+	backoff := time.Second
+
+	for {
+		b.online(client)
+
+		select {
+		case <-ctx.Done():
+			client.Close()
+			return ctx.Err()
+		case <-client.Done():
+		}
+
+		b.mu.Lock()
+		b.client = nil
+		b.mu.Unlock()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+
+			client, err = Connect(ctx, opts)
+			if err == nil {
+				backoff = time.Second
+				break
+			}
+
+			backoff = min(backoff*2, 30*time.Second)
+		}
+	}
+}
+
+// online subscribes to the commands and publishes everything known on a new connection.
+func (b *Bridge) online(client *Client) {
+	client.Subscribe(b.prefix() + "/+/+/set")
+	client.Publish(b.prefix()+"/bridge/availability", []byte("online"), true)
+
+	b.mu.Lock()
+	b.client = client
+	ids := make([]string, 0, len(b.followed))
+	for id, ok := range b.followed {
+		if ok {
+			ids = append(ids, id)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, id := range ids {
+		b.announce(id)
+	}
+}
+
+// publish sends a retained message on the current connection, messages are lost while disconnected.
+func (b *Bridge) publish(topic, payload string) {
+	b.mu.Lock()
+	client := b.client
+	b.mu.Unlock()
+
+	if client != nil {
+		client.Publish(topic, []byte(payload), true)
+	}
+}
+
+// follow mirrors the lamps of the registry, new lamps and lamps that could not be reached are retried every 10 seconds.
+func (b *Bridge) follow(ctx context.Context) {
+	b.Registry.Follow(ctx, nil, b.mirror)
+}
+
+// mirror publishes the changes of a lamp until its subscription ends.
+func (b *Bridge) mirror(ctx context.Context, id string, c *yeelight.Config) {
+	defer func() {
+		b.mu.Lock()
+		delete(b.followed, id)
+		b.mu.Unlock()
+	}()
+
+	changes, err := c.SubscribeWith(ctx, yeelight.SubscribeOptions{Policy: yeelight.DropOldest}, mirrored...)
+	if err != nil {
+		b.publish(b.prefix()+"/"+id+"/availability", "offline")
+		return
+	}
+
+	b.mu.Lock()
+	if b.followed == nil {
+		b.followed = map[string]bool{}
+	}
+	b.followed[id] = true
+	b.mu.Unlock()
+
+	b.announce(id)
+
+	for change := range changes {
+		if change.Property == "online" {
+			b.publish(b.prefix()+"/"+id+"/availability", availability(change.New))
+			continue
+		}
+
+		b.publish(b.prefix()+"/"+id+"/"+change.Property, change.New)
+	}
+}
+
+func availability(online string) string {
+	if online == "true" {
+		return "online"
+	}
+
+	return "offline"
+}
+
+// announce publishes the discovery config and the cached state of a lamp.
+func (b *Bridge) announce(id string) {
+	d, ok := b.Registry.Device(id)
+	if !ok {
+		return
+	}
+
+	c, err := b.Registry.Get(id)
+	if err != nil {
+		return
+	}
+
+	p, err := c.Properties()
+	if err != nil {
+		b.publish(b.prefix()+"/"+id+"/availability", "offline")
+		return
+	}
+
+	if b.discoveryPrefix() != "-" {
+		config, _ := json.Marshal(b.discovery(d))
+		b.publish(b.discoveryPrefix()+"/light/"+strings.ReplaceAll(id, "/", "_")+"/config", string(config))
+	}
+
+	for _, name := range mirrored {
+		if v, ok := p.Values[name]; ok && name != "online" {
+			b.publish(b.prefix()+"/"+id+"/"+name, v)
+		}
+	}
+
+	b.mu.Lock()
+	effect, ok := b.effects[id]
+	b.mu.Unlock()
+
+	if ok {
+		b.publish(b.prefix()+"/"+id+"/effect", effect)
+	}
+
+	b.publish(b.prefix()+"/"+id+"/availability", availability(p.Get("online")))
+}
+
+// discovery builds the Home Assistant config of a lamp, features the lamp does not support are left out.
+func (b *Bridge) discovery(d yeelight.Device) map[string]interface{} {
+	topic := b.prefix() + "/" + d.ID + "/"
+	supports := func(method string) bool {
+		return len(d.Support) == 0 || slices.Contains(d.Support, method)
+	}
+
+	name := d.Name
+	if name == "" {
+		name = d.ID
+	}
+
+	config := map[string]interface{}{
+		"name":      nil,
+		"unique_id": "yeelight_" + d.ID,
+		"availability": []map[string]string{
+			{"topic": b.prefix() + "/bridge/availability"},
+			{"topic": topic + "availability"},
+		},
+		"availability_mode": "all",
+		"command_topic":     topic + "power/set",
+		"state_topic":       topic + "power",
+		"payload_on":        "on",
+		"payload_off":       "off",
+		"device": map[string]interface{}{
+			"identifiers":  []string{"yeelight_" + d.ID},
+			"name":         name,
+			"manufacturer": "Yeelight",
+			"model":        d.Model,
+			"sw_version":   strconv.Itoa(d.FirmwareVersion),
+		},
+	}
+
+	if supports("set_bright") {
+		config["brightness_command_topic"] = topic + "bright/set"
+		config["brightness_state_topic"] = topic + "bright"
+		config["brightness_scale"] = 100
+	}
+
+	if supports("set_rgb") {
+		config["rgb_command_topic"] = topic + "rgb/set"
+		config["rgb_state_topic"] = topic + "rgb"
+		config["rgb_value_template"] = "{{ (value | int) // 65536 }},{{ (value | int) // 256 % 256 }},{{ (value | int) % 256 }}"
+	}
+
+	if supports("set_ct_abx") {
+		config["color_temp_kelvin"] = true
+		config["color_temp_command_topic"] = topic + "ct/set"
+		config["color_temp_state_topic"] = topic + "ct"
+		config["min_kelvin"] = 1700
+		config["max_kelvin"] = 6500
+	}
+
+	if len(b.Effects) > 0 && supports("set_scene") {
+		effects := []string{"stop"}
+		for name := range b.Effects {
+			effects = append(effects, name)
+		}
+
+		slices.Sort(effects[1:])
+
+		config["effect_command_topic"] = topic + "effect/set"
+		config["effect_state_topic"] = topic + "effect"
+		config["effect_list"] = effects
+	}
+
+	return config
+}
+
+// commandTopic splits a command topic into the lamp and what to set.
+func (b *Bridge) commandTopic(topic string) (id, what string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(topic, b.prefix()+"/"), "/")
+	if len(parts) != 3 || parts[2] != "set" {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
+
+/*
+dispatch hands a message of a command topic to the worker of its lamp. It runs on the reader of the client, so it
+never waits: a lamp that does not answer only delays its own commands, and loses them once 16 are waiting.
+*/
+func (b *Bridge) dispatch(ctx context.Context, m Message) {
+	id, _, ok := b.commandTopic(m.Topic)
+	if !ok {
+		return
+	}
+
+	// A retained command is an old one the broker replays on every connection, not something to do now.
+	if m.Retain {
+		return
+	}
+
+	if _, ok := b.Registry.Device(id); !ok {
+		return
+	}
+
+	b.mu.Lock()
+	if b.commands == nil {
+		b.commands = map[string]chan Message{}
+	}
+
+	queue, ok := b.commands[id]
+	if !ok {
+		queue = make(chan Message, 16)
+		b.commands[id] = queue
+		go b.work(ctx, queue)
+	}
+	b.mu.Unlock()
+
+	select {
+	case queue <- m:
+	default:
+	}
+}
+
+// work runs the commands of a lamp in order until the context is cancelled.
+func (b *Bridge) work(ctx context.Context, queue chan Message) {
+	timeout := b.CommandTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-queue:
+			commandCtx, cancel := context.WithTimeout(ctx, timeout)
+			b.command(commandCtx, m)
+			cancel()
+		}
+	}
+}
+
+// command handles a message of a command topic, invalid commands are ignored.
+func (b *Bridge) command(ctx context.Context, m Message) {
+	id, what, ok := b.commandTopic(m.Topic)
+	if !ok {
+		return
+	}
+
+	payload := strings.TrimSpace(string(m.Payload))
+
+	c, err := b.Registry.Get(id)
+	if err != nil {
+		return
+	}
+
+	c = c.WithContext(ctx)
+
+	switch what {
+	case "power":
+		switch strings.ToLower(payload) {
+		case "on":
+			c.SetPower(true, "smooth", 300)
+		case "off":
+			c.SetPower(false, "smooth", 300)
+		case "toggle":
+			c.Toggle()
+		}
+	case "bright":
+		if bright, err := strconv.Atoi(payload); err == nil {
+			c.SetBright(min(max(bright, 1), 100), "smooth", 300)
+		}
+	case "rgb":
+		if red, green, blue, err := parseRGB(payload); err == nil {
+			c.SetRGB(red, green, blue, "smooth", 300)
+		}
+	case "ct":
+		if ct, err := strconv.Atoi(payload); err == nil {
+			c.SetColorTemp(min(max(ct, 1700), 6500), "smooth", 300)
+		}
+	case "effect":
+		b.effect(id, c, payload)
+	}
+}
+
+func (b *Bridge) effect(id string, c *yeelight.Config, name string) {
+	var err error
+	if name == "stop" {
+		_, err = c.StopColorFlow()
+	} else if scene, ok := b.Effects[name]; ok {
+		_, err = c.SetScene(scene)
+	} else {
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	if b.effects == nil {
+		b.effects = map[string]string{}
+	}
+	b.effects[id] = name
+	b.mu.Unlock()
+
+	b.publish(b.prefix()+"/"+id+"/effect", name)
+}
+
+// parseRGB reads "255,136,0" as sent by Home Assistant or a hex color like "#ff8800".
+func parseRGB(s string) (int, int, int, error) {
+	if hex := strings.TrimPrefix(s, "#"); len(hex) == 6 && !strings.Contains(s, ",") {
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+
+		return int(v >> 16), int(v >> 8 & 0xFF), int(v & 0xFF), nil
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return 0, 0, 0, fmt.Errorf("invalid color %q", s)
+	}
+
+	var rgb [3]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || v < 0 || v > 255 {
+			return 0, 0, 0, fmt.Errorf("invalid color %q", s)
+		}
+
+		rgb[i] = v
+	}
+
+	return rgb[0], rgb[1], rgb[2], nil
+}
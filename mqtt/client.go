@@ -0,0 +1,389 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Message is a PUBLISH packet, sent and received with QoS 0.
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Options of a broker connection, only Broker is required.
+type Options struct {
+	// Address of the broker, host:port.
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+
+	// Interval of the keep alive pings, default 30 seconds.
+	KeepAlive time.Duration
+
+	// Published by the broker when the connection is lost without a DISCONNECT.
+	Will *Message
+
+	// Called for every message of the subscriptions, one at a time from the reader of the connection.
+	OnMessage func(Message)
+}
+
+/*
+Client is one MQTT 3.1.1 session with a clean start, it does not reconnect: Done is closed when the connection
+is lost and a new client must be connected. Only QoS 0 is used, which is what state mirroring needs.
+*/
+type Client struct {
+	opts Options
+	conn net.Conn
+
+	writeMu sync.Mutex
+	id      uint16
+
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+const (
+	packetConnect    = 0x10
+	packetConnack    = 0x20
+	packetPublish    = 0x30
+	packetPuback     = 0x40
+	packetSubscribe  = 0x82
+	packetSuback     = 0x90
+	packetPingreq    = 0xC0
+	packetPingresp   = 0xD0
+	packetDisconnect = 0xE0
+)
+
+/*
+This function is used to connect to a broker, it returns once the broker accepted the session.
+*/
+func Connect(ctx context.Context, opts Options) (*Client, error) {
+	// MQTT 3.1.1 only allows a password together with a user name.
+	if opts.Password != "" && opts.Username == "" {
+		return nil, fmt.Errorf("a password needs a user name")
+	}
+
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = 30 * time.Second
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", opts.Broker)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(10 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+
+	c := &Client{opts: opts, conn: conn, done: make(chan struct{})}
+	r := bufio.NewReader(conn)
+
+	if err := c.write(packetConnect, c.connect()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	kind, body, err := readPacket(r)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connecting to %s: %w", opts.Broker, err)
+	}
+
+	if kind&0xF0 != packetConnack || len(body) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("connecting to %s: unexpected packet %#x", opts.Broker, kind)
+	}
+
+	if body[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("connecting to %s: %s", opts.Broker, refused(body[1]))
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	go c.read(r)
+	go c.ping()
+
+	return c, nil
+}
+
+func refused(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+
+	return fmt.Sprintf("connection refused with code %d", code)
+}
+
+func (c *Client) connect() []byte {
+	flags := byte(0x02)
+	if c.opts.Will != nil {
+		flags |= 0x04
+		if c.opts.Will.Retain {
+			flags |= 0x20
+		}
+	}
+
+	if c.opts.Username != "" {
+		flags |= 0x80
+
+		if c.opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(c.opts.KeepAlive/time.Second))
+	body = appendString(body, c.opts.ClientID)
+
+	if c.opts.Will != nil {
+		body = appendString(body, c.opts.Will.Topic)
+		body = appendString(body, string(c.opts.Will.Payload))
+	}
+
+	if c.opts.Username != "" {
+		body = appendString(body, c.opts.Username)
+
+		if c.opts.Password != "" {
+			body = appendString(body, c.opts.Password)
+		}
+	}
+
+	return body
+}
+
+/*
+This function is used to publish a message with QoS 0.
+*/
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	kind := byte(packetPublish)
+	if retain {
+		kind |= 0x01
+	}
+
+	return c.write(kind, append(appendString(nil, topic), payload...))
+}
+
+/*
+This function is used to subscribe to topic filters with QoS 0, the messages are passed to OnMessage.
+*/
+func (c *Client) Subscribe(filters ...string) error {
+	c.writeMu.Lock()
+	// Packet identifiers are never 0, the counter skips it when it wraps.
+	c.id++
+	if c.id == 0 {
+		c.id++
+	}
+	id := c.id
+	c.writeMu.Unlock()
+
+	body := binary.BigEndian.AppendUint16(nil, id)
+	for _, f := range filters {
+		body = append(appendString(body, f), 0)
+	}
+
+	return c.write(packetSubscribe, body)
+}
+
+/*
+This function is used to get a channel closed when the connection is lost or closed.
+*/
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+/*
+This function is used to get why the connection ended, nil while it is up.
+*/
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+/*
+This function is used to disconnect cleanly, the broker does not publish the will.
+*/
+func (c *Client) Close() error {
+	c.write(packetDisconnect, nil)
+	c.end(fmt.Errorf("connection closed"))
+
+	return nil
+}
+
+func (c *Client) end(err error) {
+	c.once.Do(func() {
+		c.err = err
+		c.conn.Close()
+		close(c.done)
+	})
+}
+
+func (c *Client) write(kind byte, body []byte) error {
+	packet := append([]byte{kind}, remainingLength(len(body))...)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.conn.Write(append(packet, body...)); err != nil {
+		c.end(err)
+		return err
+	}
+
+	return nil
+}
+
+func (c *Client) ping() {
+	ticker := time.NewTicker(c.opts.KeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.write(packetPingreq, nil)
+		}
+	}
+}
+
+// read dispatches the packets of the broker, the connection is considered lost without any for 1.5 keep alives.
+func (c *Client) read(r *bufio.Reader) {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(c.opts.KeepAlive * 3 / 2))
+
+		kind, body, err := readPacket(r)
+		if err != nil {
+			c.end(fmt.Errorf("connection to %s lost: %w", c.opts.Broker, err))
+			return
+		}
+
+		if kind&0xF0 != packetPublish {
+			continue
+		}
+
+		m, id, err := parsePublish(kind, body)
+		if err != nil {
+			c.end(err)
+			return
+		}
+
+		// A broker may not downgrade a retained message, acknowledge QoS 1 anyway.
+		if kind&0x06 == 0x02 {
+			c.write(packetPuback, binary.BigEndian.AppendUint16(nil, id))
+		}
+
+		if c.opts.OnMessage != nil {
+			c.opts.OnMessage(m)
+		}
+	}
+}
+
+func parsePublish(kind byte, body []byte) (Message, uint16, error) {
+	if len(body) < 2 {
+		return Message{}, 0, fmt.Errorf("malformed publish packet")
+	}
+
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n {
+		return Message{}, 0, fmt.Errorf("malformed publish packet")
+	}
+
+	m := Message{Topic: string(body[2 : 2+n]), Retain: kind&0x01 != 0}
+	body = body[2+n:]
+
+	var id uint16
+	if kind&0x06 != 0 {
+		if len(body) < 2 {
+			return Message{}, 0, fmt.Errorf("malformed publish packet")
+		}
+
+		id, body = binary.BigEndian.Uint16(body), body[2:]
+	}
+
+	m.Payload = body
+
+	return m, id, nil
+}
+
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	kind, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, shift := 0, 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		length |= int(b&0x7F) << shift
+		if b&0x80 == 0 {
+			break
+		}
+
+		shift += 7
+		if shift > 21 {
+			return 0, nil, fmt.Errorf("malformed remaining length")
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+
+	return kind, body, nil
+}
+
+func remainingLength(n int) []byte {
+	var b []byte
+	for {
+		digit := byte(n % 128)
+		n /= 128
+
+		if n > 0 {
+			digit |= 0x80
+		}
+
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
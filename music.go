@@ -0,0 +1,217 @@
+package yeelight
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+/*
+Music is a music mode connection. The device connects back to us and accepts commands without any rate limit,
+but it never answers, so the methods only report write errors.
+*/
+type Music struct {
+	conn  net.Conn
+	scale BrightnessScale
+}
+
+/*
+This function is used to start music mode. The device is asked to connect back to the local address
+of the command connection, the returned Music should be closed to leave music mode.
+
+Example:
+
+	m, err := y.StartMusic()
+	if err != nil {
+		...
+	}
+
+	defer m.Close()
+
+	m.SetRGB(255, 0, 0, "sudden", 0)
+*/
+func (c *Config) StartMusic() (*Music, error) {
+	if c.conn == nil {
+		return nil, fmt.Errorf("device is not connected")
+	}
+
+	local := c.conn.LocalAddr()
+	if local == nil {
+		return nil, fmt.Errorf("device is not connected")
+	}
+
+	host, _, err := net.SplitHostPort(local.String())
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+
+	_, p, _ := net.SplitHostPort(listener.Addr().String())
+	port, _ := strconv.Atoi(p)
+
+	r, err := c.call("set_music", 1, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Error != nil {
+		return nil, r.Error
+	}
+
+	listener.(*net.TCPListener).SetDeadline(time.Now().Add(5 * time.Second))
+
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, fmt.Errorf("device did not connect back for music mode: %w", err)
+	}
+
+	return &Music{conn, c.BrightnessScale}, nil
+}
+
+/*
+This function is used to stop music mode from the command connection.
+*/
+func (c *Config) StopMusic() (Response, error) {
+	return c.call("set_music", 0)
+}
+
+/*
+This function is used to close the music mode connection, the device goes back to normal mode.
+*/
+func (m *Music) Close() error {
+	return m.conn.Close()
+}
+
+/*
+This function is used to send any command over the music mode connection.
+*/
+func (m *Music) Send(method string, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	request := Request{
+		ID:     generateID(),
+		Method: method,
+		Params: params,
+	}
+
+	bytes, _ := json.Marshal(request)
+
+	_, err := m.conn.Write([]byte(string(bytes) + "\r\n"))
+
+	return err
+}
+
+/*
+This function is used to change the color in music mode. The allowed value effect is "sudden" and "smooth".
+*/
+func (m *Music) SetRGB(red, green, blue int, effect string, duration int) error {
+	if red < 0 || red > 255 || green < 0 || green > 255 || blue < 0 || blue > 255 {
+		return fmt.Errorf("rgb should be in range 0-255")
+	}
+
+	if effect != "smooth" && effect != "sudden" {
+		return fmt.Errorf("effect values is wrong, yeelight only supports effects 'smooth' and 'sudden'")
+	}
+
+	if duration < 30 {
+		duration = 30
+	}
+
+	return m.Send("set_rgb", (red*65536)+(green*256)+blue, effect, duration)
+}
+
+/*
+This function is used to change the brightness in music mode. The allowed value brightness is in range 1 ~ 100.
+*/
+func (m *Music) SetBright(brightness int, effect string, duration int) error {
+	if effect != "smooth" && effect != "sudden" {
+		return fmt.Errorf("effect values is wrong, yeelight only supports effects 'smooth' and 'sudden'")
+	}
+
+	if brightness < 1 {
+		brightness = 1
+	}
+
+	if brightness > 100 {
+		brightness = 100
+	}
+
+	brightness = deviceBrightness(m.scale, brightness)
+
+	if duration < 30 {
+		duration = 30
+	}
+
+	return m.Send("set_bright", brightness, effect, duration)
+}
+
+/*
+This function is used to change the color temperature in music mode. The allowed value for temp is in range 1700 ~ 6500.
+*/
+func (m *Music) SetColorTemp(temp int, effect string, duration int) error {
+	if effect != "smooth" && effect != "sudden" {
+		return fmt.Errorf("effect values is wrong, yeelight only supports effects 'smooth' and 'sudden'")
+	}
+
+	if temp < 1700 {
+		temp = 1700
+	}
+
+	if temp > 6500 {
+		temp = 6500
+	}
+
+	if duration < 30 {
+		duration = 30
+	}
+
+	return m.Send("set_ct_abx", temp, effect, duration)
+}
+
+/*
+This function is used to switch on or off in music mode. The allowed value effect is "sudden" and "smooth".
+*/
+func (m *Music) SetPower(power bool, effect string, duration int) error {
+	if effect != "smooth" && effect != "sudden" {
+		return fmt.Errorf("effect values is wrong, yeelight only supports effects 'smooth' and 'sudden'")
+	}
+
+	if duration < 30 {
+		duration = 30
+	}
+
+	state := "off"
+	if power {
+		state = "on"
+	}
+
+	return m.Send("set_power", state, effect, duration)
+}
+
+/*
+This function is used to set a scene in music mode. Only "color", "hsv" and "ct" are supported here,
+the change is applied at once which suits frame by frame updates.
+*/
+func (m *Music) SetScene(scene Scene) error {
+	scene.Brightness = deviceBrightness(m.scale, scene.Brightness)
+
+	switch scene.Action {
+	case "color":
+		return m.Send("set_scene", scene.Action, scene.Color, scene.Brightness)
+	case "hsv":
+		return m.Send("set_scene", scene.Action, scene.Hue, scene.Saturation, scene.Brightness)
+	case "ct":
+		return m.Send("set_scene", scene.Action, scene.ColorTemperature, scene.Brightness)
+	}
+
+	return fmt.Errorf("scene action should be color, hsv or ct")
+}
@@ -0,0 +1,220 @@
+package yeelight
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+)
+
+/*
+Proxy lets any number of clients share one device. It speaks the device's JSON protocol on a local listener and
+sends everything over the single managed connection of Config: request IDs are rewritten on the way up and back,
+every "props" notification goes to all clients, and all clients draw from one rate budget.
+
+Example:
+
+	y := yeelight.New(&yeelight.Config{IpAddress: "192.168.1.239", Port: 55443})
+	p := &yeelight.Proxy{Config: &y}
+
+	err := p.ListenAndServe("127.0.0.1:55443")
+*/
+type Proxy struct {
+	Config *Config
+
+	// Commands per minute for all clients together, default 60 which is the quota of one device connection.
+	// A command over budget is answered with the error the device gives when its quota is exceeded. It is also
+	// the most commands of one client forwarded at once.
+	Rate int
+
+	mu       sync.Mutex
+	tokens   float64
+	refilled time.Time
+}
+
+// proxyWriteTimeout is how long a client may leave an answer or notification unread before it is dropped.
+var proxyWriteTimeout = 10 * time.Second
+
+type proxyRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type proxyAnswer struct {
+	ID     json.RawMessage `json:"id"`
+	Result []interface{}   `json:"result,omitempty"`
+	Error  *ResponseError  `json:"error,omitempty"`
+}
+
+/*
+This function is used to listen on "addr" and serve clients until the listener fails.
+*/
+func (p *Proxy) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return p.Serve(listener)
+}
+
+/*
+This function is used to serve the clients of a listener, it returns when the listener is closed.
+*/
+func (p *Proxy) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go p.serve(conn)
+	}
+}
+
+func (p *Proxy) serve(conn net.Conn) {
+	defer conn.Close()
+
+	if p.Config == nil || p.Config.conn == nil {
+		return
+	}
+
+	var once sync.Once
+	drop := func() { once.Do(func() { conn.Close() }) }
+
+	// One writer per client, so answers and notifications never interleave and a slow client only delays itself.
+	// A client that stops reading is dropped when a write does not finish in time, the writer then only drains
+	// what is left so nothing waits on it.
+	out := make(chan []byte, 64)
+	go func() {
+		var err error
+		for line := range out {
+			if err == nil {
+				conn.SetWriteDeadline(time.Now().Add(proxyWriteTimeout))
+				if _, err = conn.Write(line); err != nil {
+					drop()
+				}
+			}
+		}
+	}()
+
+	s := &subscription{
+		deliver: func(n notification) {
+			line, _ := json.Marshal(map[string]interface{}{"method": "props", "params": n.params})
+
+			// A client that does not keep up misses notifications, it can read the state with get_prop.
+			select {
+			case out <- append(line, '\r', '\n'):
+			default:
+			}
+		},
+		end: drop,
+	}
+
+	if err := p.Config.conn.subscribe(s); err != nil {
+		close(out)
+		return
+	}
+
+	// Requests are forwarded concurrently, but no more than the rate budget at once: further requests of the
+	// client are not read until one of them is answered.
+	inflight := make(chan struct{}, p.rate())
+
+	var wg sync.WaitGroup
+	decoder := json.NewDecoder(conn)
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				out <- answerLine(proxyAnswer{Error: &ResponseError{Code: -1, Message: "invalid command"}})
+			}
+			break
+		}
+
+		var req proxyRequest
+		if err := json.Unmarshal(raw, &req); err != nil || req.Method == "" {
+			out <- answerLine(proxyAnswer{ID: req.ID, Error: &ResponseError{Code: -1, Message: "invalid command"}})
+			continue
+		}
+
+		inflight <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out <- answerLine(p.forward(req))
+			<-inflight
+		}()
+	}
+
+	p.Config.conn.unsubscribe(s)
+	wg.Wait()
+	close(out)
+}
+
+func (p *Proxy) forward(req proxyRequest) proxyAnswer {
+	answer := proxyAnswer{ID: req.ID}
+
+	if !p.take() {
+		p.Config.conn.rejected()
+		answer.Error = &ResponseError{Code: -1, Message: "client quota exceeded"}
+		return answer
+	}
+
+	params := make([]interface{}, len(req.Params))
+	for i, param := range req.Params {
+		params[i] = param
+	}
+
+	r, err := p.Config.conn.Call(req.Method, params...)
+	if err != nil {
+		answer.Error = &ResponseError{Code: -1, Message: err.Error()}
+		return answer
+	}
+
+	answer.Result, answer.Error = r.Result, r.Error
+
+	return answer
+}
+
+func answerLine(a proxyAnswer) []byte {
+	if len(a.ID) == 0 {
+		a.ID = json.RawMessage("null")
+	}
+
+	line, _ := json.Marshal(a)
+
+	return append(line, '\r', '\n')
+}
+
+func (p *Proxy) rate() int {
+	if p.Rate <= 0 {
+		return 60
+	}
+
+	return p.Rate
+}
+
+// take spends one command of the budget, the budget refills continuously up to Rate.
+func (p *Proxy) take() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rate := float64(p.rate())
+
+	now := time.Now()
+	if p.refilled.IsZero() {
+		p.tokens = rate
+	} else {
+		p.tokens = min(rate, p.tokens+now.Sub(p.refilled).Minutes()*rate)
+	}
+	p.refilled = now
+
+	if p.tokens < 1 {
+		return false
+	}
+
+	p.tokens--
+
+	return true
+}
@@ -0,0 +1,408 @@
+package yeelight
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+Registry keeps track of devices by their stable ID instead of their IP address. Every device gets one Config
+with a managed connection that follows the device when it comes back with a new address. The known devices are
+saved to a file, so a service can control lamps right away and let discovery catch up.
+
+Example:
+
+	r, err := yeelight.NewRegistry("devices.json")
+	if err != nil {
+		...
+	}
+
+	defer r.Close()
+
+	go r.Watch(ctx, 10*time.Minute)
+
+	y, err := r.Get("0x000000000015243f")
+	if err != nil {
+		...
+	}
+
+	y.SetPower(true, "smooth", 500)
+*/
+type Registry struct {
+	path string
+
+	mu      sync.Mutex
+	devices map[string]*registered
+}
+
+type registered struct {
+	device Device
+	config *Config
+	conn   *Conn
+}
+
+/*
+This function is used to create a registry saved to "path". Devices already in the file are loaded,
+an empty path keeps the registry in memory only.
+*/
+func NewRegistry(path string) (*Registry, error) {
+	r := &Registry{
+		path:    path,
+		devices: map[string]*registered{},
+	}
+
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []Device
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for _, d := range devices {
+		r.devices[d.ID] = r.register(d)
+	}
+
+	return r, nil
+}
+
+/*
+This function is used to get the file the registry is saved to, empty when it is kept in memory only.
+*/
+func (r *Registry) Path() string {
+	return r.path
+}
+
+func (r *Registry) register(d Device) *registered {
+	conn := newConn(net.JoinHostPort(d.IpAddress, strconv.Itoa(d.Port)))
+
+	return &registered{
+		device: d,
+		conn:   conn,
+		config: &Config{
+			conn:      conn,
+			IpAddress: d.IpAddress,
+			Port:      d.Port,
+		},
+	}
+}
+
+/*
+This function is used to add a device or update what is known about it, usually with the result of Search
+or an advertisement. When the address changed the connection moves to the new address. The file is saved when
+anything known about the device changed, like the methods it supports after a firmware update.
+*/
+func (r *Registry) Update(d Device) error {
+	if d.ID == "" {
+		return fmt.Errorf("device has no id")
+	}
+
+	r.mu.Lock()
+
+	reg, ok := r.devices[d.ID]
+	if !ok {
+		r.devices[d.ID] = r.register(d)
+		err := r.save()
+		r.mu.Unlock()
+
+		return err
+	}
+
+	moved := reg.device.IpAddress != d.IpAddress || reg.device.Port != d.Port
+	changed := !sameDevice(reg.device, d)
+	reg.device = d
+
+	if moved {
+		// Callers may be using the old Config, a copy with the new address replaces it. Both share the connection.
+		config := *reg.config
+		config.IpAddress, config.Port = d.IpAddress, d.Port
+		reg.config = &config
+	}
+
+	var err error
+	if changed {
+		err = r.save()
+	}
+
+	conn := reg.conn
+	r.mu.Unlock()
+
+	// The connection is moved without the lock of the registry, a busy connection must not hold up the registry.
+	if moved {
+		conn.setAddr(net.JoinHostPort(d.IpAddress, strconv.Itoa(d.Port)))
+	}
+
+	return err
+}
+
+// sameDevice tells whether nothing saved about a device changed, it compares what save writes.
+func sameDevice(a, b Device) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+
+	return bytes.Equal(x, y)
+}
+
+/*
+This function is used to get the Config of a device by its ID. The same Config is returned until the device moves
+to a new address, then a new one is. A Config returned before keeps working, its connection follows the device.
+It should not be closed by the caller.
+*/
+func (r *Registry) Get(id string) (*Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reg, ok := r.devices[id]
+	if !ok {
+		return nil, fmt.Errorf("device %s is unknown", id)
+	}
+
+	return reg.config, nil
+}
+
+/*
+This function is used to look up a device by its ID.
+*/
+func (r *Registry) Device(id string) (Device, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reg, ok := r.devices[id]
+	if !ok {
+		return Device{}, false
+	}
+
+	return reg.device, true
+}
+
+/*
+This function is used to list the known devices, sorted by ID.
+*/
+func (r *Registry) Devices() []Device {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	devices := make([]Device, 0, len(r.devices))
+	for _, reg := range r.devices {
+		devices = append(devices, reg.device)
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].ID < devices[j].ID
+	})
+
+	return devices
+}
+
+/*
+This function is used to forget a device, its connection is closed.
+*/
+func (r *Registry) Remove(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if reg, ok := r.devices[id]; ok {
+		reg.conn.Close()
+		delete(r.devices, id)
+	}
+
+	return r.save()
+}
+
+/*
+This function is used to keep the registry up to date until the context is cancelled.
+Advertisements are applied as they arrive and a search is done every "interval".
+*/
+func (r *Registry) Watch(ctx context.Context, interval time.Duration) error {
+	ads, err := Advertisements(ctx)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	search := func() {
+		devices, _ := Search(3 * time.Second)
+		for _, d := range devices {
+			r.Update(d)
+		}
+	}
+
+	search()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d, ok := <-ads:
+			if !ok {
+				return ctx.Err()
+			}
+
+			r.Update(d)
+		case <-ticker.C:
+			search()
+		}
+	}
+}
+
+/*
+This function is used to run fn for every device of the registry until the context is cancelled, each device in a
+goroutine of its own. fn usually subscribes to the device and returns when the subscription ends. The registry is
+scanned again every 10 seconds: devices added later are picked up, and a device whose fn returned, for example
+because it was unreachable, is started again. Only the devices accepted by filter are followed, nil accepts all.
+It returns once every fn returned.
+
+Example:
+
+	r.Follow(ctx, nil, func(ctx context.Context, id string, c *yeelight.Config) {
+		changes, err := c.Subscribe(ctx)
+		if err != nil {
+			return
+		}
+
+		for change := range changes {
+			...
+		}
+	})
+*/
+func (r *Registry) Follow(ctx context.Context, filter func(d Device) bool, fn func(ctx context.Context, id string, c *Config)) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	busy := map[string]bool{}
+
+	scan := func() {
+		for _, d := range r.Devices() {
+			if filter != nil && !filter(d) {
+				continue
+			}
+
+			c, err := r.Get(d.ID)
+			if err != nil {
+				continue
+			}
+
+			mu.Lock()
+			if busy[d.ID] {
+				mu.Unlock()
+				continue
+			}
+			busy[d.ID] = true
+			mu.Unlock()
+
+			wg.Add(1)
+			go func(id string) {
+				defer func() {
+					mu.Lock()
+					busy[id] = false
+					mu.Unlock()
+					wg.Done()
+				}()
+
+				fn(ctx, id, c)
+			}(d.ID)
+		}
+	}
+
+	scan()
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+			scan()
+		}
+	}
+}
+
+/*
+This function is used to close every connection of the registry.
+*/
+func (r *Registry) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, reg := range r.devices {
+		reg.conn.Close()
+	}
+}
+
+// save writes the known devices to the registry file.
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	devices := make([]Device, 0, len(r.devices))
+	for _, reg := range r.devices {
+		d := reg.device
+
+		// Only what identifies the device is kept, the state is stale by the next start.
+		devices = append(devices, Device{
+			ID:        d.ID,
+			IpAddress: d.IpAddress,
+			Port:      d.Port,
+			Model:     d.Model,
+			Support:   d.Support,
+			Name:      d.Name,
+		})
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].ID < devices[j].ID
+	})
+
+	data, err := json.MarshalIndent(devices, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(r.path, data)
+}
+
+// writeFile writes next to the file and renames it, a crash never leaves half a file.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
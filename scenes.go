@@ -0,0 +1,367 @@
+package yeelight
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// NamedScene is an entry of a scene library. Target is a device ID of the registry or the name of a group.
+type NamedScene struct {
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	Scene  Scene  `json:"scene"`
+}
+
+/*
+SceneLibrary keeps named scenes in a JSON file. A name can have entries for several targets,
+applying it applies all of them at once. Groups are lists of device IDs stored in the same file.
+
+	{
+		"groups": {"living": ["0x000000000015243f", "0x0000000000152440"]},
+		"scenes": [
+			{"name": "movie", "target": "living", "scene": {"action": "ct", "ct": 2700, "bright": 20}}
+		]
+	}
+
+Example:
+
+	lib, err := yeelight.LoadScenes("scenes.json", registry)
+	if err != nil {
+		...
+	}
+
+	results, err := lib.Apply("movie")
+*/
+type SceneLibrary struct {
+	path     string
+	registry *Registry
+
+	Groups map[string][]string `json:"groups,omitempty"`
+	Scenes []NamedScene        `json:"scenes"`
+}
+
+/*
+This function is used to load a scene library. A missing file gives an empty library, every scene is validated
+against the capabilities of its targets, see Validate. The registry resolves the targets and is required.
+*/
+func LoadScenes(path string, registry *Registry) (*SceneLibrary, error) {
+	if registry == nil {
+		return nil, fmt.Errorf("a scene library needs a registry")
+	}
+
+	lib := &SceneLibrary{
+		path:     path,
+		registry: registry,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return lib, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, lib); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := lib.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return lib, nil
+}
+
+/*
+This function is used to check every scene: the values are in range and every target device supports it.
+Support is what the device announced in discovery, devices the registry knows no support of are only range checked.
+*/
+func (l *SceneLibrary) Validate() error {
+	var errs []error
+	for _, s := range l.Scenes {
+		if err := l.validate(s); err != nil {
+			errs = append(errs, fmt.Errorf("scene %q for %q: %w", s.Name, s.Target, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (l *SceneLibrary) validate(s NamedScene) error {
+	if err := ValidateScene(s.Scene); err != nil {
+		return err
+	}
+
+	ids, err := l.members(s.Target)
+	if err != nil {
+		return err
+	}
+
+	needs := map[string]string{
+		"color": "set_rgb",
+		"hsv":   "set_hsv",
+		"ct":    "set_ct_abx",
+		"cf":    "start_cf",
+	}
+
+	for _, id := range ids {
+		d, _ := l.registry.Device(id)
+		if len(d.Support) == 0 {
+			continue
+		}
+
+		if !d.Supports("set_scene") || !d.Supports(needs[s.Scene.Action]) {
+			return fmt.Errorf("device %s does not support %q scenes", id, s.Scene.Action)
+		}
+	}
+
+	return nil
+}
+
+/*
+This function is used to check the values of a scene against the ranges of the spec.
+*/
+func ValidateScene(s Scene) error {
+	bright := func() error {
+		if s.Brightness < 1 || s.Brightness > 100 {
+			return fmt.Errorf("brightness should be in range 1-100")
+		}
+
+		return nil
+	}
+
+	switch s.Action {
+	case "color":
+		if s.Color < 0 || s.Color > 0xFFFFFF {
+			return fmt.Errorf("color should be in range 0-16777215")
+		}
+
+		return bright()
+	case "hsv":
+		if s.Hue < 0 || s.Hue > 359 {
+			return fmt.Errorf("hue value should be in range 0-359")
+		}
+
+		if s.Saturation < 0 || s.Saturation > 100 {
+			return fmt.Errorf("saturation value should be in range 0-100")
+		}
+
+		return bright()
+	case "ct":
+		if s.ColorTemperature < 1700 || s.ColorTemperature > 6500 {
+			return fmt.Errorf("color temperature should be in range 1700-6500")
+		}
+
+		return bright()
+	case "cf":
+		if len(s.ColorFlow) == 0 {
+			return fmt.Errorf("color flow has no expressions")
+		}
+
+		if s.Mode < 0 || s.Mode > 2 {
+			return fmt.Errorf("action should be in range 0-2")
+		}
+
+		_, err := flowParams(nil, s.Duration, s.Mode, s.ColorFlow)
+
+		return err
+	}
+
+	return fmt.Errorf("action should be color, hsv, ct or cf")
+}
+
+// members resolves a target to device IDs.
+func (l *SceneLibrary) members(target string) ([]string, error) {
+	if ids, ok := l.Groups[target]; ok {
+		return ids, nil
+	}
+
+	if _, ok := l.registry.Device(target); ok {
+		return []string{target}, nil
+	}
+
+	return nil, fmt.Errorf("target %q is neither a group nor a known device", target)
+}
+
+/*
+This function is used to list the scene names, sorted.
+*/
+func (l *SceneLibrary) Names() []string {
+	seen := map[string]bool{}
+	var names []string
+
+	for _, s := range l.Scenes {
+		if !seen[s.Name] {
+			seen[s.Name] = true
+			names = append(names, s.Name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+/*
+This function is used to apply every entry of a scene at the same time. Results are per device,
+the error joins a MemberError for every failed device.
+*/
+func (l *SceneLibrary) Apply(name string) ([]Result, error) {
+	var configs []*Config
+	scenes := map[*Config]Scene{}
+
+	for _, s := range l.Scenes {
+		if s.Name != name {
+			continue
+		}
+
+		ids, err := l.members(s.Target)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range ids {
+			c, err := l.registry.Get(id)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, ok := scenes[c]; !ok {
+				configs = append(configs, c)
+			}
+
+			scenes[c] = s.Scene
+		}
+	}
+
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("scene %q is unknown", name)
+	}
+
+	g := &Group{Members: configs}
+
+	return g.each(func(i int, c *Config) (Response, error) {
+		return c.SetScene(scenes[configs[i]])
+	})
+}
+
+/*
+This function is used to add a scene, an existing entry with the same name and target is replaced.
+The library is validated and saved.
+*/
+func (l *SceneLibrary) Set(s NamedScene) error {
+	if err := l.validate(s); err != nil {
+		return err
+	}
+
+	l.put(s)
+
+	return l.Save()
+}
+
+func (l *SceneLibrary) put(s NamedScene) {
+	for i, existing := range l.Scenes {
+		if existing.Name == s.Name && existing.Target == s.Target {
+			l.Scenes[i] = s
+			return
+		}
+	}
+
+	l.Scenes = append(l.Scenes, s)
+}
+
+/*
+This function is used to create a scene from the live state of a target. Every device of a group gets its own entry,
+so each one comes back exactly as it is now. Brightness is stored in the scale of the device's Config like the
+scenes written by hand. The library is saved.
+*/
+func (l *SceneLibrary) Capture(name, target string) error {
+	ids, err := l.members(target)
+	if err != nil {
+		return err
+	}
+
+	configs := make([]*Config, len(ids))
+	for i, id := range ids {
+		if configs[i], err = l.registry.Get(id); err != nil {
+			return err
+		}
+	}
+
+	g := &Group{Members: configs}
+
+	snapshots, err := g.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	for i, id := range ids {
+		scene, err := snapshots[i].Scene()
+		if err != nil {
+			return fmt.Errorf("device %s: %w", id, err)
+		}
+
+		l.put(NamedScene{Name: name, Target: id, Scene: userScene(configs[i].BrightnessScale, scene)})
+	}
+
+	return l.Save()
+}
+
+/*
+userScene maps the device brightness of a captured scene to the perceived brightness of the lamp's scale, the one
+Apply sends through SetScene like the scenes written by hand.
+*/
+func userScene(scale BrightnessScale, s Scene) Scene {
+	if scale == nil {
+		return s
+	}
+
+	if s.Action == "cf" {
+		flow := make([]FlowExpression, len(s.ColorFlow))
+		for i, e := range s.ColorFlow {
+			e.Brightness = userBrightness(scale, e.Brightness)
+			flow[i] = e
+		}
+
+		s.ColorFlow = flow
+
+		return s
+	}
+
+	s.Brightness = userBrightness(scale, s.Brightness)
+
+	return s
+}
+
+/*
+This function is used to remove every entry of a scene. The library is saved.
+*/
+func (l *SceneLibrary) Delete(name string) error {
+	scenes := l.Scenes[:0]
+	for _, s := range l.Scenes {
+		if s.Name != name {
+			scenes = append(scenes, s)
+		}
+	}
+
+	l.Scenes = scenes
+
+	return l.Save()
+}
+
+/*
+This function is used to write the library to its file.
+*/
+func (l *SceneLibrary) Save() error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(l.path, data)
+}
@@ -0,0 +1,392 @@
+/*
+Package server exposes the lamps of a registry over HTTP with JSON bodies. The API is described by the OpenAPI
+document served at /openapi.json.
+
+Bodies are checked by the same Config setters that send the commands: a value they refuse is answered with
+400 Bad Request, a lamp that can't be reached with 502 Bad Gateway and an error answered by the lamp with 409 Conflict.
+
+Example:
+
+	registry, err := yeelight.NewRegistry("devices.json")
+	if err != nil {
+		...
+	}
+
+	go registry.Watch(ctx, time.Minute)
+
+	http.ListenAndServe(":8080", &server.Server{Registry: registry})
+*/
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LordAur/yeelight"
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+type Server struct {
+	Registry *yeelight.Registry
+
+	// Named lists of device IDs, streams can be filtered by group.
+	Groups map[string][]string
+
+	// Origins ("https://example.com") of the web pages allowed to open a WebSocket besides the pages of the server
+	// itself, any other page is refused with 403 Forbidden. Clients that send no Origin are not browsers and
+	// are not checked.
+	Origins []string
+
+	once sync.Once
+	mux  *http.ServeMux
+
+	mu        sync.Mutex
+	listeners map[*listener]bool
+}
+
+// DeviceState is a device with its cached state, State is nil and Error set when the lamp can't be read.
+type DeviceState struct {
+	yeelight.Device
+	State *yeelight.Properties `json:"state,omitempty"`
+	Error string               `json:"error,omitempty"`
+}
+
+type transition struct {
+	Effect   string `json:"effect"`
+	Duration int    `json:"duration"`
+}
+
+// effect fills in a smooth transition of 300 milliseconds when the body has none.
+func (t transition) effect() (string, int) {
+	if t.Effect == "" {
+		if t.Duration == 0 {
+			return "smooth", 300
+		}
+
+		return "smooth", t.Duration
+	}
+
+	return t.Effect, t.Duration
+}
+
+func (s *Server) routes() {
+	s.mux = http.NewServeMux()
+
+	s.mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPI)
+	})
+
+	s.mux.HandleFunc("GET /devices", s.list)
+	s.mux.HandleFunc("GET /devices/{id}", s.get)
+	s.mux.HandleFunc("PUT /devices/{id}/power", s.power)
+	s.mux.HandleFunc("PUT /devices/{id}/bright", s.bright)
+	s.mux.HandleFunc("PUT /devices/{id}/color", s.color)
+	s.mux.HandleFunc("PUT /devices/{id}/ct", s.ct)
+	s.mux.HandleFunc("PUT /devices/{id}/scene", s.scene)
+	s.mux.HandleFunc("PUT /devices/{id}/flow", s.flow)
+	s.mux.HandleFunc("DELETE /devices/{id}/flow", s.stopFlow)
+	s.mux.HandleFunc("GET /devices/{id}/timer", s.timer)
+	s.mux.HandleFunc("PUT /devices/{id}/timer", s.setTimer)
+	s.mux.HandleFunc("DELETE /devices/{id}/timer", s.deleteTimer)
+	s.mux.HandleFunc("GET /events", s.sse)
+	s.mux.HandleFunc("GET /ws", s.websocket)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.once.Do(s.routes)
+	s.mux.ServeHTTP(w, r)
+}
+
+/*
+This function is used to register another handler next to the API, for example a stream of events.
+*/
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.once.Do(s.routes)
+	s.mux.Handle(pattern, handler)
+}
+
+/*
+This function is used to find a device of the request path, by ID or by name.
+*/
+func (s *Server) Lookup(idOrName string) (yeelight.Device, *yeelight.Config, bool) {
+	d, ok := s.Registry.Device(idOrName)
+	if !ok {
+		for _, candidate := range s.Registry.Devices() {
+			if strings.EqualFold(candidate.Name, idOrName) {
+				d, ok = candidate, true
+				break
+			}
+		}
+	}
+
+	if !ok {
+		return yeelight.Device{}, nil, false
+	}
+
+	c, err := s.Registry.Get(d.ID)
+	if err != nil {
+		return yeelight.Device{}, nil, false
+	}
+
+	return d, c, true
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	devices := s.Registry.Devices()
+	states := make([]DeviceState, len(devices))
+
+	// Unreachable lamps cost a dial timeout each, they are read at the same time.
+	var wg sync.WaitGroup
+	for i, d := range devices {
+		wg.Add(1)
+		go func(i int, d yeelight.Device) {
+			defer wg.Done()
+
+			states[i] = s.state(d)
+		}(i, d)
+	}
+
+	wg.Wait()
+
+	writeJSON(w, http.StatusOK, states)
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	d, _, ok := s.Lookup(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("device %s is unknown", r.PathValue("id")))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.state(d))
+}
+
+func (s *Server) state(d yeelight.Device) DeviceState {
+	state := DeviceState{Device: d}
+
+	c, err := s.Registry.Get(d.ID)
+	if err == nil {
+		var p yeelight.Properties
+		if p, err = c.Properties(); err == nil {
+			state.State = &p
+		}
+	}
+
+	if err != nil {
+		state.Error = err.Error()
+	}
+
+	return state
+}
+
+func (s *Server) power(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		On *bool `json:"on"`
+		transition
+	}
+
+	s.command(w, r, &body, func(c *yeelight.Config) (yeelight.Response, error) {
+		if body.On == nil {
+			return yeelight.Response{}, fmt.Errorf("on is required")
+		}
+
+		effect, duration := body.effect()
+
+		return c.SetPower(*body.On, effect, duration)
+	})
+}
+
+func (s *Server) bright(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Bright *int `json:"bright"`
+		transition
+	}
+
+	s.command(w, r, &body, func(c *yeelight.Config) (yeelight.Response, error) {
+		if body.Bright == nil || *body.Bright < 1 || *body.Bright > 100 {
+			return yeelight.Response{}, fmt.Errorf("bright is required, in range 1-100")
+		}
+
+		effect, duration := body.effect()
+
+		return c.SetBright(*body.Bright, effect, duration)
+	})
+}
+
+func (s *Server) color(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Rgb   string `json:"rgb"`
+		Red   *int   `json:"red"`
+		Green *int   `json:"green"`
+		Blue  *int   `json:"blue"`
+		Hue   *int   `json:"hue"`
+		Sat   *int   `json:"sat"`
+		transition
+	}
+
+	s.command(w, r, &body, func(c *yeelight.Config) (yeelight.Response, error) {
+		effect, duration := body.effect()
+
+		switch {
+		case body.Rgb != "":
+			hex := strings.TrimPrefix(body.Rgb, "#")
+			v, err := strconv.ParseUint(hex, 16, 32)
+			if err != nil || len(hex) != 6 {
+				return yeelight.Response{}, fmt.Errorf("rgb should be a color like #ff8800")
+			}
+
+			return c.SetRGB(int(v>>16), int(v>>8&0xFF), int(v&0xFF), effect, duration)
+		case body.Red != nil && body.Green != nil && body.Blue != nil:
+			return c.SetRGB(*body.Red, *body.Green, *body.Blue, effect, duration)
+		case body.Hue != nil && body.Sat != nil:
+			return c.SetHueSaturation(*body.Hue, *body.Sat, effect, duration)
+		}
+
+		return yeelight.Response{}, fmt.Errorf("expected rgb, red/green/blue or hue/sat")
+	})
+}
+
+func (s *Server) ct(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ColorTemperature *int `json:"ct"`
+		transition
+	}
+
+	s.command(w, r, &body, func(c *yeelight.Config) (yeelight.Response, error) {
+		if body.ColorTemperature == nil || *body.ColorTemperature < 1700 || *body.ColorTemperature > 6500 {
+			return yeelight.Response{}, fmt.Errorf("ct is required, in range 1700-6500")
+		}
+
+		effect, duration := body.effect()
+
+		return c.SetColorTemp(*body.ColorTemperature, effect, duration)
+	})
+}
+
+func (s *Server) scene(w http.ResponseWriter, r *http.Request) {
+	var body yeelight.Scene
+
+	s.command(w, r, &body, func(c *yeelight.Config) (yeelight.Response, error) {
+		if err := yeelight.ValidateScene(body); err != nil {
+			return yeelight.Response{}, err
+		}
+
+		return c.SetScene(body)
+	})
+}
+
+func (s *Server) flow(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Count  int                       `json:"count"`
+		Action int                       `json:"action"`
+		Flow   []yeelight.FlowExpression `json:"flow"`
+	}
+
+	s.command(w, r, &body, func(c *yeelight.Config) (yeelight.Response, error) {
+		flow := yeelight.Scene{Action: "cf", Duration: body.Count, Mode: body.Action, ColorFlow: body.Flow}
+		if err := yeelight.ValidateScene(flow); err != nil {
+			return yeelight.Response{}, err
+		}
+
+		return c.SetColorFlow(body.Count, body.Action, body.Flow)
+	})
+}
+
+func (s *Server) stopFlow(w http.ResponseWriter, r *http.Request) {
+	s.command(w, r, nil, (*yeelight.Config).StopColorFlow)
+}
+
+func (s *Server) timer(w http.ResponseWriter, r *http.Request) {
+	s.command(w, r, nil, (*yeelight.Config).CronGet)
+}
+
+func (s *Server) setTimer(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Minutes int `json:"minutes"`
+	}
+
+	s.command(w, r, &body, func(c *yeelight.Config) (yeelight.Response, error) {
+		if body.Minutes < 1 {
+			return yeelight.Response{}, fmt.Errorf("minutes should be at least 1")
+		}
+
+		return c.CronAdd(body.Minutes)
+	})
+}
+
+func (s *Server) deleteTimer(w http.ResponseWriter, r *http.Request) {
+	s.command(w, r, nil, (*yeelight.Config).CronDelete)
+}
+
+// command decodes the body, runs fn on the device of the path and writes the answer of the device.
+func (s *Server) command(w http.ResponseWriter, r *http.Request, body interface{}, fn func(c *yeelight.Config) (yeelight.Response, error)) {
+	d, c, ok := s.Lookup(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("device %s is unknown", r.PathValue("id")))
+		return
+	}
+
+	if body != nil {
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+
+		if err := decoder.Decode(body); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %w", err))
+			return
+		}
+	}
+
+	res, err := fn(c)
+
+	code := http.StatusOK
+	if err != nil {
+		code = status(err)
+	} else if res.Error != nil {
+		code, err = http.StatusConflict, res.Error
+	}
+
+	result := CommandResult{Request: r.Method + " " + r.URL.Path, Status: code, Result: res.Result}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	s.publish(Event{Type: "result", Device: d.ID, Time: time.Now(), Data: result})
+
+	if err != nil {
+		writeError(w, code, err)
+		return
+	}
+
+	writeJSON(w, code, res)
+}
+
+// status tells a value refused by a setter from a lamp that could not be reached.
+func status(err error) int {
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, net.ErrClosed) || errors.Is(err, yeelight.ErrClosed) {
+		return http.StatusBadGateway
+	}
+
+	return http.StatusBadRequest
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
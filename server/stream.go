@@ -0,0 +1,438 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LordAur/yeelight"
+)
+
+/*
+Event is a message of the live stream. Every device first gets a "state" event with its full state, then:
+
+	"change"   a property changed, Data is a yeelight.Change
+	"online"   the connection to the device is back
+	"offline"  the connection to the device was lost
+	"result"   a command was sent through the API, Data is a CommandResult
+*/
+type Event struct {
+	Type   string      `json:"type"`
+	Device string      `json:"device"`
+	Time   time.Time   `json:"time"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// CommandResult is the outcome of a command sent through the API.
+type CommandResult struct {
+	Request string        `json:"request"`
+	Status  int           `json:"status"`
+	Result  []interface{} `json:"result,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// listener is one stream, ids is nil when it wants every device.
+type listener struct {
+	ids map[string]bool
+	ch  chan Event
+}
+
+func (l *listener) wants(id string) bool {
+	return l.ids == nil || l.ids[id]
+}
+
+func (l *listener) send(ctx context.Context, e Event) {
+	select {
+	case l.ch <- e:
+	case <-ctx.Done():
+	}
+}
+
+// publish hands an event to every stream that wants it, a stream that does not keep up misses it.
+func (s *Server) publish(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for l := range s.listeners {
+		if l.wants(e.Device) {
+			select {
+			case l.ch <- e:
+			default:
+			}
+		}
+	}
+}
+
+// filter reads the "device" (ID or name) and "group" query parameters, nil means every device.
+func (s *Server) filter(r *http.Request) (map[string]bool, error) {
+	q := r.URL.Query()
+	if len(q["device"]) == 0 && len(q["group"]) == 0 {
+		return nil, nil
+	}
+
+	ids := map[string]bool{}
+	for _, name := range q["device"] {
+		d, _, ok := s.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("device %s is unknown", name)
+		}
+
+		ids[d.ID] = true
+	}
+
+	for _, name := range q["group"] {
+		members, ok := s.Groups[name]
+		if !ok {
+			return nil, fmt.Errorf("group %s is unknown", name)
+		}
+
+		for _, id := range members {
+			ids[id] = true
+		}
+	}
+
+	return ids, nil
+}
+
+// stream starts the events of a request, they stop when the context is done.
+func (s *Server) stream(ctx context.Context, r *http.Request) (<-chan Event, error) {
+	ids, err := s.filter(r)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &listener{ids: ids, ch: make(chan Event, 256)}
+
+	s.mu.Lock()
+	if s.listeners == nil {
+		s.listeners = map[*listener]bool{}
+	}
+	s.listeners[l] = true
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	go s.follow(ctx, l)
+
+	return l.ch, nil
+}
+
+/*
+follow sends the state of every wanted device and then its changes. Devices discovered later and devices that could
+not be reached are picked up by a scan every 10 seconds, a device reached after a failure gets a new "state" event.
+*/
+func (s *Server) follow(ctx context.Context, l *listener) {
+	var mu sync.Mutex
+	busy := map[string]bool{}
+	seen := map[string]bool{}
+
+	scan := func() {
+		for _, d := range s.Registry.Devices() {
+			if !l.wants(d.ID) {
+				continue
+			}
+
+			mu.Lock()
+			if busy[d.ID] {
+				mu.Unlock()
+				continue
+			}
+
+			first := !seen[d.ID]
+			busy[d.ID], seen[d.ID] = true, true
+			mu.Unlock()
+
+			go func(d yeelight.Device, first bool) {
+				defer func() {
+					mu.Lock()
+					busy[d.ID] = false
+					mu.Unlock()
+				}()
+
+				state := s.state(d)
+
+				var changes <-chan yeelight.Change
+				if state.Error == "" {
+					c, err := s.Registry.Get(d.ID)
+					if err == nil {
+						changes, err = c.SubscribeWith(ctx, yeelight.SubscribeOptions{Policy: yeelight.DropOldest})
+					}
+
+					if err != nil {
+						state.State, state.Error = nil, err.Error()
+					}
+				}
+
+				if first || changes != nil {
+					l.send(ctx, Event{Type: "state", Device: d.ID, Time: time.Now(), Data: state})
+				}
+
+				for c := range changes {
+					l.send(ctx, changeEvent(d.ID, c))
+				}
+			}(d, first)
+		}
+	}
+
+	scan()
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			scan()
+		}
+	}
+}
+
+func changeEvent(id string, c yeelight.Change) Event {
+	if c.Property == "online" {
+		if c.New == "true" {
+			return Event{Type: "online", Device: id, Time: c.Time}
+		}
+
+		return Event{Type: "offline", Device: id, Time: c.Time}
+	}
+
+	return Event{Type: "change", Device: id, Time: c.Time, Data: c}
+}
+
+// sse streams the events as Server-Sent Events, the event name is the type and the data the whole event.
+func (s *Server) sse(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	events, err := s.stream(r.Context(), r)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// A comment now and then keeps proxies from closing an idle stream.
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e := <-events:
+			data, _ := json.Marshal(e)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		}
+
+		flusher.Flush()
+	}
+}
+
+// websocket streams the events as WebSocket text messages, messages from the client are ignored.
+func (s *Server) websocket(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("expected a WebSocket upgrade"))
+		return
+	}
+
+	if version := r.Header.Get("Sec-WebSocket-Version"); version != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeError(w, http.StatusUpgradeRequired, fmt.Errorf("unsupported WebSocket version %q", version))
+		return
+	}
+
+	// A page of another site would otherwise read the lamps with the network access of the browser.
+	if origin := r.Header.Get("Origin"); !s.allowedOrigin(origin, r.Host) {
+		writeError(w, http.StatusForbidden, fmt.Errorf("origin %s is not allowed", origin))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := s.stream(ctx, r)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("upgrading is not supported"))
+		return
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	accept := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(accept[:]))
+
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	ws := &wsConn{conn: conn}
+
+	go func() {
+		ws.readLoop(rw.Reader)
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-events:
+			data, _ := json.Marshal(e)
+			if err := ws.write(wsText, data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// allowedOrigin tells if a WebSocket may be opened from "origin", the server's own pages always may.
+func (s *Server) allowedOrigin(origin, host string) bool {
+	if origin == "" {
+		return true
+	}
+
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, host) {
+		return true
+	}
+
+	return slices.ContainsFunc(s.Origins, func(o string) bool {
+		return strings.EqualFold(strings.TrimSuffix(o, "/"), origin)
+	})
+}
+
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+	wsPing  = 0x9
+	wsPong  = 0xA
+)
+
+// wsConn writes unmasked server frames, the writes of events and pongs are serialized.
+type wsConn struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (c *wsConn) write(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(append(header, payload...))
+
+	return err
+}
+
+// readLoop answers pings and returns when the client closes the connection.
+func (c *wsConn) readLoop(r *bufio.Reader) {
+	for {
+		var head [2]byte
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			return
+		}
+
+		opcode := head[0] & 0x0F
+		masked := head[1]&0x80 != 0
+		length := uint64(head[1] & 0x7F)
+
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(r, ext[:]); err != nil {
+				return
+			}
+			length = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(r, ext[:]); err != nil {
+				return
+			}
+			length = binary.BigEndian.Uint64(ext[:])
+		}
+
+		// The client has nothing to say but control frames, anything big is not a client of this stream.
+		if length > 1<<16 {
+			return
+		}
+
+		var mask [4]byte
+		if masked {
+			if _, err := io.ReadFull(r, mask[:]); err != nil {
+				return
+			}
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return
+		}
+
+		if masked {
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+		}
+
+		switch opcode {
+		case wsClose:
+			c.write(wsClose, payload)
+			return
+		case wsPing:
+			c.write(wsPong, payload)
+		}
+	}
+}
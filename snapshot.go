@@ -0,0 +1,280 @@
+package yeelight
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Light is the state of one light channel of a device, the main light or the background light.
+type Light struct {
+	Power bool `json:"power"`
+
+	// 1 - color, 2 - color temperature, 3 - hue and saturation.
+	ColorMode        int `json:"color_mode"`
+	Rgb              int `json:"rgb"`
+	ColorTemperature int `json:"ct"`
+	Hue              int `json:"hue"`
+	Saturation       int `json:"sat"`
+	Brightness       int `json:"bright"`
+
+	// The running flow as reported by the device, "count,action,duration,mode,value,brightness,...".
+	Flowing    bool   `json:"flowing"`
+	FlowParams string `json:"flow_params,omitempty"`
+}
+
+/*
+Snapshot is the full state of a lamp, it can be stored as JSON and applied again with Restore.
+Background is nil for devices without a background light, Moonlight is nil for devices without a nightlight.
+*/
+type Snapshot struct {
+	Light
+	Background *Light `json:"bg,omitempty"`
+	Moonlight  *bool  `json:"moonlight,omitempty"`
+}
+
+var snapshotProps = []interface{}{
+	"power", "color_mode", "rgb", "ct", "hue", "sat", "bright", "flowing", "flow_params",
+	"bg_power", "bg_lmode", "bg_rgb", "bg_ct", "bg_hue", "bg_sat", "bg_bright", "bg_flowing", "bg_flow_params",
+	"active_mode",
+}
+
+/*
+This function is used to read the full state of the lamp with one "get_prop".
+
+Example:
+
+	s, err := y.Snapshot()
+	if err != nil {
+		...
+	}
+
+	y.SetRGB(255, 0, 0, "sudden", 30)
+	time.Sleep(time.Second)
+
+	err = y.Restore(s)
+*/
+func (c *Config) Snapshot() (Snapshot, error) {
+	r, err := c.call("get_prop", snapshotProps...)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	if r.Error != nil {
+		return Snapshot{}, r.Error
+	}
+
+	if len(r.Result) != len(snapshotProps) {
+		return Snapshot{}, fmt.Errorf("device returned %d properties, expected %d", len(r.Result), len(snapshotProps))
+	}
+
+	values := make([]string, len(r.Result))
+	for i, v := range r.Result {
+		values[i] = fmt.Sprint(v)
+	}
+
+	s := Snapshot{Light: parseLight(values[0:9])}
+
+	// Unsupported properties come back empty.
+	if values[9] != "" {
+		bg := parseLight(values[9:18])
+		s.Background = &bg
+	}
+
+	if values[18] != "" {
+		moonlight := values[18] == "1"
+		s.Moonlight = &moonlight
+	}
+
+	return s, nil
+}
+
+func parseLight(v []string) Light {
+	atoi := func(s string) int {
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+
+	return Light{
+		Power:            v[0] == "on",
+		ColorMode:        atoi(v[1]),
+		Rgb:              atoi(v[2]),
+		ColorTemperature: atoi(v[3]),
+		Hue:              atoi(v[4]),
+		Saturation:       atoi(v[5]),
+		Brightness:       atoi(v[6]),
+		Flowing:          v[7] == "1",
+		FlowParams:       v[8],
+	}
+}
+
+/*
+This function is used to put the lamp back in the state of a snapshot. A running flow is started again,
+otherwise the color is applied with "set_scene". A light that was off is only switched off, a lamp ignores colors
+while it is off and would light up to take them. A lamp that was in moonlight is switched to it again.
+The brightness is applied as read, BrightnessScale is not used.
+*/
+func (c *Config) Restore(s Snapshot) error {
+	if err := c.restore("", s.Light, s.Moonlight); err != nil {
+		return err
+	}
+
+	if s.Background != nil {
+		return c.restore("bg_", *s.Background, nil)
+	}
+
+	return nil
+}
+
+func (c *Config) restore(prefix string, l Light, moonlight *bool) error {
+	if !l.Power {
+		return c.send(prefix+"set_power", "off", "sudden", 30)
+	}
+
+	// Mode 5 of "set_power" is the nightlight, mode 1 leaves it for the normal light the scene is applied to.
+	if moonlight != nil && *moonlight {
+		return c.send(prefix+"set_power", "on", "sudden", 30, 5)
+	}
+
+	if moonlight != nil {
+		if err := c.send(prefix+"set_power", "on", "sudden", 30, 1); err != nil {
+			return err
+		}
+	}
+
+	params, err := sceneParams(l)
+	if err != nil {
+		return err
+	}
+
+	return c.send(prefix+"set_scene", params...)
+}
+
+// send calls a method whose error object is an error too.
+func (c *Config) send(method string, params ...interface{}) error {
+	r, err := c.call(method, params...)
+	if err != nil {
+		return err
+	}
+
+	if r.Error != nil {
+		return r.Error
+	}
+
+	return nil
+}
+
+func sceneParams(l Light) ([]interface{}, error) {
+	scene, err := l.Scene()
+	if err != nil {
+		return nil, err
+	}
+
+	switch scene.Action {
+	case "color":
+		return []interface{}{scene.Action, scene.Color, scene.Brightness}, nil
+	case "ct":
+		return []interface{}{scene.Action, scene.ColorTemperature, scene.Brightness}, nil
+	case "hsv":
+		return []interface{}{scene.Action, scene.Hue, scene.Saturation, scene.Brightness}, nil
+	}
+
+	flow, err := flowParams(nil, scene.Duration, scene.Mode, scene.ColorFlow)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]interface{}{scene.Action}, flow...), nil
+}
+
+/*
+This function is used to turn the state of a light into the scene that shows it, a running flow becomes a "cf" scene.
+*/
+func (l Light) Scene() (Scene, error) {
+	bright := l.Brightness
+	if bright < 1 {
+		bright = 1
+	}
+
+	if l.Flowing && l.FlowParams != "" {
+		count, action, exprs, err := parseFlow(l.FlowParams)
+		if err == nil {
+			return Scene{Action: "cf", Duration: count, Mode: action, ColorFlow: exprs}, nil
+		}
+	}
+
+	switch l.ColorMode {
+	case 1:
+		return Scene{Action: "color", Color: l.Rgb, Brightness: bright}, nil
+	case 2:
+		return Scene{Action: "ct", ColorTemperature: l.ColorTemperature, Brightness: bright}, nil
+	case 3:
+		return Scene{Action: "hsv", Hue: l.Hue, Saturation: l.Saturation, Brightness: bright}, nil
+	}
+
+	return Scene{}, fmt.Errorf("color mode %d can't be restored", l.ColorMode)
+}
+
+// parseFlow reads "flow_params". Some firmwares report only the expressions, others prefix them with count and action.
+func parseFlow(params string) (count, action int, exprs []FlowExpression, err error) {
+	var values []int
+	for _, f := range strings.Split(params, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("flow params %q: %w", params, err)
+		}
+
+		values = append(values, v)
+	}
+
+	if len(values)%4 == 2 {
+		count, action, values = values[0], values[1], values[2:]
+	}
+
+	if len(values) == 0 || len(values)%4 != 0 {
+		return 0, 0, nil, fmt.Errorf("flow params %q are not a list of expressions", params)
+	}
+
+	for i := 0; i < len(values); i += 4 {
+		exprs = append(exprs, FlowExpression{
+			Duration:   values[i],
+			Mode:       values[i+1],
+			Value:      values[i+2],
+			Brightness: values[i+3],
+		})
+	}
+
+	return count, action, exprs, nil
+}
+
+/*
+This function is used to take a snapshot of every member at the same time. Snapshots are in the order of Members,
+a failed member has an empty snapshot and a MemberError in the combined error.
+*/
+func (g *Group) Snapshot() ([]Snapshot, error) {
+	snapshots := make([]Snapshot, len(g.Members))
+
+	_, err := g.each(func(i int, c *Config) (Response, error) {
+		s, err := c.Snapshot()
+		if err == nil {
+			snapshots[i] = s
+		}
+
+		return Response{}, err
+	})
+
+	return snapshots, err
+}
+
+/*
+This function is used to restore every member from the snapshots of Group.Snapshot, in the order of Members.
+*/
+func (g *Group) Restore(snapshots []Snapshot) ([]Result, error) {
+	if len(snapshots) != len(g.Members) {
+		return nil, fmt.Errorf("got %d snapshots for %d members", len(snapshots), len(g.Members))
+	}
+
+	return g.each(func(i int, c *Config) (Response, error) {
+		return Response{}, c.Restore(snapshots[i])
+	})
+}
@@ -0,0 +1,78 @@
+package spatial
+
+import (
+	"image/color"
+	"math"
+	"time"
+)
+
+// Effect gives the color at a position of the room at a moment of the effect.
+type Effect func(x, y float64, t time.Duration) color.RGBA
+
+/*
+This function is used to build a wave sweeping left to right. The colors repeat every "width" units
+and move "speed" units per second, a negative speed sweeps right to left.
+*/
+func Sweep(colors []color.RGBA, width, speed float64) Effect {
+	return func(x, y float64, t time.Duration) color.RGBA {
+		if len(colors) == 0 || width <= 0 {
+			return color.RGBA{A: 255}
+		}
+
+		p := (x - speed*t.Seconds()) / width
+		p = (p - math.Floor(p)) * float64(len(colors))
+
+		i := int(p) % len(colors)
+
+		return mix(colors[i], colors[(i+1)%len(colors)], p-math.Floor(p))
+	}
+}
+
+/*
+This function is used to build a still gradient from "from" at point (x0, y0) to "to" at point (x1, y1).
+Lamps beyond the points get the end colors.
+*/
+func Gradient(from, to color.RGBA, x0, y0, x1, y1 float64) Effect {
+	dx, dy := x1-x0, y1-y0
+	length := dx*dx + dy*dy
+
+	return func(x, y float64, t time.Duration) color.RGBA {
+		if length == 0 {
+			return from
+		}
+
+		f := ((x-x0)*dx + (y-y0)*dy) / length
+
+		return mix(from, to, math.Max(0, math.Min(1, f)))
+	}
+}
+
+/*
+This function is used to build a radial pulse. A ring of color "width" units wide leaves the point (cx, cy)
+every "period" and grows "speed" units per second.
+*/
+func Pulse(c color.RGBA, cx, cy, speed, width float64, period time.Duration) Effect {
+	return func(x, y float64, t time.Duration) color.RGBA {
+		if period > 0 {
+			t %= period
+		}
+
+		radius := speed * t.Seconds()
+		d := math.Hypot(x-cx, y-cy)
+
+		intensity := 0.0
+		if width > 0 {
+			intensity = math.Max(0, 1-math.Abs(d-radius)/width)
+		}
+
+		return mix(color.RGBA{A: 255}, c, intensity)
+	}
+}
+
+func mix(a, b color.RGBA, f float64) color.RGBA {
+	lerp := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x) + (float64(y)-float64(x))*f))
+	}
+
+	return color.RGBA{lerp(a.R, b.R), lerp(a.G, b.G), lerp(a.B, b.B), 255}
+}
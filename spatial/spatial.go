@@ -0,0 +1,169 @@
+/*
+Package spatial places lamps in a room and runs effects that depend on where each lamp is: a wave sweeping
+across the room, a gradient from one wall to the other, a pulse growing from a point.
+
+Effects can be streamed frame by frame over music mode, or sampled into one looping flow per lamp
+and started on all lamps at the same moment.
+
+Example:
+
+	room := &spatial.Room{
+		Lamps: []spatial.Lamp{
+			{X: 0, Y: 0, Config: &left},
+			{X: 2.5, Y: 0, Config: &middle},
+			{X: 5, Y: 0, Config: &right},
+		},
+	}
+
+	wave := spatial.Sweep([]color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}}, 5, 1)
+
+	results, err := room.StartFlows(wave, 5*time.Second, 20)
+*/
+package spatial
+
+import (
+	"context"
+	"image/color"
+	"math"
+	"time"
+
+	"github.com/LordAur/yeelight"
+)
+
+// Lamp is a lamp at a position of the room, in any unit as long as all lamps and effects use the same one.
+type Lamp struct {
+	X      float64
+	Y      float64
+	Config *yeelight.Config
+}
+
+type Room struct {
+	Lamps []Lamp
+
+	// Frames per second when streaming, default 10.
+	FPS int
+}
+
+/*
+This function is used to compute the color of every lamp at a moment of the effect, in the order of Lamps.
+*/
+func (r *Room) Frame(effect Effect, t time.Duration) []color.RGBA {
+	colors := make([]color.RGBA, len(r.Lamps))
+	for i, l := range r.Lamps {
+		colors[i] = effect(l.X, l.Y, t)
+	}
+
+	return colors
+}
+
+/*
+This function is used to sample one period of the effect into a flow per lamp, in the order of Lamps.
+Every flow has "steps" expressions, each one fading to the color of the next sample.
+*/
+func (r *Room) Flows(effect Effect, period time.Duration, steps int) [][]yeelight.FlowExpression {
+	if steps < 1 {
+		steps = 1
+	}
+
+	duration := max(30, int(period/time.Millisecond)/steps)
+
+	flows := make([][]yeelight.FlowExpression, len(r.Lamps))
+	for k := 0; k < steps; k++ {
+		// Each expression fades to the sample at its end.
+		t := period * time.Duration(k+1) / time.Duration(steps)
+
+		for i, c := range r.Frame(effect, t) {
+			rgb, brightness := split(c)
+			flows[i] = append(flows[i], yeelight.FlowExpression{
+				Duration:   duration,
+				Mode:       1,
+				Value:      rgb,
+				Brightness: brightness,
+			})
+		}
+	}
+
+	return flows
+}
+
+/*
+This function is used to sample the effect into flows and start them looping on every lamp at the same moment.
+*/
+func (r *Room) StartFlows(effect Effect, period time.Duration, steps int) ([]yeelight.Result, error) {
+	members := make([]*yeelight.Config, len(r.Lamps))
+	for i, l := range r.Lamps {
+		members[i] = l.Config
+	}
+
+	s := &yeelight.SyncFlow{Members: members}
+
+	return s.StartEach(0, 1, r.Flows(effect, period, steps))
+}
+
+/*
+This function is used to stream the effect over music mode until the context is cancelled.
+Music mode is started on every lamp and left when the function returns.
+*/
+func (r *Room) Stream(ctx context.Context, effect Effect) error {
+	targets := make([]*yeelight.Music, len(r.Lamps))
+	for i, l := range r.Lamps {
+		m, err := l.Config.StartMusic()
+		if err != nil {
+			for _, t := range targets[:i] {
+				t.Close()
+			}
+
+			return err
+		}
+
+		targets[i] = m
+	}
+
+	defer func() {
+		for _, t := range targets {
+			t.Close()
+		}
+	}()
+
+	fps := r.FPS
+	if fps <= 0 {
+		fps = 10
+	}
+
+	frame := time.Second / time.Duration(fps)
+	ticker := time.NewTicker(frame)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for {
+		for i, c := range r.Frame(effect, time.Since(start)) {
+			rgb, brightness := split(c)
+
+			err := targets[i].SetScene(yeelight.Scene{Action: "color", Color: rgb, Brightness: brightness})
+			if err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// split shows the hue at full value and turns the value into the brightness.
+func split(c color.RGBA) (rgb int, brightness int) {
+	value := max(c.R, c.G, c.B)
+	if value == 0 {
+		return 0, 1
+	}
+
+	scale := 255 / float64(value)
+	red := int(math.Round(float64(c.R) * scale))
+	green := int(math.Round(float64(c.G) * scale))
+	blue := int(math.Round(float64(c.B) * scale))
+
+	return (red * 65536) + (green * 256) + blue, max(1, int(math.Round(float64(value)*100/255)))
+}
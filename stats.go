@@ -0,0 +1,130 @@
+package yeelight
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds in seconds of the latency buckets of MethodStats.
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// MethodStats are the counters of the calls of one method.
+type MethodStats struct {
+	Calls int64
+
+	// Failed calls by device error code, "timeout" when no answer came in time, "canceled" when the caller gave up
+	// and "connection" when it failed.
+	Errors map[string]int64
+
+	// Buckets[i] counts the calls that took more than LatencyBuckets[i-1] and at most LatencyBuckets[i] seconds,
+	// slower calls are only in Calls.
+	Buckets  []int64
+	Duration time.Duration
+}
+
+/*
+Stats are the counters of a device connection since it was created, shared by every Config and proxy client using it.
+Every connect after the first one is a reconnect. QuotaRejections counts the commands refused because a quota was
+exceeded, by the device or by a Proxy in front of it.
+*/
+type Stats struct {
+	Methods         map[string]MethodStats
+	Connects        int64
+	Notifications   int64
+	QuotaRejections int64
+}
+
+type connStats struct {
+	methods       map[string]*MethodStats
+	connects      int64
+	notifications int64
+	quota         int64
+}
+
+// record counts a finished call. The lock must be held.
+func (s *connStats) record(method string, took time.Duration, r Response, err error) {
+	if s.methods == nil {
+		s.methods = map[string]*MethodStats{}
+	}
+
+	m, ok := s.methods[method]
+	if !ok {
+		m = &MethodStats{Errors: map[string]int64{}, Buckets: make([]int64, len(LatencyBuckets))}
+		s.methods[method] = m
+	}
+
+	m.Calls++
+	m.Duration += took
+
+	for i, bound := range LatencyBuckets {
+		if took.Seconds() <= bound {
+			m.Buckets[i]++
+			break
+		}
+	}
+
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		m.Errors["timeout"]++
+	case errors.Is(err, context.Canceled):
+		m.Errors["canceled"]++
+	case err != nil:
+		m.Errors["connection"]++
+	case r.Error != nil:
+		m.Errors[strconv.Itoa(r.Error.Code)]++
+
+		if strings.Contains(r.Error.Message, "quota") {
+			s.quota++
+		}
+	}
+}
+
+func (c *Conn) rejected() {
+	c.mu.Lock()
+	c.stats.quota++
+	c.mu.Unlock()
+}
+
+/*
+This function is used to read the counters of the connection.
+*/
+func (c *Conn) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := Stats{
+		Methods:         make(map[string]MethodStats, len(c.stats.methods)),
+		Connects:        c.stats.connects,
+		Notifications:   c.stats.notifications,
+		QuotaRejections: c.stats.quota,
+	}
+
+	for method, m := range c.stats.methods {
+		copied := *m
+		copied.Buckets = append([]int64(nil), m.Buckets...)
+		copied.Errors = make(map[string]int64, len(m.Errors))
+
+		for code, n := range m.Errors {
+			copied.Errors[code] = n
+		}
+
+		s.Methods[method] = copied
+	}
+
+	return s
+}
+
+/*
+This function is used to read the counters of the device connection, see Stats.
+*/
+func (c *Config) Stats() Stats {
+	if c.conn == nil {
+		return Stats{}
+	}
+
+	return c.conn.Stats()
+}
@@ -0,0 +1,231 @@
+package yeelight
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Change is a property of the device that changed, values are formatted like the answer of "get_prop".
+type Change struct {
+	Property string    `json:"property"`
+	Old      string    `json:"old"`
+	New      string    `json:"new"`
+	Time     time.Time `json:"time"`
+}
+
+/*
+This function is used to read the new value of a numeric property like "bright" or "ct".
+*/
+func (c Change) Int() (int, error) {
+	return strconv.Atoi(c.New)
+}
+
+// SlowConsumer is what a subscription does when its buffer is full. The connection reader never waits for a subscriber.
+type SlowConsumer int
+
+const (
+	// The change that does not fit is dropped.
+	DropNewest SlowConsumer = iota
+
+	// The oldest buffered change is dropped to make room, the subscriber sees the latest state.
+	DropOldest
+
+	// The subscription ends and its channel is closed.
+	Disconnect
+)
+
+// SubscribeOptions configures a subscription, the zero value buffers 64 changes and drops the newest.
+type SubscribeOptions struct {
+	Buffer int
+	Policy SlowConsumer
+}
+
+/*
+This function is used to receive the changes of the given properties, or of every property when none is given.
+A change is sent when a notification, a command through this connection or a refresh gives a property a new value,
+the old value comes from the cache that is seeded first, see Properties. Subscribe to "online" to learn when the
+connection is lost or back. The channel is closed when the context is cancelled or the config is closed.
+
+Example:
+
+	changes, err := y.Subscribe(ctx, "power", "bright")
+	if err != nil {
+		...
+	}
+
+	for c := range changes {
+		fmt.Printf("%s changed from %s to %s\n", c.Property, c.Old, c.New)
+	}
+*/
+func (c *Config) Subscribe(ctx context.Context, props ...string) (<-chan Change, error) {
+	return c.SubscribeWith(ctx, SubscribeOptions{}, props...)
+}
+
+/*
+This function is used to subscribe like Subscribe with another buffer size or slow consumer policy.
+*/
+func (c *Config) SubscribeWith(ctx context.Context, opts SubscribeOptions, props ...string) (<-chan Change, error) {
+	if c.conn == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	if _, err := c.Properties(); err != nil {
+		return nil, err
+	}
+
+	buffer := opts.Buffer
+	if buffer <= 0 {
+		buffer = 64
+	}
+
+	wanted := map[string]bool{}
+	for _, p := range props {
+		wanted[p] = true
+	}
+
+	ch := make(chan Change, buffer)
+	done := make(chan struct{})
+
+	var once sync.Once
+	s := &subscription{
+		changed: func(changes []Change) bool {
+			for _, change := range changes {
+				if len(wanted) > 0 && !wanted[change.Property] {
+					continue
+				}
+
+				if !send(ch, change, opts.Policy) {
+					return false
+				}
+			}
+
+			return true
+		},
+		end: func() {
+			once.Do(func() {
+				close(ch)
+				close(done)
+			})
+		},
+	}
+
+	if err := c.conn.subscribe(s); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.conn.unsubscribe(s)
+		case <-done:
+		}
+	}()
+
+	return ch, nil
+}
+
+// send puts a change in the buffer without waiting, false means the subscription should end.
+func send(ch chan Change, change Change, policy SlowConsumer) bool {
+	select {
+	case ch <- change:
+		return true
+	default:
+	}
+
+	switch policy {
+	case DropOldest:
+		// Only the connection sends, so after one receive there is room.
+		select {
+		case <-ch:
+		default:
+		}
+
+		ch <- change
+	case Disconnect:
+		return false
+	}
+
+	return true
+}
+
+// Failure is a call that failed, Error is the error of the call or the error object answered by the device.
+type Failure struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+	Error  string        `json:"error"`
+	Time   time.Time     `json:"time"`
+}
+
+/*
+This function is used to receive the calls that fail on the connection of the device, sent through any Config or
+proxy client sharing it. A failure is dropped when the channel is full, the channel is closed when the context is
+cancelled or the config is closed.
+
+Example:
+
+	failures, err := y.Failures(ctx)
+	if err != nil {
+		...
+	}
+
+	for f := range failures {
+		fmt.Printf("%s failed: %s\n", f.Method, f.Error)
+	}
+*/
+func (c *Config) Failures(ctx context.Context) (<-chan Failure, error) {
+	if c.conn == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	ch := make(chan Failure, 16)
+	done := make(chan struct{})
+
+	var once sync.Once
+	s := &subscription{
+		failed: func(f Failure) {
+			select {
+			case ch <- f:
+			default:
+			}
+		},
+		end: func() {
+			once.Do(func() {
+				close(ch)
+				close(done)
+			})
+		},
+	}
+
+	if err := c.conn.subscribe(s); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.conn.unsubscribe(s)
+		case <-done:
+		}
+	}()
+
+	return ch, nil
+}
+
+// fail tells the subscribers about a failed call. The lock must be held.
+func (c *Conn) fail(method string, params []interface{}, r Response, err error) {
+	f := Failure{Method: method, Params: params, Time: time.Now()}
+	if err != nil {
+		f.Error = err.Error()
+	} else {
+		f.Error = r.Error.Error()
+	}
+
+	for s := range c.subs {
+		if s.failed != nil {
+			s.failed(f)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LordAur/yeelight/ambient"
+)
+
+type recordingLamp struct {
+	rgb    []int
+	bright []int
+}
+
+func (l *recordingLamp) SetRGB(red, green, blue int, effect string, duration int) error {
+	l.rgb = append(l.rgb, red*65536+green*256+blue)
+	return nil
+}
+
+func (l *recordingLamp) SetBright(brightness int, effect string, duration int) error {
+	l.bright = append(l.bright, brightness)
+	return nil
+}
+
+func writeFrame(t *testing.T, path string, left, right color.RGBA) {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 18))
+	for y := 0; y < 18; y++ {
+		for x := 0; x < 32; x++ {
+			if x < 16 {
+				img.Set(x, y, left)
+			} else {
+				img.Set(x, y, right)
+			}
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAmbientSync(t *testing.T) {
+	dir := t.TempDir()
+	red, blue, dim := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}, color.RGBA{0, 0, 128, 255}
+
+	writeFrame(t, filepath.Join(dir, "frame1.png"), red, blue)
+	writeFrame(t, filepath.Join(dir, "frame2.png"), red, dim)
+
+	src, err := ambient.Dir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	left, right := &recordingLamp{}, &recordingLamp{}
+	s := &ambient.Sync{
+		Source: src,
+		Zones: []ambient.Zone{
+			{Region: ambient.Region{X: 0, Y: 0, W: 0.5, H: 1}, Lamps: []ambient.Target{left}},
+			{Region: ambient.Region{X: 0.5, Y: 0, W: 0.5, H: 1}, Lamps: []ambient.Target{right}, Dominant: true},
+		},
+		FPS: 100,
+	}
+
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(left.rgb, left.bright) != "[16711680] [100]" {
+		t.Errorf("left lamp got %v %v, expected one red update", left.rgb, left.bright)
+	}
+
+	// Blue stays blue, only the brightness follows the darker frame halfway.
+	if fmt.Sprint(right.rgb, right.bright) != "[255] [100 75]" {
+		t.Errorf("right lamp got %v %v", right.rgb, right.bright)
+	}
+}
+
+func TestAmbientDominant(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			switch {
+			case y < 10 || y >= 30:
+				// Letterbox bars.
+			case x < 25:
+				img.Set(x, y, color.RGBA{250, 200, 0, 255})
+			default:
+				img.Set(x, y, color.RGBA{0, 100, 0, 255})
+			}
+		}
+	}
+
+	c := ambient.Dominant(img, ambient.Region{X: 0, Y: 0, W: 1, H: 1})
+	if c != (color.RGBA{250, 200, 0, 255}) {
+		t.Errorf("expected yellow, got %v", c)
+	}
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/audio"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+func TestAudioDriver(t *testing.T) {
+	lamp, y := fakeLamp(t, yeelighttest.Options{})
+
+	m, err := y.StartMusic()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open("testdata/beat.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	src, err := audio.ReadWAV(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	beats := 0
+	d := &audio.Driver{
+		Source: src,
+		Target: m,
+		FPS:    20,
+		OnFrame: func(f audio.Features, scene yeelight.Scene) {
+			if f.Beat {
+				beats++
+			}
+		},
+	}
+
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Close()
+
+	// The lamp leaves music mode once it ran every command sent before the close.
+	eventually(t, "the lamp to leave music mode", func() bool { return lamp.Get("music_on") == "0" })
+
+	frames, full := 0, 0
+	for _, r := range lamp.Requests() {
+		if r.Method == "set_music" || r.Method == "get_prop" {
+			continue
+		}
+
+		if r.Method != "set_scene" {
+			t.Fatalf("unexpected method %s", r.Method)
+		}
+
+		frames++
+		if fmt.Sprint(r.Params.([]interface{})[3]) == "100" {
+			full++
+		}
+	}
+
+	if frames != 20 {
+		t.Errorf("expected 20 frames, got %d", frames)
+	}
+
+	// The fixture has four kicks, the first one has no history to compare with.
+	if beats < 3 || beats > 4 {
+		t.Errorf("expected 3 or 4 beats, got %d", beats)
+	}
+
+	if full < beats {
+		t.Errorf("expected every beat at full brightness, got %d of %d", full, beats)
+	}
+}
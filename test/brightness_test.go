@@ -0,0 +1,38 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/LordAur/yeelight"
+)
+
+func TestBrightnessScale(t *testing.T) {
+	scales := map[string]yeelight.BrightnessScale{
+		"gamma": yeelight.Gamma(2.2),
+		"cie":   yeelight.CIELightness{},
+	}
+
+	for name, scale := range scales {
+		if scale.ToDevice(1) != 1 || scale.ToDevice(100) != 100 {
+			t.Errorf("%s: endpoints should stay 1 and 100, got %d and %d", name, scale.ToDevice(1), scale.ToDevice(100))
+		}
+
+		previous := 0
+		for b := 1; b <= 100; b++ {
+			d := scale.ToDevice(b)
+			if d < previous {
+				t.Errorf("%s: not monotonic at %d", name, b)
+			}
+			previous = d
+
+			if back := scale.FromDevice(d); d > 10 && (back < b-3 || back > b+3) {
+				t.Errorf("%s: %d maps to %d and back to %d", name, b, d, back)
+			}
+		}
+	}
+
+	// Half the lightness is about 18% of the light.
+	if d := (yeelight.CIELightness{}).ToDevice(50); d != 18 {
+		t.Errorf("L* 50 should be 18, got %d", d)
+	}
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+func TestPropertiesCache(t *testing.T) {
+	lamp, y := fakeLamp(t, yeelighttest.Options{State: map[string]string{"bright": "40"}})
+
+	p, err := y.Properties()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Get("power") != "on" || p.Get("bright") != "40" || p.Get("bg_power") != "" {
+		t.Errorf("unexpected seed %v", p.Values)
+	}
+
+	if _, err := y.SetRGB(255, 0, 0, "sudden", 30); err != nil {
+		t.Fatal(err)
+	}
+
+	p, _ = y.Properties()
+	if p.Get("rgb") != "16711680" || p.Get("color_mode") != "1" {
+		t.Errorf("expected the command to update the cache, got %v", p.Values)
+	}
+
+	lamp.Set(map[string]string{"bright": "75", "rgb": "65280"})
+
+	deadline := time.Now().Add(time.Second)
+	for p.Get("bright") != "75" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		p, _ = y.Properties()
+	}
+
+	if bright, _ := p.Int("bright"); bright != 75 || p.Get("rgb") != "65280" {
+		t.Errorf("expected the notification to update the cache, got %v", p.Values)
+	}
+
+	if p.Age() > time.Second {
+		t.Errorf("expected a fresh state, updated %v ago", p.Age())
+	}
+
+	if n := len(requests(lamp, "get_prop")); n != 1 {
+		t.Errorf("expected reads to be served from the cache, the lamp got %d get_prop", n)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	lamp, y := fakeLamp(t, yeelighttest.Options{State: map[string]string{"bright": "40"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	latest, err := y.SubscribeWith(ctx, yeelight.SubscribeOptions{Buffer: 2, Policy: yeelight.DropOldest}, "bright")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strict, err := y.SubscribeWith(ctx, yeelight.SubscribeOptions{Buffer: 1, Policy: yeelight.Disconnect})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lamp.Set(map[string]string{"bright": "50"})
+	lamp.Set(map[string]string{"bright": "60", "power": "off"})
+	lamp.Set(map[string]string{"bright": "70"})
+
+	deadline := time.Now().Add(time.Second)
+	for p, _ := y.Properties(); p.Get("bright") != "70" && time.Now().Before(deadline); p, _ = y.Properties() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, want := range []yeelight.Change{{Property: "bright", Old: "50", New: "60"}, {Property: "bright", Old: "60", New: "70"}} {
+		c := <-latest
+		if c.Property != want.Property || c.Old != want.Old || c.New != want.New || c.Time.IsZero() {
+			t.Errorf("expected %s %s -> %s, got %+v", want.Property, want.Old, want.New, c)
+		}
+	}
+
+	// The first change filled the buffer of one, the second ended the subscription.
+	if c, ok := <-strict; !ok || c.New != "50" {
+		t.Errorf("expected the first change, got %+v", c)
+	}
+
+	if _, ok := <-strict; ok {
+		t.Error("expected the slow subscriber to be disconnected")
+	}
+
+	cancel()
+
+	select {
+	case _, ok := <-latest:
+		if ok {
+			t.Error("expected no more changes after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the channel to be closed after cancel")
+	}
+}
@@ -0,0 +1,86 @@
+package test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/circadian"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+func TestSunTimes(t *testing.T) {
+	// London, summer solstice 2024: sunrise 03:43 UTC, sunset 20:21 UTC.
+	sunrise, sunset, ok := circadian.SunTimes(time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC), 51.5074, -0.1278)
+	if !ok {
+		t.Fatal("expected sunrise and sunset")
+	}
+
+	if d := sunrise.Sub(time.Date(2024, 6, 21, 3, 43, 0, 0, time.UTC)); d < -3*time.Minute || d > 3*time.Minute {
+		t.Errorf("sunrise %v is off by %v", sunrise, d)
+	}
+
+	if d := sunset.Sub(time.Date(2024, 6, 21, 20, 21, 0, 0, time.UTC)); d < -3*time.Minute || d > 3*time.Minute {
+		t.Errorf("sunset %v is off by %v", sunset, d)
+	}
+
+	// Tromsø has midnight sun at the solstice.
+	_, _, ok = circadian.SunTimes(time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC), 69.6492, 18.9553)
+	if ok {
+		t.Error("expected no sunset during polar day")
+	}
+}
+
+func TestCircadianTarget(t *testing.T) {
+	c := &circadian.Controller{
+		Latitude:  51.5074,
+		Longitude: -0.1278,
+		MinKelvin: 2000,
+		MaxKelvin: 6000,
+	}
+
+	temp, bright := c.Target(time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC))
+	if temp != 6000 || bright != 100 {
+		t.Errorf("noon target = %d K, %d%%", temp, bright)
+	}
+
+	temp, bright = c.Target(time.Date(2024, 12, 21, 0, 0, 0, 0, time.UTC))
+	if temp != 2000 || bright != 10 {
+		t.Errorf("midnight target = %d K, %d%%", temp, bright)
+	}
+}
+
+func TestCircadianRun(t *testing.T) {
+	d, y := fakeLamp(t, yeelighttest.Options{})
+
+	c := &circadian.Controller{
+		Lamps:     []*yeelight.Config{&y},
+		Latitude:  51.5074,
+		Longitude: -0.1278,
+		Interval:  50 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+
+	// Target only reads the settings, it may run next to Run.
+	var temp int
+	for i := 0; i < 10; i++ {
+		temp, _ = c.Target(time.Now())
+	}
+
+	for deadline := time.Now().Add(3 * time.Second); d.Get("ct") != strconv.Itoa(temp); {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the lamp at %d K, got %s", temp, d.Get("ct"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected the controller to stop with the context, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+// buildCLI builds the yeelight command into the temporary directory of the test.
+func buildCLI(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "yeelight")
+
+	out, err := exec.Command("go", "build", "-o", path, "github.com/LordAur/yeelight/cmd/yeelight").CombinedOutput()
+	if err != nil {
+		t.Skipf("building the command: %v: %s", err, out)
+	}
+
+	return path
+}
+
+// runCLI runs the command, it returns what it printed and its exit code.
+func runCLI(t *testing.T, path string, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+
+	var out, errOut bytes.Buffer
+	cmd := exec.Command(path, args...)
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+
+	err := cmd.Run()
+
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		code = exit.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	return out.String(), errOut.String(), code
+}
+
+func TestCommandLine(t *testing.T) {
+	lamp := newLamp(t, yeelighttest.Options{State: map[string]string{"power": "on", "bright": "40"}})
+	addr := lamp.Addr().String()
+
+	cli := buildCLI(t)
+	run := func(args ...string) (string, string, int) {
+		t.Helper()
+		return runCLI(t, cli, args...)
+	}
+
+	if _, stderr, code := run(); code != 2 || !strings.Contains(stderr, "usage:") {
+		t.Errorf("expected the usage without a command, got %d %q", code, stderr)
+	}
+
+	if _, stderr, code := run("-d", addr, "blink"); code != 2 || !strings.Contains(stderr, `unknown command "blink"`) {
+		t.Errorf("expected an unknown command to be refused, got %d %q", code, stderr)
+	}
+
+	if _, stderr, code := run("-d", addr, "bright", "full"); code != 1 || stderr != "yeelight: \"full\" is not a number\n" {
+		t.Errorf("expected a bad argument to be refused, got %d %q", code, stderr)
+	}
+
+	if _, stderr, code := run("-d", addr, "rgb", "255"); code != 1 || !strings.Contains(stderr, "expected 3 arguments, got 1") {
+		t.Errorf("expected missing arguments to be refused, got %d %q", code, stderr)
+	}
+
+	if len(lamp.Requests()) != 0 {
+		t.Fatalf("expected no request for refused arguments, got %v", lamp.Requests())
+	}
+
+	if stdout, _, code := run("-d", addr, "props", "power", "bright"); code != 0 || stdout != "power: on\nbright: 40\n" {
+		t.Errorf("unexpected props %d %q", code, stdout)
+	}
+
+	if stdout, _, code := run("-d", addr, "-duration", "0", "bright", "30"); code != 0 || stdout != "ok\n" {
+		t.Errorf("unexpected answer to bright %d %q", code, stdout)
+	}
+
+	if got := requests(lamp, "set_bright"); len(got) != 1 || got[0] != `[30,"sudden",30]` {
+		t.Errorf("expected a sudden change with -duration 0, got %v", got)
+	}
+
+	// A name is looked up in the registry file, without searching the LAN.
+	path := filepath.Join(t.TempDir(), "devices.json")
+
+	registry, err := yeelight.NewRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry.Update(yeelight.Device{ID: "0x1", Name: "Desk", IpAddress: lamp.Addr().IP.String(), Port: lamp.Addr().Port})
+	registry.Close()
+
+	stdout, _, code := run("-registry", path, "-d", "desk", "-json", "props", "bright")
+	if code != 0 {
+		t.Fatalf("expected the lamp to be found by name, exit code %d", code)
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal([]byte(stdout), &values); err != nil || values["bright"] != "30" {
+		t.Errorf("unexpected JSON %q %v", stdout, err)
+	}
+}
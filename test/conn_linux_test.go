@@ -0,0 +1,93 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/LordAur/yeelight"
+)
+
+/*
+unreachableLamp connects to a listener that then stops accepting: its queue of one connection is full, so a dial
+hangs like one to a lamp that lost its WiFi. The first connection is taken from the queue and closed, the Config
+has to dial again on its next call.
+*/
+func unreachableLamp(t *testing.T) yeelight.Config {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { syscall.Close(fd) })
+
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := syscall.Listen(fd, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	sa, _ := syscall.Getsockname(fd)
+	port := sa.(*syscall.SockaddrInet4).Port
+
+	y := yeelight.New(&yeelight.Config{IpAddress: "127.0.0.1", Port: port})
+	t.Cleanup(y.Close)
+
+	accepted, _, err := syscall.Accept(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syscall.Close(accepted)
+
+	eventually(t, "the connection to be dropped", func() bool {
+		p, _ := y.Cached()
+		return p.Get("online") == "false"
+	})
+
+	// The connection waiting in the queue fills it.
+	filler, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { filler.Close() })
+
+	return y
+}
+
+func TestSharedConnectionDial(t *testing.T) {
+	y := unreachableLamp(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	called := make(chan error, 1)
+	go func() {
+		_, err := y.WithContext(ctx).GetProps("power")
+		called <- err
+	}()
+
+	// The dial is running, reading the state of the connection does not wait for it.
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	y.Cached()
+	y.Stats()
+
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("reading the cache and stats waited %v for the dial", elapsed)
+	}
+
+	select {
+	case err := <-called:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the call to give up with its context, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the dial did not honour the context of the call")
+	}
+}
@@ -0,0 +1,44 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+func TestSharedConnection(t *testing.T) {
+	lamp, y := fakeLamp(t, yeelighttest.Options{})
+
+	notifications, stop := y.Notifications()
+	defer stop()
+
+	for i := 0; i < 3; i++ {
+		r, err := y.SetBright(10+i, "sudden", 30)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(r.Result) != 1 || r.Result[0] != "ok" {
+			t.Fatalf("call %d got %+v", i, r)
+		}
+
+		select {
+		case n := <-notifications:
+			if n.Method != "props" || n.Params.Brightness != 10+i {
+				t.Errorf("call %d: expected the notification of the change, got %+v", i, n)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("call %d: no notification", i)
+		}
+	}
+
+	if n := lamp.Connections(); n != 1 {
+		t.Errorf("expected commands and notifications on one connection, the lamp has %d", n)
+	}
+
+	stop()
+	if _, ok := <-notifications; ok {
+		t.Error("expected the channel to be closed after stop")
+	}
+}
@@ -0,0 +1,185 @@
+package test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LordAur/yeelight/dmx"
+)
+
+// dmxLamp records the commands it gets as "method args".
+type dmxLamp struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (l *dmxLamp) record(format string, args ...interface{}) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.calls = append(l.calls, fmt.Sprintf(format, args...))
+
+	return nil
+}
+
+func (l *dmxLamp) SetPower(power bool, effect string, duration int) error {
+	return l.record("power %v", power)
+}
+
+func (l *dmxLamp) SetRGB(red, green, blue int, effect string, duration int) error {
+	return l.record("rgb %d %d %d", red, green, blue)
+}
+
+func (l *dmxLamp) SetBright(brightness int, effect string, duration int) error {
+	return l.record("bright %d", brightness)
+}
+
+func (l *dmxLamp) SetColorTemp(temp int, effect string, duration int) error {
+	return l.record("ct %d", temp)
+}
+
+// waitFor waits until the lamp got the command, the commands before it are dropped.
+func (l *dmxLamp) waitFor(t *testing.T, call string) {
+	t.Helper()
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		l.mu.Lock()
+		for i, c := range l.calls {
+			if c == call {
+				l.calls = l.calls[i+1:]
+				l.mu.Unlock()
+				return
+			}
+		}
+		l.mu.Unlock()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	t.Fatalf("expected %q, got %q", call, l.calls)
+}
+
+// sacnPacket builds an E1.31 data packet like a console sends it.
+func sacnPacket(cid byte, universe, priority int, sequence, options byte, data []byte) []byte {
+	p := make([]byte, 126+len(data))
+
+	binary.BigEndian.PutUint16(p[0:], 0x0010)
+	copy(p[4:], "ASC-E1.17\x00\x00\x00")
+	binary.BigEndian.PutUint16(p[16:], 0x7000|uint16(len(p)-16))
+	binary.BigEndian.PutUint32(p[18:], 0x00000004)
+	p[22+15] = cid
+
+	binary.BigEndian.PutUint16(p[38:], 0x7000|uint16(len(p)-38))
+	binary.BigEndian.PutUint32(p[40:], 0x00000002)
+	copy(p[44:], "test console")
+	p[108] = byte(priority)
+	p[111] = sequence
+	p[112] = options
+	binary.BigEndian.PutUint16(p[113:], uint16(universe))
+
+	binary.BigEndian.PutUint16(p[115:], 0x7000|uint16(len(p)-115))
+	p[117], p[118] = 0x02, 0xA1
+	binary.BigEndian.PutUint16(p[121:], 1)
+	binary.BigEndian.PutUint16(p[123:], uint16(len(data)+1))
+	copy(p[126:], data)
+
+	return p
+}
+
+// artNetPacket builds an ArtDmx packet.
+func artNetPacket(universe int, sequence byte, data []byte) []byte {
+	p := append([]byte("Art-Net\x00"), 0x00, 0x50, 0, 14, sequence, 0, byte(universe), byte(universe>>8))
+	p = binary.BigEndian.AppendUint16(p, uint16(len(data)))
+
+	return append(p, data...)
+}
+
+func TestDMXReceiver(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	color, white, spot := &dmxLamp{}, &dmxLamp{}, &dmxLamp{}
+
+	r := &dmx.Receiver{
+		Patches: []dmx.Patch{
+			{Universe: 1, Address: 1, Mode: dmx.DimmerRGB, Lamp: color},
+			{Universe: 1, Address: 5, Mode: dmx.DimmerCT, Lamp: white},
+			{Universe: 2, Address: 1, Mode: dmx.Dimmer, Lamp: spot},
+		},
+		SourceTimeout: 300 * time.Millisecond,
+		MaxRate:       100,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- r.Serve(ctx, conn) }()
+
+	console, err := net.Dial("udp4", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer console.Close()
+
+	send := func(p []byte) {
+		if _, err := console.Write(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A console at the default priority: red at full, warm white at half.
+	send(sacnPacket(1, 1, 100, 1, 0, []byte{255, 255, 0, 0, 128, 0}))
+	color.waitFor(t, "power true")
+	color.waitFor(t, "rgb 255 0 0")
+	color.waitFor(t, "bright 100")
+	white.waitFor(t, "ct 1700")
+	white.waitFor(t, "bright 50")
+
+	// A backup console with a higher priority takes over, a lower one is ignored.
+	send(sacnPacket(2, 1, 150, 1, 0, []byte{255, 0, 0, 255}))
+	color.waitFor(t, "rgb 0 0 255")
+
+	send(sacnPacket(3, 1, 50, 1, 0, []byte{255, 0, 255, 0}))
+
+	// An old packet of the first console is discarded.
+	send(sacnPacket(1, 1, 100, 0, 0, []byte{255, 255, 255, 255}))
+
+	// When the backup terminates its stream the first console is back.
+	send(sacnPacket(2, 1, 150, 2, 0x40, nil))
+	color.waitFor(t, "rgb 255 0 0")
+
+	color.mu.Lock()
+	for _, c := range color.calls {
+		if c == "rgb 0 255 0" || c == "rgb 255 255 255" {
+			t.Errorf("unexpected %q from an ignored source", c)
+		}
+	}
+	color.mu.Unlock()
+
+	// Art-Net arrives on the same connection, a dimmer at 0 switches off.
+	send(artNetPacket(2, 1, []byte{64}))
+	spot.waitFor(t, "bright 25")
+
+	send(artNetPacket(2, 2, []byte{0}))
+	spot.waitFor(t, "power false")
+
+	// After the source timeout the universe falls back to the console still sending.
+	time.Sleep(400 * time.Millisecond)
+	send(sacnPacket(3, 1, 50, 2, 0, []byte{255, 0, 255, 0}))
+	color.waitFor(t, "rgb 0 255 0")
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected the receiver to stop with the context, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"testing"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/flow"
+)
+
+func solidFrame(c color.Color) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, 4, 4), palette.Plan9)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, c)
+		}
+	}
+
+	return img
+}
+
+func TestFlowFromGIF(t *testing.T) {
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{
+		Image: []*image.Paletted{
+			solidFrame(color.RGBA{255, 0, 0, 255}),
+			solidFrame(color.RGBA{255, 0, 0, 255}),
+			solidFrame(color.RGBA{0, 0, 255, 255}),
+			solidFrame(color.RGBA{0, 0, 136, 255}),
+		},
+		Delay: []int{10, 10, 20, 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exprs, err := flow.Converter{}.GIF(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []yeelight.FlowExpression{
+		{Duration: 200, Mode: 1, Value: 0xff0000, Brightness: 100},
+		{Duration: 200, Mode: 1, Value: 0x0000ff, Brightness: 100},
+		{Duration: 30, Mode: 1, Value: 0x0000ff, Brightness: 53},
+	}
+
+	if len(exprs) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, exprs)
+	}
+
+	for i := range expected {
+		if exprs[i] != expected[i] {
+			t.Errorf("expression %d: expected %v, got %v", i, expected[i], exprs[i])
+		}
+	}
+}
+
+func TestFlowMaxLength(t *testing.T) {
+	exprs := flow.Converter{MaxLength: 2}.Palette([]color.Color{
+		color.RGBA{255, 0, 0, 255},
+		color.RGBA{0, 255, 0, 255},
+		color.RGBA{0, 235, 20, 255},
+	}, 500)
+
+	if len(exprs) != 2 {
+		t.Fatalf("expected 2 expressions, got %v", exprs)
+	}
+
+	if exprs[0].Value != 0xff0000 || exprs[1].Duration != 1000 {
+		t.Errorf("expected the two greens to be merged, got %v", exprs)
+	}
+}
@@ -0,0 +1,59 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+func TestSyncFlowChase(t *testing.T) {
+	lampA, a := fakeLamp(t, yeelighttest.Options{})
+	lampB, b := fakeLamp(t, yeelighttest.Options{})
+
+	s := &yeelight.SyncFlow{
+		Members: []*yeelight.Config{&a, &b},
+		Phase:   yeelight.Chase(500 * time.Millisecond),
+	}
+
+	_, err := s.Start(0, 0, []yeelight.FlowExpression{
+		{Duration: 1000, Mode: 1, Value: 0xff0000, Brightness: 100},
+		{Duration: 1000, Mode: 1, Value: 0x0000ff, Brightness: 50},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p := lampA.Get("flow_params"); p != "0,0,1000,1,16711680,100,1000,1,255,50" {
+		t.Errorf("first member should run the flow as is, got %v", p)
+	}
+
+	// Half way into red: finish red, blue, then the purple half way point.
+	if p := lampB.Get("flow_params"); p != "0,0,500,1,16711680,100,1000,1,255,50,500,1,8388736,75" {
+		t.Errorf("second member should run the rotated flow, got %v", p)
+	}
+}
+
+func TestSyncFlowCalibrationFailure(t *testing.T) {
+	lamp, online := fakeLamp(t, yeelighttest.Options{})
+
+	// The offline member can't be measured.
+	offline := offlineLamp()
+
+	s := &yeelight.SyncFlow{Members: []*yeelight.Config{&offline, &online}}
+
+	results, err := s.Start(1, 0, []yeelight.FlowExpression{{Duration: 1000, Mode: 2, Value: 2700, Brightness: 100}})
+	if err == nil || !strings.Contains(err.Error(), "without latency compensation") {
+		t.Errorf("expected the calibration error to be reported, got %v", err)
+	}
+
+	if results[0].Err == nil || results[1].Err != nil {
+		t.Errorf("expected only the offline member to fail, got %+v", results)
+	}
+
+	if p := lamp.Get("flow_params"); p != "1,0,1000,2,2700,100" {
+		t.Errorf("expected the flow to start on the member that answers, got %q", p)
+	}
+}
@@ -0,0 +1,41 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+func TestGroupUnreachable(t *testing.T) {
+	lamp, y := fakeLamp(t, yeelighttest.Options{State: map[string]string{"power": "off"}})
+	unreachable := unreachableLamp(t)
+
+	g := &yeelight.Group{
+		Members: []*yeelight.Config{&y, &unreachable},
+		Timeout: 300 * time.Millisecond,
+	}
+
+	// The dial to the unreachable member ends with the timeout of the group, not its own of 5 seconds.
+	start := time.Now()
+	results, err := g.SetPower(true, "smooth", 500)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("group took %v, the unreachable member should only cost its timeout", elapsed)
+	}
+
+	var me *yeelight.MemberError
+	if !errors.As(err, &me) || me.Member != &unreachable || !strings.Contains(me.Error(), "no answer within") {
+		t.Fatalf("expected the timeout of the unreachable member, got %v", err)
+	}
+
+	if results[0].Err != nil || lamp.Get("power") != "on" {
+		t.Errorf("expected the other member to succeed, got %+v", results[0])
+	}
+
+	if n := unreachable.Stats().Methods["set_power"].Errors["timeout"]; n != 1 {
+		t.Errorf("expected the call to count as a timeout, got %v", unreachable.Stats().Methods["set_power"].Errors)
+	}
+}
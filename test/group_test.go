@@ -0,0 +1,90 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+func TestGroup(t *testing.T) {
+	off := map[string]string{"power": "off"}
+	lampA, a := fakeLamp(t, yeelighttest.Options{Name: "a", State: off})
+	lampB, b := fakeLamp(t, yeelighttest.Options{Name: "b", State: off})
+	_, silent := fakeLamp(t, yeelighttest.Options{Silent: true})
+
+	g := &yeelight.Group{
+		Members: []*yeelight.Config{&a, &silent, &b},
+		Timeout: 200 * time.Millisecond,
+	}
+
+	// A caller outside the group waits on the silent member with its own, longer timeout.
+	other := make(chan time.Duration, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 600*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		silent.WithContext(ctx).GetProps("power")
+		other <- time.Since(start)
+	}()
+
+	start := time.Now()
+	results, err := g.SetPower(true, "smooth", 500)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("group took %v, the silent member should only cost its timeout", elapsed)
+	}
+
+	var me *yeelight.MemberError
+	if !errors.As(err, &me) || me.Member != &silent {
+		t.Fatalf("expected an error for the silent member, got %v", err)
+	}
+
+	if results[0].Err != nil || results[2].Err != nil || lampA.Get("power") != "on" || lampB.Get("power") != "on" {
+		t.Errorf("expected the other members to succeed, got %+v", results)
+	}
+
+	if waited := <-other; waited < 500*time.Millisecond {
+		t.Errorf("the timeout of the group aborted another caller after %v", waited)
+	}
+
+	// The members keep working after the group call.
+	r, err := a.GetProps("name")
+	if err != nil || r.Result[0] != "a" {
+		t.Errorf("member broken after group call: %v %v", r, err)
+	}
+}
+
+func TestGroupFailFast(t *testing.T) {
+	offline := offlineLamp()
+	_, silent := fakeLamp(t, yeelighttest.Options{Silent: true})
+
+	g := &yeelight.Group{
+		Members:  []*yeelight.Config{&silent, &offline},
+		FailFast: true,
+	}
+
+	done := make(chan struct{})
+	var results []yeelight.Result
+	go func() {
+		results, _ = g.SetBright(50, "smooth", 500)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the silent member without timeout should be aborted")
+	}
+
+	if !errors.Is(results[0].Err, yeelight.ErrAborted) || results[1].Err == nil {
+		t.Errorf("unexpected results %+v", results)
+	}
+
+	if n := silent.Stats().Methods["set_bright"].Errors["canceled"]; n != 1 {
+		t.Errorf("expected the aborted call to count as canceled, got %v", silent.Stats().Methods["set_bright"].Errors)
+	}
+}
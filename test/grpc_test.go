@@ -0,0 +1,142 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/grpc"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+func TestGRPCService(t *testing.T) {
+	lamp := newLamp(t, yeelighttest.Options{State: map[string]string{"power": "off", "bright": "40"}})
+	addr := lamp.Addr()
+
+	registry, err := yeelight.NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registry.Close()
+
+	registry.Update(yeelight.Device{ID: "0x1", Name: "Desk", Support: []string{"set_power"}, IpAddress: addr.IP.String(), Port: addr.Port})
+
+	ts := httptest.NewUnstartedServer(&grpc.Server{Registry: registry})
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	defer ts.Close()
+
+	client := grpc.NewClient(ts.Listener.Addr().String())
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var devices grpc.ListDevicesResponse
+	if err := client.Invoke(ctx, "ListDevices", &grpc.ListDevicesRequest{}, &devices); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(devices.Devices) != 1 || devices.Devices[0].ID != "0x1" || devices.Devices[0].Support[0] != "set_power" {
+		t.Fatalf("unexpected devices %+v", devices.Devices)
+	}
+
+	var state grpc.State
+	if err := client.Invoke(ctx, "GetState", &grpc.DeviceRequest{Device: "desk"}, &state); err != nil {
+		t.Fatal(err)
+	}
+
+	if state.Device.Name != "Desk" || state.Properties.Get("bright") != "40" || state.Properties.Updated.IsZero() {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	var res grpc.CommandResponse
+	if err := client.Invoke(ctx, "SetPower", &grpc.SetPowerRequest{Device: "0x1", On: true}, &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Result) != 1 || res.Result[0] != "ok" {
+		t.Errorf("unexpected result %v", res.Result)
+	}
+
+	for _, c := range []struct {
+		method string
+		req    grpc.Message
+		code   grpc.Code
+	}{
+		{"SetColorTemp", &grpc.SetColorTempRequest{Device: "0x1", ColorTemperature: 2700, Effect: "fade"}, grpc.InvalidArgument},
+		{"SetScene", &grpc.SetSceneRequest{Device: "0x1", Scene: yeelight.Scene{Action: "ct", ColorTemperature: 9000, Brightness: 50}}, grpc.InvalidArgument},
+		{"SetPower", &grpc.SetPowerRequest{Device: "0x2", On: true}, grpc.NotFound},
+		{"Reboot", &grpc.DeviceRequest{Device: "0x1"}, grpc.Unimplemented},
+	} {
+		err := client.Invoke(ctx, c.method, c.req, &res)
+
+		var status *grpc.Status
+		if !errors.As(err, &status) || status.Code != c.code {
+			t.Errorf("%s: expected code %d, got %v", c.method, c.code, err)
+		}
+	}
+
+	stream, err := client.Watch(ctx, &grpc.WatchRequest{Devices: []string{"desk"}, Properties: []string{"power"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	// The subscription starts in the background, the lamp is switched on and off until a switch off comes in.
+	received, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		for {
+			select {
+			case <-received:
+				return
+			default:
+			}
+
+			lamp.Set(map[string]string{"power": "on"})
+			lamp.Set(map[string]string{"power": "off", "bright": "10"})
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	e, err := stream.Recv()
+	for err == nil && e.New != "off" {
+		e, err = stream.Recv()
+	}
+	close(received)
+	<-stopped
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Device != "0x1" || e.Property != "power" || e.Old != "on" || e.New != "off" || e.Time.IsZero() {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	if _, err := client.Watch(ctx, &grpc.WatchRequest{Devices: []string{"kitchen"}}); err == nil {
+		t.Errorf("expected watching an unknown device to fail")
+	}
+
+	// A lamp that never answers costs the deadline of the call.
+	silent := newLamp(t, yeelighttest.Options{Silent: true}).Addr()
+	registry.Update(yeelight.Device{ID: "0x3", IpAddress: silent.IP.String(), Port: silent.Port})
+
+	short, stop := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer stop()
+
+	start := time.Now()
+	err = client.Invoke(short, "SetPower", &grpc.SetPowerRequest{Device: "0x3", On: true}, &res)
+
+	var status *grpc.Status
+	if !errors.As(err, &status) || status.Code != grpc.DeadlineExceeded || time.Since(start) > time.Second {
+		t.Errorf("expected the deadline to be exceeded, got %v after %v", err, time.Since(start))
+	}
+}
@@ -0,0 +1,169 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/hue"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+func TestHueBridge(t *testing.T) {
+	addr := newLamp(t, yeelighttest.Options{State: map[string]string{"power": "off", "bright": "40"}}).Addr()
+
+	registry, err := yeelight.NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registry.Close()
+
+	registry.Update(yeelight.Device{ID: "0x000000000015243f", Name: "Desk", Model: "color", IpAddress: addr.IP.String(), Port: addr.Port})
+
+	ts := httptest.NewServer(&hue.Bridge{Registry: registry, Groups: map[string][]string{"living": {"0x000000000015243f"}}})
+	defer ts.Close()
+
+	do := func(method, path, body string, v interface{}) {
+		t.Helper()
+
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+
+	var created []map[string]map[string]string
+	do("POST", "/api", `{"devicetype": "test#app"}`, &created)
+
+	user := created[0]["success"]["username"]
+	if user == "" {
+		t.Fatalf("expected a user name, got %v", created)
+	}
+
+	var lights map[string]struct {
+		Name     string                 `json:"name"`
+		Type     string                 `json:"type"`
+		UniqueID string                 `json:"uniqueid"`
+		State    map[string]interface{} `json:"state"`
+	}
+	do("GET", "/api/"+user+"/lights", "", &lights)
+
+	desk := lights["1"]
+	if desk.Name != "Desk" || desk.Type != "Extended color light" || desk.UniqueID != "00:00:00:00:00:15:24:3f-0b" {
+		t.Fatalf("unexpected lights %+v", lights)
+	}
+
+	if desk.State["on"] != false || desk.State["bri"] != float64(102) || desk.State["ct"] != float64(250) || desk.State["colormode"] != "ct" {
+		t.Errorf("unexpected state %v", desk.State)
+	}
+
+	var answers []map[string]map[string]interface{}
+	do("PUT", "/api/"+user+"/lights/1/state", `{"on": true, "bri": 254, "ct": 370, "transitiontime": 0}`, &answers)
+
+	if len(answers) != 4 || answers[0]["success"]["/lights/1/state/on"] != true || answers[2]["success"]["/lights/1/state/ct"] != float64(370) {
+		t.Errorf("unexpected answers %v", answers)
+	}
+
+	var light struct {
+		State map[string]interface{} `json:"state"`
+	}
+	do("GET", "/api/"+user+"/lights/1", "", &light)
+
+	if light.State["on"] != true || light.State["bri"] != float64(254) || light.State["ct"] != float64(370) {
+		t.Errorf("expected the new state, got %v", light.State)
+	}
+
+	// Pure red, its xy point comes back from the lamp's rgb value.
+	do("PUT", "/api/"+user+"/lights/1/state", `{"xy": [0.7006, 0.2993]}`, &answers)
+	do("GET", "/api/"+user+"/lights/1", "", &light)
+
+	if xy, _ := light.State["xy"].([]interface{}); light.State["colormode"] != "xy" || len(xy) != 2 || xy[0].(float64) < 0.69 {
+		t.Errorf("expected a red xy color, got %v", light.State)
+	}
+
+	do("PUT", "/api/"+user+"/lights/1/state", `{"bri": 300}`, &answers)
+	if answers[0]["error"]["type"] != float64(7) {
+		t.Errorf("expected an invalid value, got %v", answers)
+	}
+
+	do("PUT", "/api/"+user+"/lights/9/state", `{"on": true}`, &answers)
+	if answers[0]["error"]["type"] != float64(3) {
+		t.Errorf("expected an unknown light, got %v", answers)
+	}
+
+	var groups map[string]struct {
+		Name   string          `json:"name"`
+		Lights []string        `json:"lights"`
+		State  map[string]bool `json:"state"`
+	}
+	do("GET", "/api/"+user+"/groups", "", &groups)
+
+	if g := groups["1"]; g.Name != "living" || len(g.Lights) != 1 || !g.State["all_on"] {
+		t.Errorf("unexpected groups %+v", groups)
+	}
+
+	do("PUT", "/api/"+user+"/groups/1/action", `{"on": false}`, &answers)
+	do("GET", "/api/"+user+"/lights/1", "", &light)
+
+	if answers[0]["success"]["/groups/1/action/on"] != false || light.State["on"] != false {
+		t.Errorf("expected the group switched off, got %v and %v", answers, light.State)
+	}
+}
+
+func TestHueLightNumbers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+
+	registry, err := yeelight.NewRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registry.Close()
+
+	numbers := func(b *hue.Bridge) map[string]string {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		b.ServeHTTP(rec, httptest.NewRequest("GET", "/api/user/lights", nil))
+
+		var lights map[string]struct {
+			UniqueID string `json:"uniqueid"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &lights); err != nil {
+			t.Fatal(err)
+		}
+
+		byID := map[string]string{}
+		for n, l := range lights {
+			byID[l.UniqueID] = n
+		}
+
+		return byID
+	}
+
+	registry.Update(yeelight.Device{ID: "0x2", Model: "color", IpAddress: "127.0.0.1", Port: 1})
+	numbers(&hue.Bridge{Registry: registry})
+
+	registry.Update(yeelight.Device{ID: "0x1", Model: "color", IpAddress: "127.0.0.1", Port: 2})
+
+	// After a restart the lamp seen first keeps number 1, the new lamp does not take its place.
+	got := numbers(&hue.Bridge{Registry: registry})
+	if got["00:00:00:00:00:00:00:02-0b"] != "1" || got["00:00:00:00:00:00:00:01-0b"] != "2" {
+		t.Errorf("expected the saved numbers, got %v", got)
+	}
+
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "devices.hue.json")); err != nil {
+		t.Errorf("expected the numbers next to the registry: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package test
+
+import (
+	"bufio"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/metrics"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+func TestMetrics(t *testing.T) {
+	lamp := newLamp(t, yeelighttest.Options{State: map[string]string{"bright": "40"}})
+	addr := lamp.Addr()
+
+	registry, err := yeelight.NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registry.Close()
+
+	registry.Update(yeelight.Device{ID: "0x1", Name: "Desk", Model: "mono", IpAddress: addr.IP.String(), Port: addr.Port})
+
+	y, err := registry.Get("0x1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := y.Properties(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := y.SetBright(50, "smooth", 300); err != nil {
+		t.Fatal(err)
+	}
+
+	// A proxy rejecting the second command of its budget counts as a quota rejection of the lamp.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go (&yeelight.Proxy{Config: y, Rate: 1}).Serve(listener)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := &proxyClient{conn: conn, scanner: bufio.NewScanner(conn)}
+	client.request(t, 1)
+	client.request(t, 2)
+
+	lamp.Set(map[string]string{"ct": "3500"})
+
+	e := &metrics.Exporter{Registry: registry}
+
+	var body string
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		body = rec.Body.String()
+
+		if strings.Contains(body, `yeelight_color_temperature_kelvin{device="0x1"} 3500`) || time.Now().After(deadline) {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The lamp notified the set_bright and the change of ct.
+	for _, line := range []string{
+		"# TYPE yeelight_command_duration_seconds histogram",
+		`yeelight_device_info{device="0x1",name="Desk",model="mono",firmware="0"} 1`,
+		`yeelight_up{device="0x1"} 1`,
+		`yeelight_power{device="0x1"} 1`,
+		`yeelight_brightness_percent{device="0x1"} 50`,
+		`yeelight_color_temperature_kelvin{device="0x1"} 3500`,
+		`yeelight_commands_total{device="0x1",method="set_bright"} 1`,
+		`yeelight_command_duration_seconds_bucket{device="0x1",method="set_bright",le="+Inf"} 1`,
+		`yeelight_command_duration_seconds_count{device="0x1",method="get_prop"} 2`,
+		`yeelight_quota_rejections_total{device="0x1"} 1`,
+		`yeelight_reconnects_total{device="0x1"} 0`,
+		`yeelight_notifications_total{device="0x1"} 2`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected %q in\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/mqtt"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+// broker is an MQTT broker good enough for tests: QoS 0, retained messages, wildcards and wills.
+type broker struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	clients  map[*brokerClient]bool
+	retained map[string][]byte
+}
+
+type brokerClient struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	filters []string
+	done    chan struct{}
+}
+
+func startBroker(t *testing.T) *broker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &broker{listener: listener, clients: map[*brokerClient]bool{}, retained: map[string][]byte{}}
+	t.Cleanup(func() {
+		listener.Close()
+		b.kick()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go b.serve(&brokerClient{conn: conn, done: make(chan struct{})})
+		}
+	}()
+
+	return b
+}
+
+// kick drops every client like a broker restart and waits until their wills are published.
+func (b *broker) kick() {
+	b.mu.Lock()
+	var clients []*brokerClient
+	for c := range b.clients {
+		clients = append(clients, c)
+		c.conn.Close()
+	}
+	b.mu.Unlock()
+
+	for _, c := range clients {
+		<-c.done
+	}
+}
+
+func (c *brokerClient) write(kind byte, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	packet := []byte{kind}
+	for n := len(body); ; n /= 128 {
+		if n < 128 {
+			packet = append(packet, byte(n))
+			break
+		}
+
+		packet = append(packet, byte(n%128)|0x80)
+	}
+
+	c.conn.Write(append(packet, body...))
+}
+
+func (b *broker) serve(c *brokerClient) {
+	defer close(c.done)
+	defer c.conn.Close()
+
+	r := bufio.NewReader(c.conn)
+
+	// CONNECT: protocol name, level, flags, keep alive, client ID, then the optional will.
+	_, body, err := readTestPacket(r)
+	if err != nil {
+		return
+	}
+
+	flags := body[7]
+	rest := body[10:]
+	_, rest = readTestString(rest)
+
+	var will *mqtt.Message
+	if flags&0x04 != 0 {
+		topic, rest2 := readTestString(rest)
+		payload, _ := readTestString(rest2)
+		will = &mqtt.Message{Topic: topic, Payload: []byte(payload), Retain: flags&0x20 != 0}
+	}
+
+	b.mu.Lock()
+	b.clients[c] = true
+	b.mu.Unlock()
+
+	c.write(0x20, []byte{0, 0})
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, c)
+		b.mu.Unlock()
+
+		if will != nil {
+			b.publish(*will)
+		}
+	}()
+
+	for {
+		kind, body, err := readTestPacket(r)
+		if err != nil {
+			return
+		}
+
+		switch kind & 0xF0 {
+		case 0x30:
+			topic, payload := readTestString(body)
+			b.publish(mqtt.Message{Topic: topic, Payload: payload, Retain: kind&0x01 != 0})
+		case 0x80:
+			id, rest := body[:2], body[2:]
+
+			var filters []string
+			for len(rest) > 0 {
+				var f string
+				f, rest = readTestString(rest)
+				filters = append(filters, f)
+				rest = rest[1:]
+			}
+
+			b.mu.Lock()
+			c.filters = append(c.filters, filters...)
+			var retained []mqtt.Message
+			for topic, payload := range b.retained {
+				if c.matches(topic) {
+					retained = append(retained, mqtt.Message{Topic: topic, Payload: payload})
+				}
+			}
+			b.mu.Unlock()
+
+			c.write(0x90, append(id, make([]byte, len(filters))...))
+			for _, m := range retained {
+				c.write(0x31, append(appendTestString(m.Topic), m.Payload...))
+			}
+		case 0xC0:
+			c.write(0xD0, nil)
+		case 0xE0:
+			will = nil
+			return
+		}
+	}
+}
+
+func (b *broker) publish(m mqtt.Message) {
+	b.mu.Lock()
+	if m.Retain {
+		if len(m.Payload) == 0 {
+			delete(b.retained, m.Topic)
+		} else {
+			b.retained[m.Topic] = m.Payload
+		}
+	}
+
+	var to []*brokerClient
+	for c := range b.clients {
+		if c.matches(m.Topic) {
+			to = append(to, c)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, c := range to {
+		c.write(0x30, append(appendTestString(m.Topic), m.Payload...))
+	}
+}
+
+func (c *brokerClient) matches(topic string) bool {
+	for _, f := range c.filters {
+		filter, levels := strings.Split(f, "/"), strings.Split(topic, "/")
+
+		for i, level := range filter {
+			if level == "#" {
+				return true
+			}
+
+			if i >= len(levels) || (level != "+" && level != levels[i]) {
+				break
+			}
+
+			if i == len(filter)-1 && i == len(levels)-1 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func readTestPacket(r *bufio.Reader) (byte, []byte, error) {
+	kind, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, shift := 0, 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		length |= int(b&0x7F) << shift
+		shift += 7
+
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+
+	return kind, body, err
+}
+
+func readTestString(b []byte) (string, []byte) {
+	n := int(binary.BigEndian.Uint16(b))
+	return string(b[2 : 2+n]), b[2+n:]
+}
+
+func appendTestString(s string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(s))), s...)
+}
+
+// observe subscribes to everything and returns a function waiting until a topic has a value.
+func observe(t *testing.T, addr string) (func(topic, want string) string, *mqtt.Client) {
+	var mu sync.Mutex
+	topics := map[string]string{}
+
+	client, err := mqtt.Connect(context.Background(), mqtt.Options{
+		Broker:   addr,
+		ClientID: "observer",
+		OnMessage: func(m mqtt.Message) {
+			mu.Lock()
+			topics[m.Topic] = string(m.Payload)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	if err := client.Subscribe("#"); err != nil {
+		t.Fatal(err)
+	}
+
+	wait := func(topic, want string) string {
+		t.Helper()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mu.Lock()
+			got, ok := topics[topic]
+			mu.Unlock()
+
+			if ok && (want == "" || got == want) {
+				return got
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %s to be %q, got %q", topic, want, got)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	return wait, client
+}
+
+func TestMQTTBridge(t *testing.T) {
+	lamp := newLamp(t, yeelighttest.Options{Name: "Desk", State: map[string]string{"power": "off", "bright": "40"}})
+	addr := lamp.Addr()
+
+	registry, err := yeelight.NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registry.Close()
+
+	registry.Update(yeelight.Device{
+		ID: "0x1", Name: "Desk", IpAddress: addr.IP.String(), Port: addr.Port, Model: "mono",
+		Support: []string{"get_prop", "set_power", "set_bright", "set_ct_abx", "set_scene", "stop_cf"},
+	})
+
+	b := startBroker(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bridge := &mqtt.Bridge{
+		Registry: registry,
+		Options:  mqtt.Options{Broker: b.listener.Addr().String()},
+		Effects:  map[string]yeelight.Scene{"movie": {Action: "ct", ColorTemperature: 2700, Brightness: 20}},
+	}
+
+	go bridge.Run(ctx)
+
+	wait, observer := observe(t, b.listener.Addr().String())
+
+	wait("yeelight/bridge/availability", "online")
+	wait("yeelight/0x1/availability", "online")
+	wait("yeelight/0x1/power", "off")
+
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(wait("homeassistant/light/0x1/config", "")), &config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config["unique_id"] != "yeelight_0x1" || config["command_topic"] != "yeelight/0x1/power/set" ||
+		config["color_temp_state_topic"] != "yeelight/0x1/ct" || config["rgb_command_topic"] != nil {
+		t.Errorf("unexpected discovery config %v", config)
+	}
+
+	observer.Publish("yeelight/0x1/power/set", []byte("ON"), false)
+	wait("yeelight/0x1/power", "on")
+
+	lamp.Set(map[string]string{"bright": "80"})
+	wait("yeelight/0x1/bright", "80")
+
+	observer.Publish("yeelight/0x1/effect/set", []byte("movie"), false)
+	wait("yeelight/0x1/effect", "movie")
+	wait("yeelight/0x1/ct", "2700")
+
+	// A retained command is done once when it is sent, not again when the broker replays it.
+	observer.Publish("yeelight/0x1/power/set", []byte("OFF"), true)
+	wait("yeelight/0x1/power", "off")
+
+	lamp.Set(map[string]string{"power": "on"})
+	wait("yeelight/0x1/power", "on")
+
+	// After a broker restart the will tells the bridge is gone, until it reconnects.
+	b.kick()
+
+	wait, observer = observe(t, b.listener.Addr().String())
+	wait("yeelight/bridge/availability", "offline")
+	wait("yeelight/bridge/availability", "online")
+
+	// A lamp that never answers does not hold up the commands of the others.
+	silent := newLamp(t, yeelighttest.Options{Silent: true}).Addr()
+	registry.Update(yeelight.Device{ID: "0x2", IpAddress: silent.IP.String(), Port: silent.Port})
+
+	observer.Publish("yeelight/0x2/power/set", []byte("ON"), false)
+	observer.Publish("yeelight/0x1/bright/set", []byte("30"), false)
+	wait("yeelight/0x1/bright", "30")
+
+	if power := lamp.Get("power"); power != "on" {
+		t.Errorf("expected the retained command to be ignored after the restart, the lamp is %s", power)
+	}
+}
+
+func TestMQTTPasswordWithoutUser(t *testing.T) {
+	b := startBroker(t)
+
+	_, err := mqtt.Connect(context.Background(), mqtt.Options{Broker: b.listener.Addr().String(), Password: "s3cret"})
+	if err == nil {
+		t.Error("expected a password without a user name to be refused")
+	}
+}
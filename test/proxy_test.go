@@ -0,0 +1,173 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+type proxyClient struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+}
+
+// request sends a request and reads until its answer, the notifications read on the way are returned too.
+func (c *proxyClient) request(t *testing.T, id int) (answer map[string]interface{}, notifications int) {
+	fmt.Fprintf(c.conn, "{\"id\":%d,\"method\":\"get_prop\",\"params\":[\"power\"]}\r\n", id)
+
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for c.scanner.Scan() {
+		var msg map[string]interface{}
+		json.Unmarshal(c.scanner.Bytes(), &msg)
+
+		if msg["method"] == "props" {
+			notifications++
+			continue
+		}
+
+		return msg, notifications
+	}
+
+	t.Fatalf("no answer to request %d: %v", id, c.scanner.Err())
+
+	return nil, 0
+}
+
+func TestProxy(t *testing.T) {
+	lamp, y := fakeLamp(t, yeelighttest.Options{})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	p := &yeelight.Proxy{Config: &y, Rate: 3}
+	go p.Serve(listener)
+
+	clients := make([]*proxyClient, 2)
+	for i := range clients {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		clients[i] = &proxyClient{conn, bufio.NewScanner(conn)}
+	}
+
+	// Both clients use the same ID, each gets its own answer back.
+	for _, c := range clients {
+		answer, _ := c.request(t, 1)
+		if answer["id"] != 1.0 || answer["error"] != nil {
+			t.Fatalf("expected an answer to id 1, got %v", answer)
+		}
+	}
+
+	// The third command of the budget.
+	answer, _ := clients[0].request(t, 2)
+	if answer["id"] != 2.0 || answer["error"] != nil {
+		t.Fatalf("expected an answer to id 2, got %v", answer)
+	}
+
+	// Every client is told about a change of the lamp.
+	lamp.Set(map[string]string{"bright": "50"})
+
+	for i, c := range clients {
+		c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if !c.scanner.Scan() || !strings.Contains(c.scanner.Text(), `"method":"props"`) {
+			t.Errorf("client %d: expected the notification, got %q %v", i, c.scanner.Text(), c.scanner.Err())
+		}
+	}
+
+	answer, _ = clients[0].request(t, 4)
+	if e, _ := answer["error"].(map[string]interface{}); e["message"] != "client quota exceeded" {
+		t.Errorf("expected the shared budget to be spent, got %v", answer)
+	}
+
+	if n := lamp.Connections(); n != 1 {
+		t.Errorf("expected one connection to the lamp, it has %d", n)
+	}
+}
+
+func TestProxyInFlight(t *testing.T) {
+	// A lamp that only answers when the test says so.
+	lampListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lampListener.Close()
+
+	y := yeelight.New(&yeelight.Config{IpAddress: "127.0.0.1", Port: lampListener.Addr().(*net.TCPAddr).Port})
+	defer y.Close()
+
+	lamp, err := lampListener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lamp.Close()
+
+	received := make(chan int, 10)
+	go func() {
+		scanner := bufio.NewScanner(lamp)
+		for scanner.Scan() {
+			var req struct{ ID int }
+			json.Unmarshal(scanner.Bytes(), &req)
+			received <- req.ID
+		}
+	}()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	p := &yeelight.Proxy{Config: &y, Rate: 2}
+	go p.Serve(listener)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for id := 1; id <= 3; id++ {
+		fmt.Fprintf(conn, "{\"id\":%d,\"method\":\"get_prop\",\"params\":[\"power\"]}\r\n", id)
+	}
+
+	var ids []int
+	for len(ids) < 2 {
+		select {
+		case id := <-received:
+			ids = append(ids, id)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected two requests at the lamp, got %d", len(ids))
+		}
+	}
+
+	// No more than the rate is forwarded at once, the third request is not even read: without the limit it would
+	// be answered right away as over the budget.
+	scanner := bufio.NewScanner(conn)
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if scanner.Scan() {
+		t.Fatalf("expected no answer while the lamp is busy, got %s", scanner.Text())
+	}
+
+	fmt.Fprintf(lamp, "{\"id\":%d,\"result\":[\"on\"]}\r\n", ids[0])
+
+	scanner = bufio.NewScanner(conn)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for _, expected := range []string{`"result":["on"]`, "client quota exceeded"} {
+		if !scanner.Scan() || !strings.Contains(scanner.Text(), expected) {
+			t.Fatalf("expected an answer with %s, got %q %v", expected, scanner.Text(), scanner.Err())
+		}
+	}
+}
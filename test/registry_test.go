@@ -0,0 +1,100 @@
+package test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+func TestParseAdvertisement(t *testing.T) {
+	d, err := yeelight.ParseAdvertisement([]byte("NOTIFY * HTTP/1.1\r\n" +
+		"Host: 239.255.255.250:1982\r\n" +
+		"Location: yeelight://192.168.1.239:55443\r\n" +
+		"id: 0x000000000015243f\r\n" +
+		"model: color\r\n" +
+		"support: get_prop set_default set_power toggle\r\n" +
+		"power: on\r\n" +
+		"bright: 100\r\n" +
+		"name: Bed Bulb\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.ID != "0x000000000015243f" || d.IpAddress != "192.168.1.239" || d.Port != 55443 || d.Brightness != 100 {
+		t.Errorf("unexpected device %+v", d)
+	}
+
+	if !d.Supports("toggle") || d.Supports("set_music") {
+		t.Errorf("unexpected support %v", d.Support)
+	}
+}
+
+func TestRegistryFollowsAddress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	first := newLamp(t, yeelighttest.Options{Name: "first"}).Addr()
+	second := newLamp(t, yeelighttest.Options{Name: "second"}).Addr()
+
+	r, err := yeelight.NewRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Update(yeelight.Device{ID: "0x1", IpAddress: first.IP.String(), Port: first.Port})
+
+	y, err := r.Get("0x1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := y.GetProps("name")
+	if err != nil || resp.Result[0] != "first" {
+		t.Fatalf("expected the first address to answer, got %v %v", resp, err)
+	}
+
+	y.BrightnessScale = yeelight.Gamma(2.2)
+
+	// The device comes back with a new lease.
+	r.Update(yeelight.Device{ID: "0x1", IpAddress: second.IP.String(), Port: second.Port})
+
+	resp, err = y.GetProps("name")
+	if err != nil || resp.Result[0] != "second" {
+		t.Fatalf("expected the new address to answer, got %v %v", resp, err)
+	}
+
+	// The Config handed out before is left as it is, a new one has the new address.
+	if y.Port != first.Port {
+		t.Errorf("expected the old config to keep port %d, got %d", first.Port, y.Port)
+	}
+
+	if moved, _ := r.Get("0x1"); moved == y || moved.Port != second.Port || moved.BrightnessScale != yeelight.Gamma(2.2) {
+		t.Errorf("expected a new config with port %d and the settings of the old one, got %+v", second.Port, moved)
+	}
+
+	// A firmware update adds a method, it is saved like a new address.
+	r.Update(yeelight.Device{ID: "0x1", IpAddress: second.IP.String(), Port: second.Port, Support: []string{"set_scene"}})
+
+	r.Close()
+
+	// A new registry knows the device before any discovery.
+	r, err = yeelight.NewRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	y, err = r.Get("0x1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = y.GetProps("name")
+	if err != nil || resp.Result[0] != "second" {
+		t.Fatalf("expected the saved address to answer, got %v %v", resp, err)
+	}
+
+	if d, _ := r.Device("0x1"); !d.Supports("set_scene") {
+		t.Errorf("expected the saved methods, got %v", d.Support)
+	}
+}
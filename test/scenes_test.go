@@ -0,0 +1,89 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+func TestSceneLibrary(t *testing.T) {
+	state := map[string]string{"color_mode": "2", "ct": "2700", "bright": "20"}
+	lampA, lampB := newLamp(t, yeelighttest.Options{State: state}), newLamp(t, yeelighttest.Options{State: state})
+	addrA, addrB := lampA.Addr(), lampB.Addr()
+
+	r, _ := yeelight.NewRegistry("")
+	defer r.Close()
+
+	r.Update(yeelight.Device{ID: "0xa", IpAddress: addrA.IP.String(), Port: addrA.Port, Support: []string{"set_scene", "set_ct_abx", "set_rgb"}})
+	r.Update(yeelight.Device{ID: "0xb", IpAddress: addrB.IP.String(), Port: addrB.Port, Support: []string{"set_scene", "set_ct_abx"}})
+
+	path := filepath.Join(t.TempDir(), "scenes.json")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := yeelight.LoadScenes(path, nil); err == nil {
+		t.Error("expected a library without registry to be refused")
+	}
+
+	// 0xb is a white only lamp.
+	write(`{"groups": {"living": ["0xa", "0xb"]}, "scenes": [
+		{"name": "party", "target": "living", "scene": {"action": "color", "color": 16711680, "bright": 100}}
+	]}`)
+
+	if _, err := yeelight.LoadScenes(path, r); err == nil || !strings.Contains(err.Error(), "0xb") {
+		t.Fatalf("expected the white lamp to be rejected, got %v", err)
+	}
+
+	write(`{"groups": {"living": ["0xa", "0xb"]}, "scenes": [
+		{"name": "movie", "target": "living", "scene": {"action": "ct", "ct": 2700, "bright": 20}}
+	]}`)
+
+	lib, err := yeelight.LoadScenes(path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lib.Apply("movie"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, lamp := range []*yeelighttest.Device{lampA, lampB} {
+		if scenes := requests(lamp, "set_scene"); len(scenes) != 1 || scenes[0] != `["ct",2700,20]` {
+			t.Errorf("unexpected scenes %v", scenes)
+		}
+	}
+
+	// A lamp with a perceptual scale comes back at the brightness it was captured with.
+	a, _ := r.Get("0xa")
+	a.BrightnessScale = yeelight.Gamma(2.2)
+
+	if err := lib.Capture("evening", "living"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lib.Apply("evening"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, lamp := range []*yeelighttest.Device{lampA, lampB} {
+		if scenes := requests(lamp, "set_scene"); len(scenes) != 2 || scenes[1] != `["ct",2700,20]` {
+			t.Errorf("expected the captured scene back, got %v", scenes)
+		}
+	}
+
+	lib, err = yeelight.LoadScenes(path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := lib.Names(); len(names) != 2 || names[0] != "evening" || len(lib.Scenes) != 3 {
+		t.Errorf("expected a captured entry per lamp, got %+v", lib.Scenes)
+	}
+}
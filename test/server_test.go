@@ -0,0 +1,254 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/server"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+func TestServer(t *testing.T) {
+	addr := newLamp(t, yeelighttest.Options{State: map[string]string{"power": "off", "bright": "40"}}).Addr()
+
+	registry, err := yeelight.NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registry.Close()
+
+	registry.Update(yeelight.Device{ID: "0x1", Name: "Desk", IpAddress: addr.IP.String(), Port: addr.Port})
+
+	ts := httptest.NewServer(&server.Server{Registry: registry})
+	defer ts.Close()
+
+	do := func(method, path, body string) (int, map[string]interface{}) {
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		var v map[string]interface{}
+		json.NewDecoder(res.Body).Decode(&v)
+
+		return res.StatusCode, v
+	}
+
+	if status, devices := do("GET", "/devices/0x1", ""); status != http.StatusOK {
+		t.Fatalf("expected the device, got %d %v", status, devices)
+	}
+
+	for _, c := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{"PUT", "/devices/desk/power", `{"on": true}`, http.StatusOK},
+		{"PUT", "/devices/0x1/color", `{"rgb": "#ff8800", "effect": "sudden"}`, http.StatusOK},
+		{"PUT", "/devices/0x1/ct", `{"ct": 2700, "effect": "fade"}`, http.StatusBadRequest},
+		{"PUT", "/devices/0x1/color", `{"red": 300, "green": 0, "blue": 0}`, http.StatusBadRequest},
+		{"PUT", "/devices/0x1/bright", `{"brightness": 50}`, http.StatusBadRequest},
+		{"PUT", "/devices/0x1/bright", `{}`, http.StatusBadRequest},
+		{"PUT", "/devices/0x1/bright", `{"bright": 0}`, http.StatusBadRequest},
+		{"PUT", "/devices/0x1/bright", `{"bright": 101}`, http.StatusBadRequest},
+		{"PUT", "/devices/0x1/bright", `{"bright": 60}`, http.StatusOK},
+		{"PUT", "/devices/0x1/ct", `{"effect": "sudden"}`, http.StatusBadRequest},
+		{"PUT", "/devices/0x1/ct", `{"ct": 9000}`, http.StatusBadRequest},
+		{"PUT", "/devices/0x1/ct", `{"ct": 2700}`, http.StatusOK},
+		{"PUT", "/devices/0x1/scene", `{"action": "ct", "ct": 9000, "bright": 50}`, http.StatusBadRequest},
+		{"PUT", "/devices/0x1/timer", `{"minutes": 15}`, http.StatusOK},
+		{"PUT", "/devices/0x2/power", `{"on": true}`, http.StatusNotFound},
+	} {
+		if status, body := do(c.method, c.path, c.body); status != c.status {
+			t.Errorf("%s %s %s: expected %d, got %d %v", c.method, c.path, c.body, c.status, status, body)
+		}
+	}
+
+	// The state is the cache, updated by the commands above.
+	status, device := do("GET", "/devices/desk", "")
+	if status != http.StatusOK {
+		t.Fatalf("expected the device, got %d %v", status, device)
+	}
+
+	state, _ := device["state"].(map[string]interface{})
+	values, _ := state["values"].(map[string]interface{})
+	if device["id"] != "0x1" || values["power"] != "on" || values["rgb"] != "16746496" {
+		t.Errorf("unexpected device %v", device)
+	}
+
+	status, doc := do("GET", "/openapi.json", "")
+	if status != http.StatusOK || doc["openapi"] == nil {
+		t.Errorf("expected the OpenAPI document, got %d", status)
+	}
+}
+
+func TestServerStream(t *testing.T) {
+	lamp := newLamp(t, yeelighttest.Options{State: map[string]string{"power": "off", "bright": "40"}})
+	addr := lamp.Addr()
+
+	registry, err := yeelight.NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registry.Close()
+
+	registry.Update(yeelight.Device{ID: "0x1", Name: "Desk", IpAddress: addr.IP.String(), Port: addr.Port})
+
+	ts := httptest.NewServer(&server.Server{Registry: registry, Groups: map[string][]string{"office": {"0x1"}}})
+	defer ts.Close()
+
+	if res, err := http.Get(ts.URL + "/events?group=kitchen"); err != nil || res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected an unknown group to be refused, got %v %v", res, err)
+	}
+
+	res, err := http.Get(ts.URL + "/events?group=office")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	events := bufio.NewReader(res.Body)
+	next := func() (string, server.Event) {
+		var name string
+		for {
+			line, err := events.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimSpace(line[len("event: "):])
+			case strings.HasPrefix(line, "data: "):
+				var e server.Event
+				if err := json.Unmarshal([]byte(line[len("data: "):]), &e); err != nil {
+					t.Fatal(err)
+				}
+
+				return name, e
+			}
+		}
+	}
+
+	if name, e := next(); name != "state" || e.Device != "0x1" {
+		t.Fatalf("expected the state first, got %s %+v", name, e)
+	}
+
+	lamp.Set(map[string]string{"bright": "80"})
+
+	if name, e := next(); name != "change" || e.Data.(map[string]interface{})["new"] != "80" {
+		t.Fatalf("expected the notified change, got %s %+v", name, e)
+	}
+
+	req, _ := http.NewRequest("PUT", ts.URL+"/devices/desk/power", strings.NewReader(`{"on": true}`))
+	if res, err := http.DefaultClient.Do(req); err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("expected the command to succeed, got %v %v", res, err)
+	}
+
+	seen := map[string]bool{}
+	for !seen["result"] || !seen["change"] {
+		name, e := next()
+		seen[name] = true
+
+		if name == "result" && e.Data.(map[string]interface{})["status"] != float64(http.StatusOK) {
+			t.Errorf("unexpected result %+v", e)
+		}
+	}
+
+	// The same stream over a WebSocket.
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "GET /ws?device=desk HTTP/1.1\r\nHost: yeelight\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+
+	r := bufio.NewReader(conn)
+	upgrade, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if upgrade.StatusCode != http.StatusSwitchingProtocols || upgrade.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected handshake %d %v", upgrade.StatusCode, upgrade.Header)
+	}
+
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	length := int(head[1] & 0x7F)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		length = int(ext[0])<<8 | int(ext[1])
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	var e server.Event
+	if err := json.Unmarshal(payload, &e); err != nil || head[0] != 0x81 || e.Type != "state" {
+		t.Fatalf("expected the state in a text frame, got %x %s", head, payload)
+	}
+}
+
+func TestServerWebSocketHandshake(t *testing.T) {
+	registry, err := yeelight.NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registry.Close()
+
+	ts := httptest.NewServer(&server.Server{Registry: registry, Origins: []string{"https://app.example"}})
+	defer ts.Close()
+
+	for _, c := range []struct {
+		version, origin string
+		status          int
+	}{
+		{"13", "", http.StatusSwitchingProtocols},
+		{"13", ts.URL, http.StatusSwitchingProtocols},
+		{"13", "https://app.example", http.StatusSwitchingProtocols},
+		{"13", "https://other.example", http.StatusForbidden},
+		{"8", "", http.StatusUpgradeRequired},
+	} {
+		req, _ := http.NewRequest("GET", ts.URL+"/ws", nil)
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		req.Header.Set("Sec-WebSocket-Version", c.version)
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != c.status {
+			t.Errorf("version %s origin %q: expected %d, got %d", c.version, c.origin, c.status, res.StatusCode)
+		}
+
+		if c.status == http.StatusUpgradeRequired && res.Header.Get("Sec-WebSocket-Version") != "13" {
+			t.Errorf("expected the supported version in the answer, got %v", res.Header)
+		}
+	}
+}
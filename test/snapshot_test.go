@@ -0,0 +1,76 @@
+package test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	lamp, y := fakeLamp(t, yeelighttest.Options{Background: true, State: map[string]string{
+		"power": "off", "color_mode": "2", "rgb": "16711680", "ct": "4000", "hue": "0", "sat": "0", "bright": "40",
+		"bg_power": "on", "bg_lmode": "1", "bg_rgb": "255", "bg_bright": "80", "bg_flowing": "1",
+		"bg_flow_params": "0,0,1000,1,255,80,1000,1,65280,80",
+	}})
+
+	s, err := y.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Power || s.ColorMode != 2 || s.ColorTemperature != 4000 || s.Brightness != 40 || s.Background == nil || !s.Background.Flowing {
+		t.Fatalf("unexpected snapshot %+v", s)
+	}
+
+	// Snapshots survive a round trip through JSON.
+	data, _ := json.Marshal(s)
+	var decoded yeelight.Snapshot
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := y.Restore(decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, r := range lamp.Requests() {
+		if r.Method != "get_prop" {
+			params, _ := json.Marshal(r.Params)
+			got = append(got, r.Method+" "+string(params))
+		}
+	}
+
+	// The main light was off, it is not lit up to restore its color.
+	expected := []string{
+		`set_power ["off","sudden",30]`,
+		`bg_set_scene ["cf",0,0,"1000,1,255,80,1000,1,65280,80"]`,
+	}
+
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// A lamp in moonlight comes back to it.
+	lamp.Set(map[string]string{"power": "on", "active_mode": "1"})
+
+	s, err = y.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Moonlight == nil || !*s.Moonlight {
+		t.Fatalf("expected the snapshot to be in moonlight, got %+v", s)
+	}
+
+	lamp.Set(map[string]string{"active_mode": "0"})
+
+	if err := y.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+
+	expectProps(t, lamp, map[string]string{"power": "on", "active_mode": "1"})
+}
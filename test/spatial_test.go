@@ -0,0 +1,44 @@
+package test
+
+import (
+	"image/color"
+	"testing"
+	"time"
+
+	"github.com/LordAur/yeelight/spatial"
+)
+
+func TestSpatialEffects(t *testing.T) {
+	red, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+
+	room := &spatial.Room{
+		Lamps: []spatial.Lamp{{X: 0, Y: 0}, {X: 2, Y: 0}, {X: 4, Y: 0}},
+	}
+
+	got := room.Frame(spatial.Gradient(red, blue, 0, 0, 4, 0), 0)
+	if got[0] != red || got[1] != (color.RGBA{128, 0, 128, 255}) || got[2] != blue {
+		t.Errorf("unexpected gradient %v", got)
+	}
+
+	// After one second the wave moved one unit, the lamp at 2 shows what the lamp at 1 showed at the start.
+	wave := spatial.Sweep([]color.RGBA{red, blue}, 4, 1)
+	if a, b := wave(1, 0, 0), room.Frame(wave, time.Second)[1]; a != b {
+		t.Errorf("wave did not move: %v at start, %v after a second", a, b)
+	}
+
+	// The ring reaches the lamp at 2 after one second.
+	pulse := spatial.Pulse(red, 0, 0, 2, 0.5, 4*time.Second)
+	if got := room.Frame(pulse, time.Second); got[0].R != 0 || got[1] != red || got[2].R != 0 {
+		t.Errorf("unexpected pulse %v", got)
+	}
+
+	flows := room.Flows(wave, 4*time.Second, 8)
+	if len(flows) != 3 || len(flows[0]) != 8 || flows[0][0].Duration != 500 {
+		t.Fatalf("unexpected flows %v", flows)
+	}
+
+	// A full period later every lamp is back where it started.
+	if last := flows[0][7]; last.Value != 0xff0000 || last.Brightness != 100 {
+		t.Errorf("expected the period to end on red, got %v", last)
+	}
+}
@@ -0,0 +1,142 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/webhook"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+type delivery struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	// The lamp has no set_name.
+	lamp := newLamp(t, yeelighttest.Options{
+		Support: []string{"get_prop", "set_power", "set_bright"},
+		State:   map[string]string{"power": "off", "bright": "40"},
+	})
+	addr := lamp.Addr()
+
+	registry, err := yeelight.NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registry.Close()
+
+	registry.Update(yeelight.Device{ID: "0x1", Name: "Desk", IpAddress: addr.IP.String(), Port: addr.Port})
+
+	deliveries := make(chan delivery, 16)
+	var refused int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{r.URL.Path, r.Header, body}
+
+		// The first delivery fails, its retry goes through.
+		if atomic.AddInt32(&refused, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	d := &webhook.Dispatcher{
+		Registry: registry,
+		Hooks: []webhook.Hook{
+			{URL: ts.URL + "/state", Secret: "s3cret", Types: []string{webhook.State}, Properties: []string{"power"}},
+			{URL: ts.URL + "/failures", CloudEvents: true, Devices: []string{"desk"}, Types: []string{webhook.CommandFailed}},
+		},
+		Backoff: 10 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- d.Run(ctx) }()
+
+	next := func() delivery {
+		t.Helper()
+
+		select {
+		case d := <-deliveries:
+			return d
+		case <-time.After(3 * time.Second):
+			t.Fatal("expected a delivery")
+		}
+
+		return delivery{}
+	}
+
+	// The lamp is followed in the background, it is switched on once the dispatcher read its state.
+	eventually(t, "the dispatcher to follow the lamp", func() bool { return len(requests(lamp, "get_prop")) > 0 })
+	time.Sleep(50 * time.Millisecond)
+
+	lamp.Set(map[string]string{"power": "on", "bright": "80"})
+
+	first, retry := next(), next()
+
+	if first.path != "/state" || retry.header.Get("X-Yeelight-Attempt") != "2" ||
+		retry.header.Get("X-Yeelight-Delivery") != first.header.Get("X-Yeelight-Delivery") {
+		t.Errorf("expected a retry of the first delivery, got %v and %v", first.header, retry.header)
+	}
+
+	if err := webhook.Verify("s3cret", retry.header, retry.body, time.Minute); err != nil {
+		t.Error(err)
+	}
+
+	if err := webhook.Verify("guess", retry.header, retry.body, time.Minute); err == nil {
+		t.Errorf("expected a wrong secret to fail")
+	}
+
+	var e webhook.Event
+	json.Unmarshal(retry.body, &e)
+
+	if e.Type != webhook.State || e.Device != "0x1" || e.Name != "Desk" || len(e.Changes) != 1 || e.Changes["power"] != (webhook.Change{Old: "off", New: "on"}) {
+		t.Errorf("unexpected event %s", retry.body)
+	}
+
+	c, err := registry.Get("0x1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, _ := c.SetName("kitchen"); r.Error == nil {
+		t.Fatalf("expected the lamp to refuse set_name")
+	}
+
+	failure := next()
+
+	var cloudEvent struct {
+		SpecVersion string        `json:"specversion"`
+		Type        string        `json:"type"`
+		Subject     string        `json:"subject"`
+		Data        webhook.Event `json:"data"`
+	}
+	json.Unmarshal(failure.body, &cloudEvent)
+
+	if failure.path != "/failures" || failure.header.Get("Content-Type") != "application/cloudevents+json" ||
+		cloudEvent.SpecVersion != "1.0" || cloudEvent.Type != "yeelight.command_failed" || cloudEvent.Subject != "0x1" {
+		t.Errorf("unexpected CloudEvent %s", failure.body)
+	}
+
+	if cmd := cloudEvent.Data.Command; cmd == nil || cmd.Method != "set_name" || cmd.Error != "device error -1: unsupported method" {
+		t.Errorf("unexpected command %+v", cmd)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected the dispatcher to stop with the context, got %v", err)
+	}
+}
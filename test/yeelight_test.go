@@ -1,471 +1,339 @@
 package test
 
 import (
+	"encoding/json"
+	"net"
 	"testing"
 	"time"
 
 	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/yeelighttest"
 )
 
-type Yeelight struct {
-	IpAddress string
+// newLamp starts a fake device, it is closed with the test.
+func newLamp(t *testing.T, opts yeelighttest.Options) *yeelighttest.Device {
+	d := yeelighttest.NewDevice(opts)
+	t.Cleanup(d.Close)
+
+	return d
 }
 
-func TestDiscovery(t *testing.T) {
+// fakeLamp starts a fake device and connects to it, both are closed with the test.
+func fakeLamp(t *testing.T, opts yeelighttest.Options) (*yeelighttest.Device, yeelight.Config) {
+	d := newLamp(t, opts)
 
-	ips, err := yeelight.Discovery("192.168.100.0/24")
-	if err != nil {
-		t.Error(err)
-		t.Fail()
-	}
+	y := d.Config()
+	t.Cleanup(y.Close)
 
-	t.Log(ips)
+	return d, y
 }
 
-func TestListen(t *testing.T) {
-	conn, err := yeelight.Listen("192.168.100.7")
-	if err != nil {
-		t.Error(err)
-		t.Fail()
+// offlineLamp connects to a fake device that is already closed, New leaves the Config unconnected.
+func offlineLamp() yeelight.Config {
+	d := yeelighttest.NewDevice(yeelighttest.Options{})
+	d.Close()
+
+	return d.Config()
+}
+
+// requests returns the requests of a method the device received, with their params as JSON.
+func requests(d *yeelighttest.Device, method string) []string {
+	var found []string
+	for _, r := range d.Requests() {
+		if r.Method == method {
+			params, _ := json.Marshal(r.Params)
+			found = append(found, string(params))
+		}
 	}
 
-	defer conn.Close()
+	return found
+}
+
+// eventually waits up to 3 seconds for a condition.
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
 
-	for {
-		_, err := yeelight.ReadMessage(conn)
-		if err != nil {
-			t.Error(err)
-			t.Fail()
+	for deadline := time.Now().Add(3 * time.Second); !condition(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s", what)
 		}
 	}
 }
 
-func TestGetProps(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
+// defaultPortLamp starts a fake device on port 55443, which Discovery and Listen expect.
+func defaultPortLamp(t *testing.T) *yeelighttest.Device {
+	listener, err := net.Listen("tcp", "127.0.0.1:55443")
+	if err != nil {
+		t.Skipf("port 55443 is not free: %v", err)
+	}
+	listener.Close()
 
-	defer y.Close()
+	d := yeelighttest.NewDevice(yeelighttest.Options{Addr: "127.0.0.1:55443"})
+	t.Cleanup(d.Close)
+
+	return d
+}
+
+func expectOK(t *testing.T, r yeelight.Response, err error) {
+	t.Helper()
 
-	r, err := y.GetProps("bright", "power", "ct")
 	if err != nil {
-		t.Error(err)
-		t.Fail()
+		t.Fatal(err)
 	}
 
-	t.Log(r)
+	if r.Error != nil || len(r.Result) != 1 || r.Result[0] != "ok" {
+		t.Fatalf("expected ok, got %+v %v", r.Result, r.Error)
+	}
 }
 
-func TestSetRGB(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
+func expectProps(t *testing.T, d *yeelighttest.Device, props map[string]string) {
+	t.Helper()
 
-	defer y.Close()
+	for name, value := range props {
+		if got := d.Get(name); got != value {
+			t.Errorf("expected %s %q, got %q", name, value, got)
+		}
+	}
+}
 
-	r, err := y.SetRGB(58, 50, 153, "smooth", 500)
+func TestDiscovery(t *testing.T) {
+	defaultPortLamp(t)
+
+	ips, err := yeelight.Discovery("127.0.0.1/32")
 	if err != nil {
-		t.Error(err)
-		t.Fail()
+		t.Fatal(err)
 	}
 
-	t.Log(r)
+	if len(ips) != 1 || ips[0] != "127.0.0.1" {
+		t.Errorf("expected the fake lamp, got %v", ips)
+	}
+}
 
-	time.Sleep(5 * time.Second)
+func TestListen(t *testing.T) {
+	d := defaultPortLamp(t)
 
-	r, err = y.SetRGB(255, 255, 255, "smooth", 500)
+	conn, err := yeelight.Listen("127.0.0.1")
 	if err != nil {
-		t.Error(err)
-		t.Fail()
+		t.Fatal(err)
 	}
+	defer conn.Close()
 
-	t.Log(r)
-}
+	// The listening connection must be accepted before the change.
+	for d.Connections() == 0 {
+		time.Sleep(time.Millisecond)
+	}
 
-func TestSetTemp(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
+	d.Set(map[string]string{"power": "off", "bright": "30"})
 
-	defer y.Close()
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
 
-	r, err := y.SetColorTemp(5000, "smooth", 500)
+	m, err := yeelight.ReadMessage(conn)
 	if err != nil {
-		t.Error(err)
-		t.Fail()
+		t.Fatal(err)
 	}
 
-	t.Log(r)
+	if m.Method != "props" || m.Params.Power != "off" || m.Params.Brightness != 30 {
+		t.Errorf("unexpected notification %+v", m)
+	}
+}
 
-	time.Sleep(5 * time.Second)
+func TestGetProps(t *testing.T) {
+	_, y := fakeLamp(t, yeelighttest.Options{State: map[string]string{"bright": "42"}})
 
-	r, err = y.SetColorTemp(3200, "smooth", 500)
+	r, err := y.GetProps("bright", "power", "ct", "bg_power")
 	if err != nil {
-		t.Error(err)
-		t.Fail()
+		t.Fatal(err)
 	}
 
-	t.Log(r)
+	if len(r.Result) != 4 || r.Result[0] != "42" || r.Result[1] != "on" || r.Result[2] != "4000" || r.Result[3] != "" {
+		t.Errorf("unexpected properties %v", r.Result)
+	}
 }
 
-func TestSetHueSaturation(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
+func TestSetRGB(t *testing.T) {
+	d, y := fakeLamp(t, yeelighttest.Options{})
 
-	defer y.Close()
+	r, err := y.SetRGB(58, 50, 153, "smooth", 500)
+	expectOK(t, r, err)
+	expectProps(t, d, map[string]string{"rgb": "3814041", "color_mode": "1"})
+}
 
-	time.Sleep(3 * time.Second)
+func TestSetTemp(t *testing.T) {
+	d, y := fakeLamp(t, yeelighttest.Options{})
 
-	r, err := y.SetHueSaturation(255, 45, "smooth", 500)
-	if err != nil {
-		t.Error(err)
-		t.Fail()
-	}
+	r, err := y.SetColorTemp(5000, "smooth", 500)
+	expectOK(t, r, err)
+	expectProps(t, d, map[string]string{"ct": "5000", "color_mode": "2"})
+}
 
-	t.Log(r)
+func TestSetHueSaturation(t *testing.T) {
+	d, y := fakeLamp(t, yeelighttest.Options{})
 
-	time.Sleep(3 * time.Second)
+	r, err := y.SetHueSaturation(255, 45, "smooth", 500)
+	expectOK(t, r, err)
+	expectProps(t, d, map[string]string{"hue": "255", "sat": "45", "color_mode": "3"})
 }
 
 func TestSetBright(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
-
-	defer y.Close()
+	d, y := fakeLamp(t, yeelighttest.Options{})
 
 	r, err := y.SetBright(10, "smooth", 500)
-	if err != nil {
-		t.Error(err)
-		t.Fail()
-	}
-
-	t.Log(r)
+	expectOK(t, r, err)
+	expectProps(t, d, map[string]string{"bright": "10"})
 
-	time.Sleep(5 * time.Second)
+	// A switched off lamp refuses it.
+	d.Set(map[string]string{"power": "off"})
 
-	r, err = y.SetBright(80, "smooth", 500)
-	if err != nil {
-		t.Error(err)
-		t.Fail()
+	r, _ = y.SetBright(80, "smooth", 500)
+	if r.Error == nil || *r.Error != *yeelighttest.ErrGeneral {
+		t.Errorf("expected a general error, got %v", r.Error)
 	}
-
-	t.Log(r)
-
-	time.Sleep(3 * time.Second)
 }
 
 func TestSetDefault(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
-
-	defer y.Close()
+	_, y := fakeLamp(t, yeelighttest.Options{})
 
 	r, err := y.SetDefault()
-	if err != nil {
-		t.Error(err)
-		t.Fail()
-	}
-
-	t.Log(r)
-
-	time.Sleep(3 * time.Second)
+	expectOK(t, r, err)
 }
 
 func TestSetPower(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
-
-	defer y.Close()
+	d, y := fakeLamp(t, yeelighttest.Options{})
 
 	r, err := y.SetPower(false, "smooth", 1000)
-	if err != nil {
-		t.Error(err)
-		t.Fail()
-	}
+	expectOK(t, r, err)
+	expectProps(t, d, map[string]string{"power": "off"})
 
-	t.Log(r)
-
-	time.Sleep(5 * time.Second)
-
-	r, err = y.SetPower(true, "smooth", 1000)
-	if err != nil {
-		t.Error(err)
-		t.Fail()
-	}
-
-	t.Log(r)
+	r, err = y.Toggle()
+	expectOK(t, r, err)
+	expectProps(t, d, map[string]string{"power": "on"})
 }
 
 func TestStartColorFlow(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
+	d, y := fakeLamp(t, yeelighttest.Options{})
 
-	defer y.Close()
+	notifications, stop := y.Notifications()
+	defer stop()
 
-	r, err := y.SetColorFlow(0, 0, []yeelight.FlowExpression{
-		{
-			Duration:   1000,
-			Mode:       2,
-			Value:      2000,
-			Brightness: 100,
-		},
-		{
-			Duration:   1000,
-			Mode:       2,
-			Value:      1000,
-			Brightness: 100,
-		},
-		{
-			Duration:   1000,
-			Mode:       2,
-			Value:      4000,
-			Brightness: 100,
-		},
+	r, err := y.SetColorFlow(2, 2, []yeelight.FlowExpression{
+		{Duration: 50, Mode: 2, Value: 2000, Brightness: 100},
+		{Duration: 50, Mode: 2, Value: 2700, Brightness: 60},
 	})
-
-	if err != nil {
-		t.Error(err)
-		t.Fail()
+	expectOK(t, r, err)
+
+	// Two steps and the lamp powers off.
+	timeout := time.After(3 * time.Second)
+	for d.Get("power") != "off" {
+		select {
+		case <-notifications:
+		case <-timeout:
+			t.Fatal("expected the flow to power off the lamp")
+		}
 	}
 
-	t.Log(r)
+	expectProps(t, d, map[string]string{"flowing": "0", "ct": "2700", "bright": "60"})
 
-	time.Sleep(3 * time.Second)
+	// A color temperature out of range is refused by the lamp.
+	r, _ = y.SetColorFlow(0, 0, []yeelight.FlowExpression{{Duration: 1000, Mode: 2, Value: 1000, Brightness: 100}})
+	if r.Error == nil || *r.Error != *yeelighttest.ErrInvalidParams {
+		t.Errorf("expected invalid params, got %v", r.Error)
+	}
 }
 
 func TestStartColorFlowRGB(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
-
-	defer y.Close()
+	d, y := fakeLamp(t, yeelighttest.Options{})
 
 	r, err := y.SetColorFlow(0, 0, []yeelight.FlowExpression{
-		{
-			Duration:   2000,
-			Mode:       1,
-			Value:      y.GenerateRGB(135, 62, 35),
-			Brightness: 100,
-		},
-		{
-			Duration:   2000,
-			Mode:       1,
-			Value:      y.GenerateRGB(118, 181, 197),
-			Brightness: 100,
-		},
-		{
-			Duration:   2000,
-			Mode:       1,
-			Value:      y.GenerateRGB(234, 182, 118),
-			Brightness: 100,
-		},
+		{Duration: 2000, Mode: 1, Value: y.GenerateRGB(135, 62, 35), Brightness: 100},
+		{Duration: 2000, Mode: 1, Value: y.GenerateRGB(118, 181, 197), Brightness: 100},
 	})
-
-	if err != nil {
-		t.Error(err)
-		t.Fail()
-	}
-
-	t.Log(r)
-
-	time.Sleep(3 * time.Second)
+	expectOK(t, r, err)
+	expectProps(t, d, map[string]string{"flowing": "1", "flow_params": "0,0,2000,1,8863267,100,2000,1,7779781,100"})
 }
 
 func TestStopColorFlow(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
+	d, y := fakeLamp(t, yeelighttest.Options{})
 
-	defer y.Close()
+	r, err := y.SetColorFlow(0, 1, []yeelight.FlowExpression{{Duration: 1000, Mode: 2, Value: 2700, Brightness: 50}})
+	expectOK(t, r, err)
 
-	r, err := y.StopColorFlow()
-	if err != nil {
-		t.Error(err)
-		t.Fail()
-	}
-
-	t.Log(r)
-
-	time.Sleep(3 * time.Second)
+	r, err = y.StopColorFlow()
+	expectOK(t, r, err)
+	expectProps(t, d, map[string]string{"flowing": "0", "power": "on"})
 }
 
 func TestSetScene(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
-
-	defer y.Close()
+	d, y := fakeLamp(t, yeelighttest.Options{State: map[string]string{"power": "off"}})
 
 	r, err := y.SetScene(yeelight.Scene{
 		Action:     "color",
 		Color:      65280,
 		Brightness: 70,
 	})
-	if err != nil {
-		t.Error(err)
-		t.Fail()
-	}
-
-	t.Log(r)
-
-	time.Sleep(3 * time.Second)
+	expectOK(t, r, err)
+	expectProps(t, d, map[string]string{"power": "on", "rgb": "65280", "bright": "70", "color_mode": "1"})
 }
 
-func TestCronAdd(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
+func TestCron(t *testing.T) {
+	d, y := fakeLamp(t, yeelighttest.Options{})
 
-	defer y.Close()
+	r, err := y.CronAdd(15)
+	expectOK(t, r, err)
+	expectProps(t, d, map[string]string{"delayoff": "15"})
 
-	r, err := y.CronAdd(1)
+	r, err = y.CronGet()
 	if err != nil {
-		t.Error(err)
-		t.Fail()
+		t.Fatal(err)
 	}
 
-	t.Log(r)
-
-	time.Sleep(3 * time.Second)
-}
-
-func TestCronGet(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
-
-	defer y.Close()
-
-	r, err := y.CronGet()
-	if err != nil {
-		t.Error(err)
-		t.Fail()
+	if len(r.Result) != 1 {
+		t.Fatalf("expected a cron job, got %v", r.Result)
 	}
 
-	t.Log(r)
-
-	time.Sleep(3 * time.Second)
-}
-
-func TestCronDelete(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
-
-	defer y.Close()
-
-	r, err := y.CronDelete()
-	if err != nil {
-		t.Error(err)
-		t.Fail()
+	if job, _ := r.Result[0].(map[string]interface{}); job["type"] != float64(0) || job["delay"] != float64(15) {
+		t.Errorf("unexpected cron jobs %v", r.Result)
 	}
 
-	t.Log(r)
+	r, err = y.CronDelete()
+	expectOK(t, r, err)
 
-	time.Sleep(3 * time.Second)
+	if r, _ = y.CronGet(); len(r.Result) != 0 {
+		t.Errorf("expected no cron job, got %v", r.Result)
+	}
 }
 
 func TestSetAdjust(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
-
-	defer y.Close()
+	d, y := fakeLamp(t, yeelighttest.Options{State: map[string]string{"bright": "50"}})
 
 	r, err := y.SetAdjust("increase", "bright")
-	if err != nil {
-		t.Error(err)
-		t.Fail()
-	}
-
-	t.Log(r)
-
-	time.Sleep(3 * time.Second)
+	expectOK(t, r, err)
+	expectProps(t, d, map[string]string{"bright": "60"})
 
 	r, err = y.SetAdjust("decrease", "bright")
-	if err != nil {
-		t.Error(err)
-		t.Fail()
-	}
-
-	t.Log(r)
-
-	time.Sleep(3 * time.Second)
+	expectOK(t, r, err)
+	expectProps(t, d, map[string]string{"bright": "50"})
 }
 
 func TestSetName(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
-
-	defer y.Close()
+	d, y := fakeLamp(t, yeelighttest.Options{})
 
 	r, err := y.SetName("Bed Bulb")
-	if err != nil {
-		t.Error(err)
-		t.Fail()
-	}
-
-	t.Log(r)
-
-	time.Sleep(3 * time.Second)
+	expectOK(t, r, err)
+	expectProps(t, d, map[string]string{"name": "Bed Bulb"})
 }
 
 func TestAdjustBright(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
-
-	defer y.Close()
+	d, y := fakeLamp(t, yeelighttest.Options{State: map[string]string{"bright": "5"}})
 
 	r, err := y.AdjustBright(-10, 100)
-	if err != nil {
-		t.Error(err)
-		t.Fail()
-	}
-
-	t.Log(r)
-
-	time.Sleep(3 * time.Second)
+	expectOK(t, r, err)
+	expectProps(t, d, map[string]string{"bright": "1"})
 }
 
 func TestAdjustColorTemperature(t *testing.T) {
-	y := yeelight.New(&yeelight.Config{
-		IpAddress: "192.168.100.7",
-		Port:      55443,
-	})
-
-	defer y.Close()
+	d, y := fakeLamp(t, yeelighttest.Options{})
 
 	r, err := y.AdjustColorTemperature(-10, 100)
-	if err != nil {
-		t.Error(err)
-		t.Fail()
-	}
-
-	t.Log(r)
-
-	time.Sleep(3 * time.Second)
+	expectOK(t, r, err)
+	expectProps(t, d, map[string]string{"ct": "3520"})
 }
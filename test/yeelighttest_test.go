@@ -0,0 +1,155 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/LordAur/yeelight"
+	"github.com/LordAur/yeelight/yeelighttest"
+)
+
+func TestFakeDevice(t *testing.T) {
+	d, y := fakeLamp(t, yeelighttest.Options{
+		Name:           "Ceiling",
+		Model:          "ceiling4",
+		Background:     true,
+		MaxConnections: 2,
+		Quota:          7,
+	})
+
+	if info := d.Info(); info.Name != "Ceiling" || info.Model != "ceiling4" || info.Port != d.Addr().Port || info.Power != "on" {
+		t.Errorf("unexpected advertisement %+v", info)
+	}
+
+	// The background light has its own state, changes of it are notified.
+	notifications, stop := y.Notifications()
+	defer stop()
+
+	if _, err := y.GetProps("power"); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", d.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	send := func(id int, method string, params ...interface{}) yeelight.Response {
+		t.Helper()
+
+		data, _ := json.Marshal(yeelight.Request{ID: id, Method: method, Params: params})
+		fmt.Fprintf(conn, "%s\r\n", data)
+
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+
+		// Notifications of the change may come before the next answer.
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var r yeelight.Response
+			json.Unmarshal(line, &r)
+
+			if r.ID == id {
+				return r
+			}
+		}
+	}
+
+	if r := send(1, "bg_set_power", "on", "smooth", 500); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+
+	if r := send(2, "bg_set_rgb", 255, "sudden", 0); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+
+	expectProps(t, d, map[string]string{"bg_power": "on", "bg_rgb": "255", "bg_lmode": "1", "rgb": "16777215"})
+
+	select {
+	case n := <-notifications:
+		if n.Method != "props" {
+			t.Errorf("unexpected notification %+v", n)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected a notification of the background light")
+	}
+
+	// The spec errors.
+	if r := send(3, "bg_set_rgb", 255, "smooth", 10); r.Error == nil || *r.Error != *yeelighttest.ErrInvalidParams {
+		t.Errorf("expected invalid params, got %v", r.Error)
+	}
+
+	if r := send(4, "set_fancy"); r.Error == nil || *r.Error != *yeelighttest.ErrUnsupported {
+		t.Errorf("expected an unsupported method, got %v", r.Error)
+	}
+
+	// A third connection is closed by the lamp.
+	extra, err := net.Dial("tcp", d.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer extra.Close()
+
+	extra.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := extra.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected the connection over the limit to be closed, got %v", err)
+	}
+
+	// Music mode: the lamp connects back and runs what it is sent without answers.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	if r := send(5, "set_music", 1, "127.0.0.1", port); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+
+	music, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer music.Close()
+
+	expectProps(t, d, map[string]string{"music_on": "1"})
+
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(music, "{\"id\":%d,\"method\":\"set_bright\",\"params\":[%d,\"sudden\",0]}\r\n", i, i+1)
+	}
+
+	for deadline := time.Now().Add(3 * time.Second); d.Get("bright") != strconv.Itoa(20); {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the music commands to be run, bright is %s", d.Get("bright"))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The quota of the connection is used up by the 5 commands before and 2 more, music mode is not counted.
+	send(6, "get_prop", "power")
+	send(7, "get_prop", "power")
+
+	if r := send(8, "get_prop", "power"); r.Error == nil || *r.Error != *yeelighttest.ErrQuota {
+		t.Errorf("expected the quota to be exceeded, got %+v", r)
+	}
+
+	if r, _ := y.GetProps("power"); r.Error != nil {
+		t.Errorf("expected the quota to be per connection, got %v", r.Error)
+	}
+
+	if n := len(d.Requests()); n != 30 {
+		t.Errorf("expected 30 requests, got %d", n)
+	}
+}
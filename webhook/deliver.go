@@ -0,0 +1,194 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// work delivers the events of a hook in order until the context is cancelled.
+func (d *Dispatcher) work(ctx context.Context, h Hook, queue chan Event) {
+	attempts := d.Attempts
+	if attempts <= 0 {
+		attempts = 6
+	}
+
+	for {
+		var e Event
+		select {
+		case <-ctx.Done():
+			return
+		case e = <-queue:
+		}
+
+		wait := d.Backoff
+		if wait <= 0 {
+			wait = time.Second
+		}
+
+		for attempt := 1; ; attempt++ {
+			retry, after, err := d.deliver(ctx, h, e, attempt)
+			if err == nil {
+				break
+			}
+
+			if !retry || attempt == attempts {
+				d.giveUp(h, e, fmt.Errorf("delivery %d to %s: %w", attempt, h.URL, err))
+				break
+			}
+
+			if after < wait {
+				after = wait
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(after):
+			}
+
+			wait = min(2*wait, 5*time.Minute)
+		}
+	}
+}
+
+/*
+deliver POSTs an event once. Retry tells whether another attempt may succeed, after is the wait the endpoint asked
+for with Retry-After.
+*/
+func (d *Dispatcher) deliver(ctx context.Context, h Hook, e Event, attempt int) (retry bool, after time.Duration, err error) {
+	body, contentType, err := d.encode(h, e)
+	if err != nil {
+		return false, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, 0, err
+	}
+
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "yeelight-webhook")
+	req.Header.Set("X-Yeelight-Event", e.Type)
+	req.Header.Set("X-Yeelight-Delivery", e.ID)
+	req.Header.Set("X-Yeelight-Attempt", strconv.Itoa(attempt))
+
+	if h.Secret != "" {
+		now := time.Now()
+		req.Header.Set("X-Yeelight-Timestamp", strconv.FormatInt(now.Unix(), 10))
+		req.Header.Set("X-Yeelight-Signature", Sign(h.Secret, now, body))
+	}
+
+	client := d.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, 0, err
+	}
+	defer res.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, 0, nil
+	}
+
+	err = fmt.Errorf("%s answered %s", h.URL, res.Status)
+
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable:
+		seconds, _ := strconv.Atoi(res.Header.Get("Retry-After"))
+		return true, min(time.Duration(seconds)*time.Second, 5*time.Minute), err
+	case res.StatusCode == http.StatusRequestTimeout || res.StatusCode >= 500:
+		return true, 0, err
+	}
+
+	return false, 0, err
+}
+
+// encode writes the event as it is or as the data of a CloudEvent.
+func (d *Dispatcher) encode(h Hook, e Event) ([]byte, string, error) {
+	if !h.CloudEvents {
+		body, err := json.Marshal(e)
+		return body, "application/json", err
+	}
+
+	source := d.Source
+	if source == "" {
+		source = "/yeelight"
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"specversion":     "1.0",
+		"id":              e.ID,
+		"source":          source,
+		"type":            "yeelight." + e.Type,
+		"subject":         e.Device,
+		"time":            e.Time.UTC().Format(time.RFC3339Nano),
+		"datacontenttype": "application/json",
+		"data":            e,
+	})
+
+	return body, "application/cloudevents+json", err
+}
+
+/*
+This function is used to compute the X-Yeelight-Signature of a body sent at a time, the hex HMAC-SHA256 of the Unix
+time, a dot and the body, prefixed with "sha256=".
+*/
+func Sign(secret string, at time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", at.Unix())
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+/*
+This function is used by a receiver to check the signature of a delivery. A delivery older than tolerance is refused
+too, so a captured request can't be replayed later. Zero tolerance accepts any age.
+
+Example:
+
+	body, _ := io.ReadAll(r.Body)
+	if err := webhook.Verify("s3cret", r.Header, body, 5*time.Minute); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+*/
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	unix, err := strconv.ParseInt(header.Get("X-Yeelight-Timestamp"), 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid X-Yeelight-Timestamp")
+	}
+
+	at := time.Unix(unix, 0)
+
+	if !hmac.Equal([]byte(Sign(secret, at, body)), []byte(header.Get("X-Yeelight-Signature"))) {
+		return errors.New("signature does not match")
+	}
+
+	if age := time.Since(at); tolerance > 0 && (age > tolerance || age < -tolerance) {
+		return fmt.Errorf("delivery is %s old", age.Round(time.Second))
+	}
+
+	return nil
+}
@@ -0,0 +1,314 @@
+/*
+Package webhook POSTs the events of the lamps of a registry to HTTP endpoints. The events are the state changes and
+the connection changes the lamps notify on their shared connection, and the commands that failed on it.
+
+Every event is a JSON object:
+
+	{
+		"id": "9f2c4e0a7b1d3c58",
+		"type": "state",
+		"device": "0x000000000015243f",
+		"name": "Desk",
+		"time": "2024-05-01T20:15:00.123Z",
+		"changes": {"power": {"old": "off", "new": "on"}, "bright": {"old": "40", "new": "80"}}
+	}
+
+The type is "state" with the changed properties formatted like "get_prop" answers them, "online" or "offline" when
+the connection to the lamp is back or lost, and "command_failed" with a "command" object of the method, the params
+and the error instead of "changes". With CloudEvents the event is the data of a structured mode CloudEvent of type
+"yeelight.<type>".
+
+A hook with a secret gets the headers X-Yeelight-Timestamp, the Unix time of the delivery, and X-Yeelight-Signature,
+"sha256=" and the hex HMAC-SHA256 of the timestamp, a dot and the body, see Verify. Failed deliveries are retried
+with an exponential backoff on network errors, 408, 429 and 5xx answers, the event ID stays the same.
+
+Example:
+
+	d := &webhook.Dispatcher{
+		Registry: registry,
+		Hooks: []webhook.Hook{
+			{URL: "https://example.com/lamps", Secret: "s3cret", Types: []string{"offline", "command_failed"}},
+		},
+	}
+
+	err := d.Run(ctx)
+*/
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LordAur/yeelight"
+)
+
+// Types of the events.
+const (
+	State         = "state"
+	Online        = "online"
+	Offline       = "offline"
+	CommandFailed = "command_failed"
+)
+
+type Event struct {
+	ID      string            `json:"id"`
+	Type    string            `json:"type"`
+	Device  string            `json:"device"`
+	Name    string            `json:"name,omitempty"`
+	Time    time.Time         `json:"time"`
+	Changes map[string]Change `json:"changes,omitempty"`
+	Command *yeelight.Failure `json:"command,omitempty"`
+}
+
+type Change struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// Hook is an endpoint and the events it gets, a filter left empty lets every event through.
+type Hook struct {
+	URL string `json:"url"`
+
+	// Key of the HMAC signature, no signature without it.
+	Secret string `json:"secret,omitempty"`
+
+	// Event types.
+	Types []string `json:"types,omitempty"`
+
+	// Device IDs or names.
+	Devices []string `json:"devices,omitempty"`
+
+	// Properties of state events, changes of other properties are left out.
+	Properties []string `json:"properties,omitempty"`
+
+	// Send CloudEvents 1.0 in structured mode instead of the plain event.
+	CloudEvents bool `json:"cloudevents,omitempty"`
+
+	// Extra headers, for example an Authorization header.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type Dispatcher struct {
+	Registry *yeelight.Registry
+	Hooks    []Hook
+
+	// Default a client with a timeout of 10 seconds.
+	Client *http.Client
+
+	// Deliveries of an event to a hook, default 6.
+	Attempts int
+
+	// Wait before the first retry, doubled after every attempt up to 5 minutes. Default 1 second.
+	Backoff time.Duration
+
+	// The CloudEvents source, default "/yeelight".
+	Source string
+
+	// Called when an event is given up for a hook, after the last attempt or when its queue is full.
+	OnError func(h Hook, e Event, err error)
+
+	mu     sync.Mutex
+	queues []chan Event
+}
+
+/*
+This function is used to run the dispatcher until the context is cancelled. Every lamp of the registry is followed,
+lamps added later or unreachable for a while are picked up within 10 seconds. Every hook has a queue of its own, so
+a slow endpoint delays only its own events.
+*/
+func (d *Dispatcher) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queues := make([]chan Event, len(d.Hooks))
+	for i := range queues {
+		queues[i] = make(chan Event, 256)
+	}
+
+	d.mu.Lock()
+	d.queues = queues
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		d.queues = nil
+		d.mu.Unlock()
+	}()
+
+	var wg sync.WaitGroup
+	for i, h := range d.Hooks {
+		wg.Add(1)
+		go func(h Hook, queue chan Event) {
+			defer wg.Done()
+			d.work(ctx, h, queue)
+		}(h, queues[i])
+	}
+
+	d.follow(ctx)
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+/*
+This function is used to send an event of another source to the hooks, for example a command failure seen by a
+service. ID and time are filled in when empty. Events are only sent while Run runs.
+*/
+func (d *Dispatcher) Publish(e Event) {
+	if e.ID == "" {
+		e.ID = newID()
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	d.mu.Lock()
+	queues := d.queues
+	d.mu.Unlock()
+
+	for i, queue := range queues {
+		h := d.Hooks[i]
+
+		filtered, ok := d.filter(h, e)
+		if !ok {
+			continue
+		}
+
+		select {
+		case queue <- filtered:
+		default:
+			d.giveUp(h, filtered, fmt.Errorf("queue of %s is full", h.URL))
+		}
+	}
+}
+
+// filter applies the filters of a hook, a state event keeps the changes of the wanted properties.
+func (d *Dispatcher) filter(h Hook, e Event) (Event, bool) {
+	if len(h.Types) > 0 && !slices.Contains(h.Types, e.Type) {
+		return e, false
+	}
+
+	if len(h.Devices) > 0 && !slices.ContainsFunc(h.Devices, func(idOrName string) bool {
+		return idOrName == e.Device || (e.Name != "" && strings.EqualFold(idOrName, e.Name))
+	}) {
+		return e, false
+	}
+
+	if e.Type != State || len(h.Properties) == 0 {
+		return e, true
+	}
+
+	changes := map[string]Change{}
+	for property, c := range e.Changes {
+		if slices.Contains(h.Properties, property) {
+			changes[property] = c
+		}
+	}
+
+	e.Changes = changes
+
+	return e, len(changes) > 0
+}
+
+func (d *Dispatcher) giveUp(h Hook, e Event, err error) {
+	if d.OnError != nil {
+		d.OnError(h, e, err)
+	}
+}
+
+// follow subscribes to the changes and failures of every lamp until the context is cancelled.
+func (d *Dispatcher) follow(ctx context.Context) {
+	d.Registry.Follow(ctx, nil, func(ctx context.Context, id string, c *yeelight.Config) {
+		changes, err := c.SubscribeWith(ctx, yeelight.SubscribeOptions{Policy: yeelight.DropOldest})
+		if err != nil {
+			return
+		}
+
+		// Failures are followed once the lamp answered, the seeding of an unreachable lamp is no command.
+		failures, err := c.Failures(ctx)
+		if err == nil {
+			go func() {
+				for f := range failures {
+					f := f
+					d.Publish(Event{Type: CommandFailed, Device: id, Name: d.name(id), Time: f.Time, Command: &f})
+				}
+			}()
+		}
+
+		d.changes(id, changes)
+	})
+}
+
+// changes publishes the changes of a device, the changes of one notification or command are one state event.
+func (d *Dispatcher) changes(id string, changes <-chan yeelight.Change) {
+	var pending *Event
+
+	flush := func() {
+		if pending != nil {
+			d.Publish(*pending)
+			pending = nil
+		}
+	}
+
+	for {
+		var c yeelight.Change
+		var ok bool
+
+		// Changes of one batch arrive together, the event goes out once no more of them are waiting.
+		select {
+		case c, ok = <-changes:
+		default:
+			flush()
+			c, ok = <-changes
+		}
+
+		if !ok {
+			flush()
+			return
+		}
+
+		if c.Property == "online" {
+			flush()
+
+			e := Event{Type: Offline, Device: id, Name: d.name(id), Time: c.Time}
+			if c.New == "true" {
+				e.Type = Online
+			}
+
+			d.Publish(e)
+
+			continue
+		}
+
+		if pending != nil && !pending.Time.Equal(c.Time) {
+			flush()
+		}
+
+		if pending == nil {
+			pending = &Event{Type: State, Device: id, Name: d.name(id), Time: c.Time, Changes: map[string]Change{}}
+		}
+
+		pending.Changes[c.Property] = Change{Old: c.Old, New: c.New}
+	}
+}
+
+func (d *Dispatcher) name(id string) string {
+	device, _ := d.Registry.Device(id)
+
+	return device.Name
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
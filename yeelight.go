@@ -2,20 +2,27 @@ package yeelight
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"math"
 	"math/rand"
 	"net"
 	"net/netip"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type Config struct {
-	conn      net.Conn
+	conn      *Conn
+	ctx       context.Context
 	IpAddress string
 	Port      int
+
+	// Optional perceptual scale applied to every brightness sent to the device, see BrightnessScale.
+	BrightnessScale BrightnessScale
 }
 
 type Request struct {
@@ -25,8 +32,19 @@ type Request struct {
 }
 
 type Response struct {
-	ID     int           `json:"id"`
-	Result []interface{} `json:"result"`
+	ID     int            `json:"id"`
+	Result []interface{}  `json:"result"`
+	Error  *ResponseError `json:"error,omitempty"`
+}
+
+// ResponseError is the error object a device answers with, for example when a method is not supported.
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("device error %d: %s", e.Code, e.Message)
 }
 
 type ListenResponse struct {
@@ -47,22 +65,26 @@ type ListenResponse struct {
 }
 
 type FlowExpression struct {
-	Duration   int
-	Mode       int
-	Value      int
-	Brightness int
+	Duration   int `json:"duration"`
+	Mode       int `json:"mode"`
+	Value      int `json:"value"`
+	Brightness int `json:"bright"`
 }
 
+/*
+Scene is what SetScene applies. "Action" is "color", "hsv", "ct" or "cf".
+For "cf" the flow is ColorFlow, Duration is the count and Mode is the action of SetColorFlow.
+*/
 type Scene struct {
-	Action           string
-	Color            int
-	ColorTemperature int
-	Hue              int
-	Saturation       int
-	ColorFlow        []FlowExpression
-	Mode             int
-	Brightness       int
-	Duration         int
+	Action           string           `json:"action"`
+	Color            int              `json:"color,omitempty"`
+	ColorTemperature int              `json:"ct,omitempty"`
+	Hue              int              `json:"hue,omitempty"`
+	Saturation       int              `json:"sat,omitempty"`
+	ColorFlow        []FlowExpression `json:"flow,omitempty"`
+	Mode             int              `json:"mode,omitempty"`
+	Brightness       int              `json:"bright,omitempty"`
+	Duration         int              `json:"duration,omitempty"`
 }
 
 func generateID() int {
@@ -73,20 +95,97 @@ func generateID() int {
 }
 
 func New(c *Config) Config {
-	conn, _ := net.Dial("tcp", fmt.Sprintf("%s:%v", c.IpAddress, c.Port))
+	conn := newConn(net.JoinHostPort(c.IpAddress, strconv.Itoa(c.Port)))
+
+	// Dial right away, a failed dial is tried again on the next call.
+	conn.current(context.Background())
 
 	return Config{
-		conn,
-		c.IpAddress,
-		c.Port,
+		conn:            conn,
+		IpAddress:       c.IpAddress,
+		Port:            c.Port,
+		BrightnessScale: c.BrightnessScale,
+	}
+}
+
+// call sends one request with the given method and params over the shared connection and waits for its answer.
+func (c *Config) call(method string, params ...interface{}) (Response, error) {
+	if c.conn == nil {
+		return Response{}, fmt.Errorf("not connected")
 	}
+
+	if c.ctx != nil {
+		return c.conn.CallContext(c.ctx, method, params...)
+	}
+
+	return c.conn.Call(method, params...)
+}
+
+/*
+This function is used to get a copy of the config whose calls stop waiting for their answer when the context is
+done. The copy shares the connection, the calls of other copies are not affected.
+
+Example:
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	r, err := y.WithContext(ctx).SetPower(true, "smooth", 500)
+*/
+func (c *Config) WithContext(ctx context.Context) *Config {
+	copied := *c
+	copied.ctx = ctx
+
+	return &copied
 }
 
 /*
 After you run the tcp you should close the tcp connection.
 */
 func (c *Config) Close() {
-	c.conn.Close()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+/*
+This function is used to receive the "props" notifications of the device. They arrive on the connection used for
+commands, no second connection is opened. Call the returned function to stop, the channel is closed then
+and when the config is closed. A notification is dropped when the channel is full, the reader never waits for it.
+
+Example:
+
+	notifications, stop := y.Notifications()
+	defer stop()
+
+	for n := range notifications {
+		...
+	}
+*/
+func (c *Config) Notifications() (<-chan ListenResponse, func()) {
+	ch := make(chan ListenResponse, 16)
+	if c.conn == nil {
+		close(ch)
+		return ch, func() {}
+	}
+
+	var once sync.Once
+	s := &subscription{
+		deliver: func(n notification) {
+			select {
+			case ch <- n.message:
+			default:
+			}
+		},
+		end: func() { once.Do(func() { close(ch) }) },
+	}
+
+	if err := c.conn.subscribe(s); err != nil {
+		s.end()
+		return ch, func() {}
+	}
+
+	return ch, func() { c.conn.unsubscribe(s) }
 }
 
 /*
@@ -113,6 +212,8 @@ func Discovery(cidr string) ([]string, error) {
 /*
 This function is used to Listen Yeelight device by IP Address. You should use ReadMessage function to read tcp message.
 
+Deprecated: Listen opens a second connection to the device, use Config.Notifications which shares the command connection.
+
 Example:
 
 	conn, err := yeelight.Listen("192.168.100.7")
@@ -141,6 +242,8 @@ func Listen(ip string) (net.Conn, error) {
 /*
 This function is used to read TCP message from function Listen.
 
+Deprecated: use Config.Notifications.
+
 Example:
 
 	for {
@@ -183,30 +286,7 @@ This function is used to retrieve current property. The allowed values is "power
 "bg_ct", "bg_lmode", "bg_bright", "bg_rgb", "bg_hue", "bg_sat", "nl_br", "active_mode"
 */
 func (c *Config) GetProps(p ...interface{}) (Response, error) {
-	id := generateID()
-
-	request := Request{
-		ID:     int(id),
-		Method: "get_prop",
-		Params: p,
-	}
-
-	bytes, _ := json.Marshal(request)
-
-	_, err := c.conn.Write([]byte(string(bytes) + "\r\n"))
-	if err != nil {
-		return Response{}, err
-	}
-
-	message, _ := bufio.NewReader(c.conn).ReadString('\n')
-
-	var r Response
-	err = json.Unmarshal([]byte(message), &r)
-	if err != nil {
-		return Response{}, err
-	}
-
-	return r, nil
+	return c.call("get_prop", p...)
 }
 
 /*
@@ -214,8 +294,6 @@ This function is used to change the color temperature. The allowed value for tem
 The allowed value effect is "sudden" and "smooth". For the duration action, it's should be more than 30 milliseconds.
 */
 func (c *Config) SetColorTemp(temp int, effect string, duration int) (Response, error) {
-	id := generateID()
-
 	if effect != "smooth" && effect != "sudden" {
 		return Response{}, fmt.Errorf("effect values is wrong, yeelight only supports effects 'smooth' and 'sudden'")
 	}
@@ -232,28 +310,7 @@ func (c *Config) SetColorTemp(temp int, effect string, duration int) (Response,
 		duration = 30
 	}
 
-	request := Request{
-		ID:     int(id),
-		Method: "set_ct_abx",
-		Params: []interface{}{temp, effect, duration},
-	}
-
-	bytes, _ := json.Marshal(request)
-
-	_, err := c.conn.Write([]byte(string(bytes) + "\r\n"))
-	if err != nil {
-		return Response{}, err
-	}
-
-	message, _ := bufio.NewReader(c.conn).ReadString('\n')
-
-	var r Response
-	err = json.Unmarshal([]byte(message), &r)
-	if err != nil {
-		return Response{}, err
-	}
-
-	return r, nil
+	return c.call("set_ct_abx", temp, effect, duration)
 }
 
 /*
@@ -261,8 +318,6 @@ This function is used to change the color. The allowed value effect is "sudden"
 For the duration action, it's should be more than 30 milliseconds.
 */
 func (c *Config) SetRGB(red int, green int, blue int, effect string, duration int) (Response, error) {
-	id := generateID()
-
 	if red < 0 || red > 255 {
 		return Response{}, fmt.Errorf("rgb should be in range 0-255")
 	}
@@ -285,28 +340,7 @@ func (c *Config) SetRGB(red int, green int, blue int, effect string, duration in
 
 	color := (red * 65536) + (green * 256) + blue
 
-	request := Request{
-		ID:     int(id),
-		Method: "set_rgb",
-		Params: []interface{}{color, effect, duration},
-	}
-
-	bytes, _ := json.Marshal(request)
-
-	_, err := c.conn.Write([]byte(string(bytes) + "\r\n"))
-	if err != nil {
-		return Response{}, err
-	}
-
-	message, _ := bufio.NewReader(c.conn).ReadString('\n')
-
-	var r Response
-	err = json.Unmarshal([]byte(message), &r)
-	if err != nil {
-		return Response{}, err
-	}
-
-	return r, nil
+	return c.call("set_rgb", color, effect, duration)
 }
 
 /*
@@ -317,8 +351,6 @@ The allowed value effect is "sudden" and "smooth".
 For the duration action, it's should be more than 30 milliseconds.
 */
 func (c *Config) SetHueSaturation(hue int, sat int, effect string, duration int) (Response, error) {
-	id := generateID()
-
 	if hue < 0 || hue > 359 {
 		return Response{}, fmt.Errorf("hue value should be in range 0-359")
 	}
@@ -335,28 +367,7 @@ func (c *Config) SetHueSaturation(hue int, sat int, effect string, duration int)
 		duration = 30
 	}
 
-	request := Request{
-		ID:     int(id),
-		Method: "set_hsv",
-		Params: []interface{}{hue, sat, effect, duration},
-	}
-
-	bytes, _ := json.Marshal(request)
-
-	_, err := c.conn.Write([]byte(string(bytes) + "\r\n"))
-	if err != nil {
-		return Response{}, err
-	}
-
-	message, _ := bufio.NewReader(c.conn).ReadString('\n')
-
-	var r Response
-	err = json.Unmarshal([]byte(message), &r)
-	if err != nil {
-		return Response{}, err
-	}
-
-	return r, nil
+	return c.call("set_hsv", hue, sat, effect, duration)
 }
 
 /*
@@ -366,8 +377,6 @@ The allowed value effect is "sudden" and "smooth".
 For the duration action, it's should be more than 30 milliseconds.
 */
 func (c *Config) SetBright(brightness int, effect string, duration int) (Response, error) {
-	id := generateID()
-
 	if effect != "smooth" && effect != "sudden" {
 		return Response{}, fmt.Errorf("effect values is wrong, yeelight only supports effects 'smooth' and 'sudden'")
 	}
@@ -380,32 +389,13 @@ func (c *Config) SetBright(brightness int, effect string, duration int) (Respons
 		brightness = 100
 	}
 
+	brightness = deviceBrightness(c.BrightnessScale, brightness)
+
 	if duration < 30 {
 		duration = 30
 	}
 
-	request := Request{
-		ID:     int(id),
-		Method: "set_bright",
-		Params: []interface{}{brightness, effect, duration},
-	}
-
-	bytes, _ := json.Marshal(request)
-
-	_, err := c.conn.Write([]byte(string(bytes) + "\r\n"))
-	if err != nil {
-		return Response{}, err
-	}
-
-	message, _ := bufio.NewReader(c.conn).ReadString('\n')
-
-	var r Response
-	err = json.Unmarshal([]byte(message), &r)
-	if err != nil {
-		return Response{}, err
-	}
-
-	return r, nil
+	return c.call("set_bright", brightness, effect, duration)
 }
 
 /*
@@ -413,8 +403,6 @@ This function is used to switch on or off. The allowed value effect is "sudden"
 For the duration action, it's should be more than 30 milliseconds.
 */
 func (c *Config) SetPower(power bool, effect string, duration int) (Response, error) {
-	id := generateID()
-
 	p := "off"
 	if power {
 		p = "on"
@@ -428,58 +416,21 @@ func (c *Config) SetPower(power bool, effect string, duration int) (Response, er
 		return Response{}, fmt.Errorf("effect values is wrong, yeelight only supports effects 'smooth' and 'sudden'")
 	}
 
-	request := Request{
-		ID:     int(id),
-		Method: "set_power",
-		Params: []interface{}{p, effect, duration},
-	}
-
-	bytes, _ := json.Marshal(request)
-
-	_, err := c.conn.Write([]byte(string(bytes) + "\r\n"))
-	if err != nil {
-		return Response{}, err
-	}
-
-	message, _ := bufio.NewReader(c.conn).ReadString('\n')
-
-	var r Response
-	err = json.Unmarshal([]byte(message), &r)
-	if err != nil {
-		return Response{}, err
-	}
+	return c.call("set_power", p, effect, duration)
+}
 
-	return r, nil
+/*
+This function is used to switch on when off and off when on.
+*/
+func (c *Config) Toggle() (Response, error) {
+	return c.call("toggle")
 }
 
 /*
 This function is used to save current state.
 */
 func (c *Config) SetDefault() (Response, error) {
-	id := generateID()
-
-	request := Request{
-		ID:     int(id),
-		Method: "set_default",
-		Params: []interface{}{},
-	}
-
-	bytes, _ := json.Marshal(request)
-
-	_, err := c.conn.Write([]byte(string(bytes) + "\r\n"))
-	if err != nil {
-		return Response{}, err
-	}
-
-	message, _ := bufio.NewReader(c.conn).ReadString('\n')
-
-	var r Response
-	err = json.Unmarshal([]byte(message), &r)
-	if err != nil {
-		return Response{}, err
-	}
-
-	return r, nil
+	return c.call("set_default")
 }
 
 /*
@@ -493,10 +444,18 @@ This function is used to start a color flow. "count" is the number of visible st
 "duration" for the duration in milliseconds, "value" is following the "mode", color or color temperature.
 */
 func (c *Config) SetColorFlow(count, action int, exprs []FlowExpression) (Response, error) {
-	id := generateID()
+	params, err := flowParams(c.BrightnessScale, count, action, exprs)
+	if err != nil {
+		return Response{}, err
+	}
 
+	return c.call("start_cf", params...)
+}
+
+// flowParams validates a color flow and builds the "start_cf" params.
+func flowParams(scale BrightnessScale, count, action int, exprs []FlowExpression) ([]interface{}, error) {
 	if action < 0 && action > 2 {
-		return Response{}, fmt.Errorf("action should be in range 0-2")
+		return nil, fmt.Errorf("action should be in range 0-2")
 	}
 
 	var exprStrArr []string
@@ -506,7 +465,7 @@ func (c *Config) SetColorFlow(count, action int, exprs []FlowExpression) (Respon
 		}
 
 		if expr.Mode != 1 && expr.Mode != 2 && expr.Mode != 7 {
-			return Response{}, fmt.Errorf("flow expression mode should be 1, 2 or 7. 1 - color, 2 - color temperature, 7 - sleep")
+			return nil, fmt.Errorf("flow expression mode should be 1, 2 or 7. 1 - color, 2 - color temperature, 7 - sleep")
 		}
 
 		if expr.Brightness < 1 {
@@ -515,71 +474,29 @@ func (c *Config) SetColorFlow(count, action int, exprs []FlowExpression) (Respon
 			expr.Brightness = 100
 		}
 
-		exprStrArr = append(exprStrArr, fmt.Sprintf("%d,%d,%d,%d", expr.Duration, expr.Mode, expr.Value, expr.Brightness))
-	}
-
-	request := Request{
-		ID:     int(id),
-		Method: "start_cf",
-		Params: []interface{}{count, action, strings.Join(exprStrArr, ",")},
-	}
-
-	bytes, _ := json.Marshal(request)
+		expr.Brightness = deviceBrightness(scale, expr.Brightness)
 
-	_, err := c.conn.Write([]byte(string(bytes) + "\r\n"))
-	if err != nil {
-		return Response{}, err
-	}
-
-	message, _ := bufio.NewReader(c.conn).ReadString('\n')
-
-	var r Response
-	err = json.Unmarshal([]byte(message), &r)
-	if err != nil {
-		return Response{}, err
+		exprStrArr = append(exprStrArr, fmt.Sprintf("%d,%d,%d,%d", expr.Duration, expr.Mode, expr.Value, expr.Brightness))
 	}
 
-	return r, nil
+	return []interface{}{count, action, strings.Join(exprStrArr, ",")}, nil
 }
 
 /*
 The function is used to stop current color flow.
 */
 func (c *Config) StopColorFlow() (Response, error) {
-	id := generateID()
-
-	request := Request{
-		ID:     int(id),
-		Method: "stop_cf",
-		Params: []interface{}{},
-	}
-
-	bytes, _ := json.Marshal(request)
-
-	_, err := c.conn.Write([]byte(string(bytes) + "\r\n"))
-	if err != nil {
-		return Response{}, err
-	}
-
-	message, _ := bufio.NewReader(c.conn).ReadString('\n')
-
-	var r Response
-	err = json.Unmarshal([]byte(message), &r)
-	if err != nil {
-		return Response{}, err
-	}
-
-	return r, nil
+	return c.call("stop_cf")
 }
 
 /*
 This function is used to set scene with color, hue saturation, color temperature or color flow.
 */
 func (c *Config) SetScene(scene Scene) (Response, error) {
-	id := generateID()
-
 	var params []interface{}
 
+	scene.Brightness = deviceBrightness(c.BrightnessScale, scene.Brightness)
+
 	if scene.Action == "color" {
 		params = []interface{}{scene.Action, scene.Color, scene.Brightness}
 	} else if scene.Action == "hsv" {
@@ -587,121 +504,36 @@ func (c *Config) SetScene(scene Scene) (Response, error) {
 	} else if scene.Action == "ct" {
 		params = []interface{}{scene.Action, scene.ColorTemperature, scene.Brightness}
 	} else if scene.Action == "cf" {
-		params = []interface{}{scene.Action, scene.Duration, scene.Mode, scene.ColorFlow}
-	}
-
-	request := Request{
-		ID:     id,
-		Method: "set_scene",
-		Params: params,
-	}
-
-	bytes, _ := json.Marshal(request)
+		flow, err := flowParams(c.BrightnessScale, scene.Duration, scene.Mode, scene.ColorFlow)
+		if err != nil {
+			return Response{}, err
+		}
 
-	_, err := c.conn.Write([]byte(string(bytes) + "\r\n"))
-	if err != nil {
-		return Response{}, err
+		params = append([]interface{}{scene.Action}, flow...)
 	}
 
-	message, _ := bufio.NewReader(c.conn).ReadString('\n')
-
-	var r Response
-	err = json.Unmarshal([]byte(message), &r)
-	if err != nil {
-		return Response{}, err
-	}
-
-	return r, nil
+	return c.call("set_scene", params...)
 }
 
 /*
 This function is used to added a cron job to turn off the lamp.
 */
 func (c *Config) CronAdd(timer int) (Response, error) {
-	id := generateID()
-
-	request := Request{
-		ID:     id,
-		Method: "cron_add",
-		Params: []interface{}{0, timer},
-	}
-
-	bytes, _ := json.Marshal(request)
-
-	_, err := c.conn.Write([]byte(string(bytes) + "\r\n"))
-	if err != nil {
-		return Response{}, err
-	}
-
-	message, _ := bufio.NewReader(c.conn).ReadString('\n')
-
-	var r Response
-	err = json.Unmarshal([]byte(message), &r)
-	if err != nil {
-		return Response{}, err
-	}
-
-	return r, nil
+	return c.call("cron_add", 0, timer)
 }
 
 /*
 This function is used to get cron jobs in queue.
 */
 func (c *Config) CronGet() (Response, error) {
-	id := generateID()
-
-	request := Request{
-		ID:     id,
-		Method: "cron_get",
-		Params: []interface{}{0},
-	}
-
-	bytes, _ := json.Marshal(request)
-
-	_, err := c.conn.Write([]byte(string(bytes) + "\r\n"))
-	if err != nil {
-		return Response{}, err
-	}
-
-	message, _ := bufio.NewReader(c.conn).ReadString('\n')
-
-	var r Response
-	err = json.Unmarshal([]byte(message), &r)
-	if err != nil {
-		return Response{}, err
-	}
-
-	return r, nil
+	return c.call("cron_get", 0)
 }
 
 /*
 This function is used to delete cron job in queue.
 */
 func (c *Config) CronDelete() (Response, error) {
-	id := generateID()
-
-	request := Request{
-		ID:     id,
-		Method: "cron_del",
-		Params: []interface{}{0},
-	}
-
-	bytes, _ := json.Marshal(request)
-
-	_, err := c.conn.Write([]byte(string(bytes) + "\r\n"))
-	if err != nil {
-		return Response{}, err
-	}
-
-	message, _ := bufio.NewReader(c.conn).ReadString('\n')
-
-	var r Response
-	err = json.Unmarshal([]byte(message), &r)
-	if err != nil {
-		return Response{}, err
-	}
-
-	return r, nil
+	return c.call("cron_del", 0)
 }
 
 /*
@@ -710,8 +542,6 @@ The allowed value "action" is increase, decrease and circle.
 The allowed value "prop" is bright, ct and color.
 */
 func (c *Config) SetAdjust(action, prop string) (Response, error) {
-	id := generateID()
-
 	if action != "increase" && action != "decrease" && action != "circle" {
 		return Response{}, fmt.Errorf("action should be increase, decrease or circle")
 	}
@@ -724,90 +554,42 @@ func (c *Config) SetAdjust(action, prop string) (Response, error) {
 		return Response{}, fmt.Errorf("when props is color, the action can only be circle")
 	}
 
-	request := Request{
-		ID:     id,
-		Method: "set_adjust",
-		Params: []interface{}{action, prop},
-	}
-
-	bytes, _ := json.Marshal(request)
-
-	_, err := c.conn.Write([]byte(string(bytes) + "\r\n"))
-	if err != nil {
-		return Response{}, err
-	}
-
-	message, _ := bufio.NewReader(c.conn).ReadString('\n')
-
-	var r Response
-	err = json.Unmarshal([]byte(message), &r)
-	if err != nil {
-		return Response{}, err
-	}
-
-	return r, nil
+	return c.call("set_adjust", action, prop)
 }
 
 /*
 The function is used to change the device name, stored in device not cloud.
 */
 func (c *Config) SetName(name string) (Response, error) {
-	id := generateID()
-
-	request := Request{
-		ID:     id,
-		Method: "set_name",
-		Params: []interface{}{name},
-	}
-
-	bytes, _ := json.Marshal(request)
-
-	_, err := c.conn.Write([]byte(string(bytes) + "\r\n"))
-	if err != nil {
-		return Response{}, err
-	}
-
-	message, _ := bufio.NewReader(c.conn).ReadString('\n')
-
-	var r Response
-	err = json.Unmarshal([]byte(message), &r)
-	if err != nil {
-		return Response{}, err
-	}
-
-	return r, nil
+	return c.call("set_name", name)
 }
 
 /*
 This function is used to adjust the brightness by specified bright percentage within specified duration.
 "bright" should fill with range -100 ~ 100.
 "duration" set the action duration with milisecond.
+With a BrightnessScale the step is perceptual too, the current brightness is read and a "set_bright" is sent instead.
 */
 func (c *Config) AdjustBright(bright, duration int) (Response, error) {
-	id := generateID()
-
-	request := Request{
-		ID:     id,
-		Method: "adjust_bright",
-		Params: []interface{}{bright, duration},
-	}
-
-	bytes, _ := json.Marshal(request)
+	if c.BrightnessScale != nil {
+		props, err := c.GetProps("bright")
+		if err != nil {
+			return Response{}, err
+		}
 
-	_, err := c.conn.Write([]byte(string(bytes) + "\r\n"))
-	if err != nil {
-		return Response{}, err
-	}
+		if len(props.Result) == 0 {
+			return Response{}, fmt.Errorf("device did not return the current brightness")
+		}
 
-	message, _ := bufio.NewReader(c.conn).ReadString('\n')
+		current, err := strconv.Atoi(fmt.Sprint(props.Result[0]))
+		if err != nil {
+			return Response{}, err
+		}
 
-	var r Response
-	err = json.Unmarshal([]byte(message), &r)
-	if err != nil {
-		return Response{}, err
+		return c.SetBright(c.BrightnessScale.FromDevice(current)+bright, "smooth", duration)
 	}
 
-	return r, nil
+	return c.call("adjust_bright", bright, duration)
 }
 
 /*
@@ -816,28 +598,5 @@ This function is used to adjust the color temperature by specified bright percen
 "duration" set the action duration with milisecond.
 */
 func (c *Config) AdjustColorTemperature(bright, duration int) (Response, error) {
-	id := generateID()
-
-	request := Request{
-		ID:     id,
-		Method: "adjust_ct",
-		Params: []interface{}{bright, duration},
-	}
-
-	bytes, _ := json.Marshal(request)
-
-	_, err := c.conn.Write([]byte(string(bytes) + "\r\n"))
-	if err != nil {
-		return Response{}, err
-	}
-
-	message, _ := bufio.NewReader(c.conn).ReadString('\n')
-
-	var r Response
-	err = json.Unmarshal([]byte(message), &r)
-	if err != nil {
-		return Response{}, err
-	}
-
-	return r, nil
+	return c.call("adjust_ct", bright, duration)
 }
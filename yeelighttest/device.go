@@ -0,0 +1,497 @@
+/*
+Package yeelighttest runs fake Yeelight devices on loopback, so code using the library can be tested without a lamp,
+the way net/http/httptest does it for HTTP servers.
+
+A device speaks the LAN protocol of the spec: every get and set method, color flows, scenes, the sleep timer of cron,
+the background light of ceiling lamps and music mode, where the device connects back. A change of the state is
+notified with a "props" message to every connection. Like a real lamp it accepts 4 connections at once, answers
+"client quota exceeded" past 60 commands per minute on a connection or 144 on all of them, and answers the error
+objects of the spec to unsupported methods, invalid params and commands a switched off lamp ignores.
+
+Example:
+
+	d := yeelighttest.NewDevice(yeelighttest.Options{})
+	defer d.Close()
+
+	y := d.Config()
+	defer y.Close()
+
+	y.SetPower(false, "smooth", 500)
+
+	if d.Get("power") != "off" {
+		...
+	}
+*/
+package yeelighttest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LordAur/yeelight"
+)
+
+// The error objects a device answers with.
+var (
+	ErrUnsupported   = &yeelight.ResponseError{Code: -1, Message: "unsupported method"}
+	ErrQuota         = &yeelight.ResponseError{Code: -1, Message: "client quota exceeded"}
+	ErrGeneral       = &yeelight.ResponseError{Code: -5000, Message: "general error"}
+	ErrInvalidParams = &yeelight.ResponseError{Code: -5001, Message: "invalid params"}
+)
+
+// The methods of a color bulb, and the ones a lamp with a background light has in addition.
+var (
+	methods = []string{
+		"get_prop", "set_default", "set_power", "toggle", "set_bright", "start_cf", "stop_cf", "set_scene",
+		"cron_add", "cron_get", "cron_del", "set_ct_abx", "set_rgb", "set_hsv", "set_adjust", "adjust_bright",
+		"adjust_ct", "adjust_color", "set_music", "set_name",
+	}
+
+	backgroundMethods = []string{
+		"bg_set_rgb", "bg_set_hsv", "bg_set_ct_abx", "bg_start_cf", "bg_stop_cf", "bg_set_scene", "bg_set_default",
+		"bg_set_power", "bg_set_bright", "bg_set_adjust", "bg_adjust_bright", "bg_adjust_color", "bg_adjust_ct",
+		"bg_toggle", "dev_toggle",
+	}
+)
+
+// Options of a fake device, the zero value is a color bulb that is on at full brightness and 4000 K.
+type Options struct {
+	// Listen address, default "127.0.0.1:0".
+	Addr string
+
+	// Default "0x0000000000000001", model "color" and firmware version 18.
+	ID              string
+	Model           string
+	FirmwareVersion int
+	Name            string
+
+	// Methods the device supports, default every method of the spec, the "bg_" ones only with Background.
+	Support []string
+
+	// A background light like ceiling lamps have, with the "bg_" properties and methods and a moonlight mode.
+	Background bool
+
+	// Initial values of properties, keyed and formatted like the answer of "get_prop".
+	State map[string]string
+
+	// Connections at once, default 4. A connection over the limit is closed right away.
+	MaxConnections int
+
+	// Commands per minute of a connection, default 60, and of all connections together, default 144.
+	// A negative value disables the limit.
+	Quota      int
+	TotalQuota int
+
+	// Accept connections but never answer, like a lamp that dropped off the network.
+	Silent bool
+}
+
+/*
+Device is a running fake device. Its state can be read with Get and changed with Set like the app or a wall switch
+would, the requests it received are kept for Requests.
+*/
+type Device struct {
+	opts     Options
+	listener net.Listener
+
+	mu       sync.Mutex
+	props    map[string]string
+	pending  map[string]string
+	clients  map[*client]bool
+	calls    []time.Time
+	requests []yeelight.Request
+	flows    map[string]*flow
+	cron     *time.Timer
+	cronEnd  time.Time
+	music    *client
+	closed   bool
+}
+
+// client is a connection to the device, or the connection of music mode the device opened itself.
+type client struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	calls   []time.Time
+	music   bool
+}
+
+/*
+This function is used to start a fake device. It panics when it can't listen, like httptest.NewServer.
+*/
+func NewDevice(opts Options) *Device {
+	if opts.Addr == "" {
+		opts.Addr = "127.0.0.1:0"
+	}
+
+	if opts.ID == "" {
+		opts.ID = "0x0000000000000001"
+	}
+
+	if opts.Model == "" {
+		opts.Model = "color"
+	}
+
+	if opts.FirmwareVersion == 0 {
+		opts.FirmwareVersion = 18
+	}
+
+	if opts.Support == nil {
+		opts.Support = append([]string(nil), methods...)
+		if opts.Background {
+			opts.Support = append(opts.Support, backgroundMethods...)
+		}
+	}
+
+	if opts.MaxConnections <= 0 {
+		opts.MaxConnections = 4
+	}
+
+	if opts.Quota == 0 {
+		opts.Quota = 60
+	}
+
+	if opts.TotalQuota == 0 {
+		opts.TotalQuota = 144
+	}
+
+	listener, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		panic(fmt.Sprintf("yeelighttest: failed to listen on %s: %v", opts.Addr, err))
+	}
+
+	d := &Device{
+		opts:     opts,
+		listener: listener,
+		props: map[string]string{
+			"power": "on", "bright": "100", "ct": "4000", "rgb": "16777215", "hue": "0", "sat": "0",
+			"color_mode": "2", "flowing": "0", "delayoff": "0", "flow_params": "", "music_on": "0", "name": opts.Name,
+		},
+		clients: map[*client]bool{},
+		flows:   map[string]*flow{},
+	}
+
+	if opts.Background {
+		for k, v := range map[string]string{
+			"bg_power": "off", "bg_bright": "100", "bg_ct": "4000", "bg_rgb": "16777215", "bg_hue": "0",
+			"bg_sat": "0", "bg_lmode": "2", "bg_flowing": "0", "bg_flow_params": "", "nl_br": "0", "active_mode": "0",
+		} {
+			d.props[k] = v
+		}
+	}
+
+	for k, v := range opts.State {
+		d.props[k] = v
+	}
+
+	go d.serve()
+
+	return d
+}
+
+/*
+This function is used to get the address of the device.
+*/
+func (d *Device) Addr() *net.TCPAddr {
+	return d.listener.Addr().(*net.TCPAddr)
+}
+
+/*
+This function is used to connect to the device with the library.
+*/
+func (d *Device) Config() yeelight.Config {
+	return yeelight.New(&yeelight.Config{IpAddress: d.Addr().IP.String(), Port: d.Addr().Port})
+}
+
+/*
+This function is used to get what the device tells about itself in a search answer, ready for Registry.Update.
+*/
+func (d *Device) Info() yeelight.Device {
+	device, _ := yeelight.ParseAdvertisement(d.Advertisement())
+
+	return device
+}
+
+/*
+This function is used to get the NOTIFY message the device would multicast, with its current state.
+*/
+func (d *Device) Advertisement() []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "NOTIFY * HTTP/1.1\r\n")
+	fmt.Fprintf(&b, "Host: 239.255.255.250:1982\r\n")
+	fmt.Fprintf(&b, "Cache-Control: max-age=3600\r\n")
+	fmt.Fprintf(&b, "Location: yeelight://%s\r\n", d.listener.Addr())
+	fmt.Fprintf(&b, "NTS: ssdp:alive\r\n")
+	fmt.Fprintf(&b, "Server: POSIX, UPnP/1.0 YGLC/1\r\n")
+	fmt.Fprintf(&b, "id: %s\r\n", d.opts.ID)
+	fmt.Fprintf(&b, "model: %s\r\n", d.opts.Model)
+	fmt.Fprintf(&b, "fw_ver: %d\r\n", d.opts.FirmwareVersion)
+	fmt.Fprintf(&b, "support: %s\r\n", strings.Join(d.opts.Support, " "))
+
+	for _, k := range []string{"power", "bright", "color_mode", "ct", "rgb", "hue", "sat", "name"} {
+		fmt.Fprintf(&b, "%s: %s\r\n", k, d.props[k])
+	}
+
+	return b.Bytes()
+}
+
+/*
+This function is used to read a property like "get_prop" does, empty when the device does not have it.
+*/
+func (d *Device) Get(name string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.prop(name)
+}
+
+/*
+This function is used to change properties like the app or a wall switch does, the change is notified.
+*/
+func (d *Device) Set(values map[string]string) {
+	d.mu.Lock()
+	for k, v := range values {
+		d.set(k, v)
+	}
+	d.mu.Unlock()
+
+	d.flush()
+}
+
+/*
+This function is used to get the requests the device received so far, in order, music mode included.
+*/
+func (d *Device) Requests() []yeelight.Request {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]yeelight.Request(nil), d.requests...)
+}
+
+/*
+This function is used to count the open connections, music mode not included.
+*/
+func (d *Device) Connections() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.clients)
+}
+
+/*
+This function is used to close the open connections like a lamp losing its WiFi does, new ones are accepted.
+*/
+func (d *Device) Drop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for c := range d.clients {
+		c.conn.Close()
+	}
+}
+
+/*
+This function is used to stop the device, its connections are closed.
+*/
+func (d *Device) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return
+	}
+
+	d.closed = true
+	d.listener.Close()
+
+	for c := range d.clients {
+		c.conn.Close()
+	}
+
+	if d.music != nil {
+		d.music.conn.Close()
+	}
+
+	for prefix := range d.flows {
+		d.stopFlow(prefix)
+	}
+
+	if d.cron != nil {
+		d.cron.Stop()
+	}
+}
+
+func (d *Device) serve() {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &client{conn: conn}
+
+		d.mu.Lock()
+		full := d.closed || len(d.clients) >= d.opts.MaxConnections
+		if !full {
+			d.clients[c] = true
+		}
+		d.mu.Unlock()
+
+		if full {
+			conn.Close()
+			continue
+		}
+
+		go d.read(c)
+	}
+}
+
+// read runs the commands of a connection, music mode gets no answers.
+func (d *Device) read(c *client) {
+	defer func() {
+		c.conn.Close()
+
+		d.mu.Lock()
+		delete(d.clients, c)
+		if d.music == c {
+			d.music = nil
+			d.set("music_on", "0")
+		}
+		d.mu.Unlock()
+
+		d.flush()
+	}()
+
+	scanner := bufio.NewScanner(c.conn)
+	for scanner.Scan() {
+		var req struct {
+			ID     int             `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil || d.opts.Silent {
+			continue
+		}
+
+		var params args
+		decoder := json.NewDecoder(bytes.NewReader(req.Params))
+		decoder.UseNumber()
+		decoder.Decode(&params)
+
+		result, failure := d.handle(c, req.Method, params)
+
+		if !c.music {
+			answer := map[string]interface{}{"id": req.ID, "result": result}
+			if failure != nil {
+				answer = map[string]interface{}{"id": req.ID, "error": failure}
+			}
+
+			line, _ := json.Marshal(answer)
+			c.write(line)
+		}
+
+		d.flush()
+	}
+}
+
+func (c *client) write(line []byte) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	// A client that stopped reading must not stall the device.
+	c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	c.conn.Write(append(line, '\r', '\n'))
+}
+
+func (d *Device) handle(c *client, method string, params args) ([]interface{}, *yeelight.ResponseError) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.requests = append(d.requests, yeelight.Request{Method: method, Params: []interface{}(params)})
+
+	if !c.music {
+		now := time.Now()
+		c.calls, d.calls = lastMinute(c.calls, now), lastMinute(d.calls, now)
+
+		if (d.opts.Quota > 0 && len(c.calls) >= d.opts.Quota) || (d.opts.TotalQuota > 0 && len(d.calls) >= d.opts.TotalQuota) {
+			return nil, ErrQuota
+		}
+
+		c.calls, d.calls = append(c.calls, now), append(d.calls, now)
+	}
+
+	return d.call(method, params)
+}
+
+func lastMinute(calls []time.Time, now time.Time) []time.Time {
+	i := sort.Search(len(calls), func(i int) bool {
+		return now.Sub(calls[i]) < time.Minute
+	})
+
+	return calls[i:]
+}
+
+// prop reads a property, the sleep timer counts down. The lock must be held.
+func (d *Device) prop(name string) string {
+	if name == "delayoff" && d.cron != nil {
+		return strconv.Itoa(int((time.Until(d.cronEnd) + time.Minute - 1) / time.Minute))
+	}
+
+	return d.props[name]
+}
+
+// set changes a property and remembers it for the next notification. The lock must be held.
+func (d *Device) set(name, value string) {
+	if d.props[name] == value {
+		return
+	}
+
+	d.props[name] = value
+
+	if d.pending == nil {
+		d.pending = map[string]string{}
+	}
+	d.pending[name] = value
+}
+
+// flush notifies the pending changes to every connection, numbers are sent as numbers like a lamp does.
+func (d *Device) flush() {
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = nil
+
+	clients := make([]*client, 0, len(d.clients))
+	for c := range d.clients {
+		clients = append(clients, c)
+	}
+	d.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	params := map[string]interface{}{}
+	for k, v := range pending {
+		if n, err := strconv.Atoi(v); err == nil && k != "name" {
+			params[k] = n
+		} else {
+			params[k] = v
+		}
+	}
+
+	line, _ := json.Marshal(map[string]interface{}{"method": "props", "params": params})
+	for _, c := range clients {
+		c.write(line)
+	}
+}
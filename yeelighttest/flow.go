@@ -0,0 +1,145 @@
+package yeelighttest
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// step is a tuple of a flow expression.
+type step struct {
+	duration time.Duration
+	mode     int
+	value    int
+	bright   int
+}
+
+// flow is a running color flow, closing stop ends it without its action.
+type flow struct {
+	stop chan struct{}
+}
+
+// parseFlow checks an expression of start_cf, tuples of duration, mode, value and brightness.
+func parseFlow(expression string) ([]step, bool) {
+	fields := strings.Split(expression, ",")
+	if expression == "" || len(fields)%4 != 0 {
+		return nil, false
+	}
+
+	var steps []step
+	for i := 0; i < len(fields); i += 4 {
+		var v [4]int
+		for j := range v {
+			n, err := strconv.Atoi(strings.TrimSpace(fields[i+j]))
+			if err != nil {
+				return nil, false
+			}
+
+			v[j] = n
+		}
+
+		s := step{duration: time.Duration(v[0]) * time.Millisecond, mode: v[1], value: v[2], bright: v[3]}
+
+		switch {
+		case v[0] < 50:
+			return nil, false
+		case s.mode == 1 && (s.value < 0 || s.value > 0xFFFFFF):
+			return nil, false
+		case s.mode == 2 && (s.value < 1700 || s.value > 6500):
+			return nil, false
+		case s.mode != 1 && s.mode != 2 && s.mode != 7:
+			return nil, false
+		case s.mode != 7 && s.bright != -1 && (s.bright < 1 || s.bright > 100):
+			return nil, false
+		}
+
+		steps = append(steps, s)
+	}
+
+	return steps, true
+}
+
+/*
+startFlow runs the steps of a flow on a light, count steps or endlessly with 0. At the end action 0 recovers the
+state from before the flow, 1 stays at the last step and 2 powers off. The lock must be held.
+*/
+func (d *Device) startFlow(prefix string, count, action int, steps []step, expression string) {
+	d.stopFlow(prefix)
+
+	mode := prefix + "color_mode"
+	if prefix == "bg_" {
+		mode = "bg_lmode"
+	}
+
+	before := map[string]string{}
+	for _, name := range []string{prefix + "power", prefix + "bright", prefix + "ct", prefix + "rgb", mode} {
+		before[name] = d.props[name]
+	}
+
+	f := &flow{stop: make(chan struct{})}
+	d.flows[prefix] = f
+
+	d.set(prefix+"flowing", "1")
+	d.set(prefix+"flow_params", strconv.Itoa(count)+","+strconv.Itoa(action)+","+expression)
+
+	go func() {
+		for n := 0; count == 0 || n < count; n++ {
+			s := steps[n%len(steps)]
+
+			d.mu.Lock()
+			if d.flows[prefix] != f {
+				d.mu.Unlock()
+				return
+			}
+
+			switch s.mode {
+			case 1:
+				d.set(prefix+"rgb", strconv.Itoa(s.value))
+				d.set(mode, "1")
+			case 2:
+				d.set(prefix+"ct", strconv.Itoa(s.value))
+				d.set(mode, "2")
+			}
+
+			if s.mode != 7 && s.bright != -1 {
+				d.set(prefix+"bright", strconv.Itoa(s.bright))
+			}
+			d.mu.Unlock()
+
+			d.flush()
+
+			select {
+			case <-f.stop:
+				return
+			case <-time.After(s.duration):
+			}
+		}
+
+		d.mu.Lock()
+		if d.flows[prefix] == f {
+			d.stopFlow(prefix)
+
+			switch action {
+			case 0:
+				for name, value := range before {
+					d.set(name, value)
+				}
+			case 2:
+				d.set(prefix+"power", "off")
+			}
+		}
+		d.mu.Unlock()
+
+		d.flush()
+	}()
+}
+
+// stopFlow ends the flow of a light where it is. The lock must be held.
+func (d *Device) stopFlow(prefix string) {
+	if f, ok := d.flows[prefix]; ok {
+		close(f.stop)
+		delete(d.flows, prefix)
+	}
+
+	d.set(prefix+"flowing", "0")
+}
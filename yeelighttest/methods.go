@@ -0,0 +1,476 @@
+package yeelighttest
+
+import (
+	"encoding/json"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LordAur/yeelight"
+)
+
+// args are the params of a request, numbers decoded as json.Number.
+type args []interface{}
+
+func (a args) int(i int) (int, bool) {
+	if i >= len(a) {
+		return 0, false
+	}
+
+	n, ok := a[i].(json.Number)
+	if !ok {
+		return 0, false
+	}
+
+	v, err := n.Int64()
+
+	return int(v), err == nil
+}
+
+func (a args) str(i int) (string, bool) {
+	if i >= len(a) {
+		return "", false
+	}
+
+	s, ok := a[i].(string)
+
+	return s, ok
+}
+
+// between reads an int param within a range.
+func (a args) between(i, low, high int) (int, bool) {
+	v, ok := a.int(i)
+
+	return v, ok && v >= low && v <= high
+}
+
+// transition checks the effect and duration params, a smooth change takes at least 30 ms.
+func (a args) transition(i int) bool {
+	effect, ok := a.str(i)
+	duration, good := a.int(i + 1)
+
+	return ok && good && (effect == "sudden" || (effect == "smooth" && duration >= 30))
+}
+
+// success is the result of a set method.
+var success = []interface{}{"ok"}
+
+/*
+call runs a method on the state of the device. A "bg_" method runs the same way on the background light, whose
+color mode is the property "bg_lmode". The lock must be held.
+*/
+func (d *Device) call(method string, a args) ([]interface{}, *yeelight.ResponseError) {
+	if !slices.Contains(d.opts.Support, method) {
+		return nil, ErrUnsupported
+	}
+
+	prefix := ""
+	if strings.HasPrefix(method, "bg_") {
+		prefix, method = "bg_", strings.TrimPrefix(method, "bg_")
+	}
+
+	key := func(name string) string {
+		if prefix == "bg_" && name == "color_mode" {
+			return "bg_lmode"
+		}
+
+		return prefix + name
+	}
+
+	on := d.props[key("power")] == "on"
+
+	switch method {
+	case "get_prop":
+		result := make([]interface{}, len(a))
+		for i := range a {
+			name, _ := a.str(i)
+			result[i] = d.prop(name)
+		}
+
+		return result, nil
+
+	case "set_power":
+		power, _ := a.str(0)
+		mode := 0
+		if len(a) > 3 {
+			var good bool
+			if mode, good = a.between(3, 0, 5); !good {
+				return nil, ErrInvalidParams
+			}
+		}
+
+		if (power != "on" && power != "off") || !a.transition(1) || (mode == 5 && !d.opts.Background) {
+			return nil, ErrInvalidParams
+		}
+
+		if power == "off" || mode != 0 {
+			d.stopFlow(prefix)
+		}
+
+		d.set(key("power"), power)
+
+		switch mode {
+		case 1:
+			d.set(key("color_mode"), "2")
+		case 2:
+			d.set(key("color_mode"), "1")
+		case 3:
+			d.set(key("color_mode"), "3")
+		}
+
+		if d.opts.Background && prefix == "" && mode == 5 {
+			d.set("active_mode", "1")
+		} else if d.opts.Background && prefix == "" && mode != 0 {
+			d.set("active_mode", "0")
+		}
+
+	case "toggle":
+		d.toggle(prefix)
+
+	case "dev_toggle":
+		d.toggle("")
+		d.toggle("bg_")
+
+	case "set_default":
+		// Only the power on state of a wall switch changes, nothing to notify.
+
+	case "set_ct_abx":
+		ct, good := a.between(0, 1700, 6500)
+		if !good || !a.transition(1) {
+			return nil, ErrInvalidParams
+		}
+
+		if !on {
+			return nil, ErrGeneral
+		}
+
+		d.stopFlow(prefix)
+		d.set(key("ct"), strconv.Itoa(ct))
+		d.set(key("color_mode"), "2")
+
+	case "set_rgb":
+		rgb, good := a.between(0, 0, 0xFFFFFF)
+		if !good || !a.transition(1) {
+			return nil, ErrInvalidParams
+		}
+
+		if !on {
+			return nil, ErrGeneral
+		}
+
+		d.stopFlow(prefix)
+		d.set(key("rgb"), strconv.Itoa(rgb))
+		d.set(key("color_mode"), "1")
+
+	case "set_hsv":
+		hue, good := a.between(0, 0, 359)
+		sat, fine := a.between(1, 0, 100)
+		if !good || !fine || !a.transition(2) {
+			return nil, ErrInvalidParams
+		}
+
+		if !on {
+			return nil, ErrGeneral
+		}
+
+		d.stopFlow(prefix)
+		d.set(key("hue"), strconv.Itoa(hue))
+		d.set(key("sat"), strconv.Itoa(sat))
+		d.set(key("color_mode"), "3")
+
+	case "set_bright":
+		bright, good := a.between(0, 1, 100)
+		if !good || !a.transition(1) {
+			return nil, ErrInvalidParams
+		}
+
+		if !on {
+			return nil, ErrGeneral
+		}
+
+		d.set(key("bright"), strconv.Itoa(bright))
+
+	case "start_cf":
+		count, good := a.between(0, 0, 1<<31-1)
+		action, fine := a.between(1, 0, 2)
+		expression, _ := a.str(2)
+		steps, valid := parseFlow(expression)
+		if !good || !fine || !valid {
+			return nil, ErrInvalidParams
+		}
+
+		if !on {
+			return nil, ErrGeneral
+		}
+
+		d.startFlow(prefix, count, action, steps, expression)
+
+	case "stop_cf":
+		d.stopFlow(prefix)
+
+	case "set_scene":
+		return d.scene(prefix, key, a)
+
+	case "cron_add":
+		_, good := a.between(0, 0, 0)
+		minutes, fine := a.between(1, 1, 1<<31-1)
+		if !good || !fine {
+			return nil, ErrInvalidParams
+		}
+
+		d.startCron(minutes)
+
+	case "cron_get":
+		if _, good := a.between(0, 0, 0); !good {
+			return nil, ErrInvalidParams
+		}
+
+		if d.cron == nil {
+			return []interface{}{}, nil
+		}
+
+		delay, _ := strconv.Atoi(d.prop("delayoff"))
+
+		return []interface{}{map[string]interface{}{"type": 0, "delay": delay, "mix": 0}}, nil
+
+	case "cron_del":
+		if _, good := a.between(0, 0, 0); !good {
+			return nil, ErrInvalidParams
+		}
+
+		d.stopCron()
+
+	case "set_adjust":
+		action, _ := a.str(0)
+		prop, _ := a.str(1)
+
+		if !slices.Contains([]string{"increase", "decrease", "circle"}, action) ||
+			!slices.Contains([]string{"bright", "ct", "color"}, prop) || (prop == "color" && action != "circle") {
+			return nil, ErrInvalidParams
+		}
+
+		if !on {
+			return nil, ErrGeneral
+		}
+
+		switch prop {
+		case "bright":
+			d.adjust(key("bright"), map[string]int{"increase": 10, "decrease": -10, "circle": 10}[action], 1, 100, action == "circle")
+		case "ct":
+			d.adjust(key("ct"), map[string]int{"increase": 480, "decrease": -480, "circle": 480}[action], 1700, 6500, action == "circle")
+			d.set(key("color_mode"), "2")
+		case "color":
+			d.adjust(key("hue"), 36, 0, 359, true)
+			d.set(key("color_mode"), "3")
+		}
+
+	case "adjust_bright", "adjust_ct", "adjust_color":
+		percentage, good := a.between(0, -100, 100)
+		duration, fine := a.int(1)
+		if !good || !fine || duration < 30 {
+			return nil, ErrInvalidParams
+		}
+
+		if !on {
+			return nil, ErrGeneral
+		}
+
+		switch method {
+		case "adjust_bright":
+			d.adjust(key("bright"), percentage, 1, 100, false)
+		case "adjust_ct":
+			d.adjust(key("ct"), percentage*48, 1700, 6500, false)
+			d.set(key("color_mode"), "2")
+		case "adjust_color":
+			d.adjust(key("hue"), percentage*360/100, 0, 359, true)
+			d.set(key("color_mode"), "3")
+		}
+
+	case "set_music":
+		action, good := a.between(0, 0, 1)
+		if !good {
+			return nil, ErrInvalidParams
+		}
+
+		if action == 0 {
+			if d.music != nil {
+				d.music.conn.Close()
+				d.music = nil
+				d.set("music_on", "0")
+			}
+
+			return success, nil
+		}
+
+		host, _ := a.str(1)
+		port, fine := a.between(2, 1, 65535)
+		if host == "" || !fine {
+			return nil, ErrInvalidParams
+		}
+
+		return d.startMusic(net.JoinHostPort(host, strconv.Itoa(port)))
+
+	case "set_name":
+		name, good := a.str(0)
+		if !good {
+			return nil, ErrInvalidParams
+		}
+
+		d.set("name", name)
+
+	default:
+		return nil, ErrUnsupported
+	}
+
+	return success, nil
+}
+
+// scene runs set_scene, it switches the light on.
+func (d *Device) scene(prefix string, key func(string) string, a args) ([]interface{}, *yeelight.ResponseError) {
+	class, _ := a.str(0)
+
+	switch class {
+	case "color", "ct":
+		low, high, mode := 0, 0xFFFFFF, "1"
+		if class == "ct" {
+			low, high, mode = 1700, 6500, "2"
+		}
+
+		value, good := a.between(1, low, high)
+		bright, fine := a.between(2, 1, 100)
+		if !good || !fine {
+			return nil, ErrInvalidParams
+		}
+
+		d.stopFlow(prefix)
+		d.set(key("power"), "on")
+		d.set(key(map[string]string{"color": "rgb", "ct": "ct"}[class]), strconv.Itoa(value))
+		d.set(key("bright"), strconv.Itoa(bright))
+		d.set(key("color_mode"), mode)
+
+	case "hsv":
+		hue, good := a.between(1, 0, 359)
+		sat, fine := a.between(2, 0, 100)
+		bright, valid := a.between(3, 1, 100)
+		if !good || !fine || !valid {
+			return nil, ErrInvalidParams
+		}
+
+		d.stopFlow(prefix)
+		d.set(key("power"), "on")
+		d.set(key("hue"), strconv.Itoa(hue))
+		d.set(key("sat"), strconv.Itoa(sat))
+		d.set(key("bright"), strconv.Itoa(bright))
+		d.set(key("color_mode"), "3")
+
+	case "cf":
+		count, good := a.between(1, 0, 1<<31-1)
+		action, fine := a.between(2, 0, 2)
+		expression, _ := a.str(3)
+		steps, valid := parseFlow(expression)
+		if !good || !fine || !valid {
+			return nil, ErrInvalidParams
+		}
+
+		d.set(key("power"), "on")
+		d.startFlow(prefix, count, action, steps, expression)
+
+	case "auto_delay_off":
+		bright, good := a.between(1, 1, 100)
+		minutes, fine := a.between(2, 1, 1<<31-1)
+		if !good || !fine || prefix != "" {
+			return nil, ErrInvalidParams
+		}
+
+		d.stopFlow(prefix)
+		d.set("power", "on")
+		d.set("bright", strconv.Itoa(bright))
+		d.startCron(minutes)
+
+	default:
+		return nil, ErrInvalidParams
+	}
+
+	return success, nil
+}
+
+func (d *Device) toggle(prefix string) {
+	if d.props[prefix+"power"] == "on" {
+		d.stopFlow(prefix)
+		d.set(prefix+"power", "off")
+	} else {
+		d.set(prefix+"power", "on")
+	}
+}
+
+// adjust adds to a numeric property, clamped to the range or wrapped around with circle.
+func (d *Device) adjust(name string, delta, low, high int, circle bool) {
+	v, _ := strconv.Atoi(d.props[name])
+	v += delta
+
+	switch {
+	case circle && v > high:
+		v = low + (v-high-1)%(high-low+1)
+	case circle && v < low:
+		v = high - (low-v-1)%(high-low+1)
+	default:
+		v = max(low, min(high, v))
+	}
+
+	d.set(name, strconv.Itoa(v))
+}
+
+// startCron powers the lamp off after some minutes, a timer set before is replaced.
+func (d *Device) startCron(minutes int) {
+	d.stopCron()
+
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Duration(minutes)*time.Minute, func() {
+		d.mu.Lock()
+		if d.cron != timer {
+			d.mu.Unlock()
+			return
+		}
+
+		d.cron = nil
+		d.stopFlow("")
+		d.set("power", "off")
+		d.set("delayoff", "0")
+		d.mu.Unlock()
+
+		d.flush()
+	})
+
+	d.cron, d.cronEnd = timer, time.Now().Add(time.Duration(minutes)*time.Minute)
+	d.set("delayoff", strconv.Itoa(minutes))
+}
+
+func (d *Device) stopCron() {
+	if d.cron != nil {
+		d.cron.Stop()
+		d.cron = nil
+	}
+
+	d.set("delayoff", "0")
+}
+
+// startMusic connects to the server of music mode, its commands are run without answers and quota.
+func (d *Device) startMusic(addr string) ([]interface{}, *yeelight.ResponseError) {
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		return nil, ErrGeneral
+	}
+
+	if d.music != nil {
+		d.music.conn.Close()
+	}
+
+	d.music = &client{conn: conn, music: true}
+	d.set("music_on", "1")
+
+	go d.read(d.music)
+
+	return success, nil
+}